@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testAppKey generates an app private key, PEM encoded as GitHub issues it
+func testAppKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func TestParseAppPrivateKey(t *testing.T) {
+	key, pkcs1 := testAppKey(t)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	tests := []struct {
+		name    string
+		pem     []byte
+		wantErr string
+	}{
+		{"pkcs1", pkcs1, ""},
+		{"pkcs8", pkcs8, ""},
+		{"not pem", []byte("secret"), "not PEM encoded"},
+		{"garbage", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("x")}), "failed to parse"},
+	}
+	for _, tt := range tests {
+		parsed, err := parseAppPrivateKey(tt.pem)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !parsed.Equal(key) {
+			t.Errorf("%s: parseAppPrivateKey = %v", tt.name, err)
+		}
+	}
+}
+
+// The app JWT is RS256 signed by the app key, issued by the app ID and valid
+// for less than GitHub's ten minutes
+func TestGitHubAppJWT(t *testing.T) {
+	key, keyPEM := testAppKey(t)
+	app, err := NewGitHubAppAuth("", 42, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := app.jwt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("jwt has %d parts", len(parts))
+	}
+	var header struct{ Alg string }
+	var claims struct {
+		Iat, Exp int64
+		Iss      string
+	}
+	for i, out := range []interface{}{&header, &claims} {
+		data, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if header.Alg != "RS256" || claims.Iss != "42" {
+		t.Errorf("alg %q, iss %q", header.Alg, claims.Iss)
+	}
+	now := time.Now().Unix()
+	if claims.Iat > now || claims.Exp <= now || claims.Exp-claims.Iat > 600 {
+		t.Errorf("iat %d, exp %d around now %d", claims.Iat, claims.Exp, now)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("signature: %v", err)
+	}
+}
+
+// Installation tokens are minted once, reused until shortly before expiry,
+// renewed by one request however many callers need them, and unknown owners
+// are not looked up again within unknownOwnerTTL
+func TestGitHubAppInstallationTokens(t *testing.T) {
+	_, keyPEM := testAppKey(t)
+	var listings, mints int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Count(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".") != 2 {
+			w.WriteHeader(401)
+			return
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v3/app/installations":
+			atomic.AddInt32(&listings, 1)
+			w.Write([]byte(`[{"id":7,"account":{"login":"Acme"}}]`))
+		case r.Method == "POST" && r.URL.Path == "/api/v3/app/installations/7/access_tokens":
+			n := atomic.AddInt32(&mints, 1)
+			time.Sleep(20 * time.Millisecond) // Keep concurrent callers waiting on the same request
+			w.WriteHeader(201)
+			fmt.Fprintf(w, `{"token":"tok-%d","expires_at":%q}`, n, time.Now().Add(time.Hour).Format(time.RFC3339))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	app, err := NewGitHubAppAuth(server.URL, 42, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	expireSoon := func() {
+		app.mu.Lock()
+		app.installations["acme"].expiresAt = time.Now().Add(installationTokenSkew / 2)
+		app.mu.Unlock()
+	}
+
+	steps := []struct {
+		name       string
+		before     func()
+		callers    int
+		wantToken  string
+		wantMints  int32
+		wantListed int32
+	}{
+		{"first use lists installations and mints", nil, 1, "tok-1", 1, 1},
+		{"valid token is reused", nil, 1, "tok-1", 1, 1},
+		{"token near expiry is renewed", expireSoon, 1, "tok-2", 2, 1},
+		{"concurrent renewals share one request", expireSoon, 8, "tok-3", 3, 1},
+	}
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		tokens := make([]string, step.callers)
+		errs := make([]error, step.callers)
+		var wg sync.WaitGroup
+		for i := range tokens {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				tokens[i], errs[i] = app.TokenForOwner(ctx, "ACME")
+			}(i)
+		}
+		wg.Wait()
+		for i := range tokens {
+			if errs[i] != nil || tokens[i] != step.wantToken {
+				t.Errorf("%s: caller %d got %q, %v; want %s", step.name, i, tokens[i], errs[i], step.wantToken)
+			}
+		}
+		if got := atomic.LoadInt32(&mints); got != step.wantMints {
+			t.Errorf("%s: %d tokens minted, want %d", step.name, got, step.wantMints)
+		}
+		if got := atomic.LoadInt32(&listings); got != step.wantListed {
+			t.Errorf("%s: installations listed %d times, want %d", step.name, got, step.wantListed)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := app.TokenForOwner(ctx, "stranger"); err == nil || !strings.Contains(err.Error(), "not installed") {
+			t.Errorf("stranger lookup %d: error = %v", i, err)
+		}
+	}
+	if got := atomic.LoadInt32(&listings); got != 2 {
+		t.Errorf("unknown owner listed installations %d times, want once", got-1)
+	}
+}
+
+// standInOAuth serves GitHub's device flow endpoints, answering each token
+// poll with the next of answers, plus the API a connected account reads
+func standInOAuth(t *testing.T, answers ...string) (server *httptest.Server, polls *int32) {
+	t.Helper()
+	polls = new(int32)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/device/code":
+			w.Write([]byte(`{"device_code":"dc","user_code":"ABCD-1234","verification_uri":"https://example.com/device","expires_in":900,"interval":0}`))
+		case "/login/oauth/access_token":
+			n := int(atomic.AddInt32(polls, 1))
+			answer := answers[len(answers)-1]
+			if n <= len(answers) {
+				answer = answers[n-1]
+			}
+			if answer == "" {
+				w.Write([]byte(`{"access_token":"user-token"}`))
+				return
+			}
+			fmt.Fprintf(w, `{"error":%q}`, answer)
+		case "/api/v3/user":
+			w.Write([]byte(`{"login":"alice"}`))
+		case "/api/v3/user/repos":
+			w.Write([]byte(`[]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, polls
+}
+
+// startDeviceFlow begins a device flow against server and returns its ID
+func startDeviceFlow(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	saved := oauthClientID
+	oauthClientID = "client"
+	t.Cleanup(func() { oauthClientID = saved })
+
+	var started struct {
+		FlowID string `json:"flowId"`
+	}
+	json.Unmarshal(call(t, githubDeviceStart, "POST", "/api/github/device/start", `{"baseUrl":"`+server.URL+`"}`), &started)
+	if started.FlowID == "" {
+		t.Fatal("device flow started without an ID")
+	}
+	return started.FlowID
+}
+
+// pollDeviceFlow polls flowID once and returns the status code and answer
+func pollDeviceFlow(t *testing.T, flowID string) (int, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	githubDevicePoll(rec, httptest.NewRequest("POST", "/api/github/device/poll", strings.NewReader(`{"flowId":"`+flowID+`"}`)))
+	var doc map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &doc)
+	return rec.Code, doc
+}
+
+// Polling stays pending until the user authorizes, honours slow_down without
+// contacting GitHub early, then connects the account
+func TestDeviceFlowPolling(t *testing.T) {
+	isolateState(t)
+	server, polls := standInOAuth(t, "authorization_pending", "slow_down", "")
+	flowID := startDeviceFlow(t, server)
+
+	steps := []struct {
+		name         string
+		before       func()
+		wantStatus   string
+		wantInterval float64
+		wantPolls    int32
+	}{
+		{"pending", nil, "pending", 0, 1},
+		{"slow_down raises the interval", nil, "pending", 5, 2},
+		{"early poll answered locally", nil, "pending", 5, 2},
+		{"authorized", func() {
+			deviceFlowsLock.Lock()
+			deviceFlows[flowID].lastPoll = time.Now().Add(-6 * time.Second)
+			deviceFlowsLock.Unlock()
+		}, "", 0, 3},
+	}
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		code, doc := pollDeviceFlow(t, flowID)
+		if code != 200 {
+			t.Fatalf("%s: status %d: %v", step.name, code, doc)
+		}
+		if step.wantStatus != "" && (doc["status"] != step.wantStatus || doc["interval"] != step.wantInterval) {
+			t.Errorf("%s: answer %v, want %s every %vs", step.name, doc, step.wantStatus, step.wantInterval)
+		}
+		if got := atomic.LoadInt32(polls); got != step.wantPolls {
+			t.Errorf("%s: GitHub polled %d times, want %d", step.name, got, step.wantPolls)
+		}
+	}
+
+	id := connectionID("github", server.URL, "alice")
+	if conn := connectionFor(id); conn == nil || conn.creds.oauth == nil {
+		t.Fatalf("authorized flow did not connect %s with its user token", id)
+	}
+	if code, _ := pollDeviceFlow(t, flowID); code != 404 {
+		t.Errorf("finished flow polled again: %d, want 404", code)
+	}
+}
+
+// A flow ends when the code expires, locally or at GitHub, or is denied
+func TestDeviceFlowEnds(t *testing.T) {
+	isolateState(t)
+	tests := []struct {
+		name       string
+		answer     string
+		expire     bool
+		wantCode   int
+		wantStatus string
+	}{
+		{"expired locally", "authorization_pending", true, 410, "expired"},
+		{"expired at GitHub", "expired_token", false, 410, "expired"},
+		{"denied", "access_denied", false, 403, "denied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, polls := standInOAuth(t, tt.answer)
+			flowID := startDeviceFlow(t, server)
+			if tt.expire {
+				deviceFlowsLock.Lock()
+				deviceFlows[flowID].expiresAt = time.Now().Add(-time.Second)
+				deviceFlowsLock.Unlock()
+			}
+
+			code, doc := pollDeviceFlow(t, flowID)
+			if code != tt.wantCode || doc["status"] != tt.wantStatus {
+				t.Errorf("poll = %d %v, want %d %s", code, doc, tt.wantCode, tt.wantStatus)
+			}
+			if tt.expire && atomic.LoadInt32(polls) != 0 {
+				t.Errorf("expired flow still polled GitHub")
+			}
+			if code, _ := pollDeviceFlow(t, flowID); code != 404 {
+				t.Errorf("ended flow polled again: %d, want 404", code)
+			}
+		})
+	}
+}
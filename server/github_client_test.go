@@ -0,0 +1,535 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeGitHubAPIURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", defaultGitHubAPIURL},
+		{"https://github.com", defaultGitHubAPIURL},
+		{"https://github.com/", defaultGitHubAPIURL},
+		{"https://www.github.com", defaultGitHubAPIURL},
+		{"https://api.github.com", defaultGitHubAPIURL},
+		{"https://api.github.com/", defaultGitHubAPIURL},
+		{"https://ghe.example.com", "https://ghe.example.com/api/v3"},
+		{" https://ghe.example.com/ ", "https://ghe.example.com/api/v3"},
+		{"https://ghe.example.com/api/v3/", "https://ghe.example.com/api/v3"},
+	}
+	for _, tt := range tests {
+		if got := normalizeGitHubAPIURL(tt.in); got != tt.want {
+			t.Errorf("normalizeGitHubAPIURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// A bare host is treated as GitHub Enterprise Server, so the client must
+// address the stand-in server under /api/v3 and send its token there
+func TestGitHubClientAgainstEnterpriseHost(t *testing.T) {
+	saved := githubResponseCache
+	githubResponseCache = nil
+	defer func() { githubResponseCache = saved }()
+
+	var gotPath, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		if r.URL.Path != "/api/v3/repos/acme/app" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"app","full_name":"acme/app","default_branch":"trunk","owner":{"login":"acme"}}`))
+	}))
+	defer server.Close()
+
+	client := NewGitHubClient(server.URL, "secret")
+	if client.baseURL != server.URL+"/api/v3" {
+		t.Fatalf("baseURL = %q, want %q", client.baseURL, server.URL+"/api/v3")
+	}
+
+	repo, err := client.GetRepository(context.Background(), "acme", "app")
+	if err != nil {
+		t.Fatalf("GetRepository: %v (last request %s)", err, gotPath)
+	}
+	if repo.FullName != "acme/app" || repo.DefaultBranch != "trunk" {
+		t.Errorf("GetRepository = %+v", repo)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization = %q, want Bearer secret", gotAuth)
+	}
+}
+
+// An immutable object cached for one token must not be served to another
+func TestResponseCacheScopedByCredential(t *testing.T) {
+	rc, err := newResponseCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := githubResponseCache
+	githubResponseCache = rc
+	defer func() { githubResponseCache = saved }()
+
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer owner" {
+			w.WriteHeader(404)
+			w.Write([]byte(`{"message":"Not Found"}`))
+			return
+		}
+		w.Write([]byte(`{"sha":"` + sha + `"}`))
+	}))
+	defer server.Close()
+
+	path := "/repos/acme/private/commits/" + sha
+	_, status, err := NewGitHubClient(server.URL, "owner").request(context.Background(), path)
+	if err != nil || status != 200 {
+		t.Fatalf("owner request = %d, %v", status, err)
+	}
+	_, status, err = NewGitHubClient(server.URL, "stranger").request(context.Background(), path)
+	if err != nil || status != 404 {
+		t.Errorf("stranger request = %d, %v; want 404 from the server, not the owner's cached copy", status, err)
+	}
+}
+
+// isolateState points state.json at a temporary file and starts the test
+// with no state and no connections, restoring both afterwards
+func isolateState(t *testing.T) {
+	t.Helper()
+	savedCache, savedFile := githubResponseCache, stateFile
+	githubResponseCache, stateFile = nil, filepath.Join(t.TempDir(), "state.json")
+	t.Cleanup(func() {
+		githubResponseCache, stateFile = savedCache, savedFile
+		loadState()
+		resetConnections()
+	})
+	loadState()
+	resetConnections()
+}
+
+// standInGitHub serves a GitHub Enterprise API root where login owns a
+// single repo, acme/app, described as description
+func standInGitHub(t *testing.T, login, description string) *httptest.Server {
+	t.Helper()
+	repo := `{"id":1,"name":"app","full_name":"acme/app","default_branch":"main","owner":{"login":"acme"},"description":"` + description + `"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v3/user":
+			w.Write([]byte(`{"login":"` + login + `"}`))
+		case "/api/v3/user/repos":
+			w.Write([]byte(`[` + repo + `]`))
+		case "/api/v3/repos/acme/app":
+			w.Write([]byte(repo))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Two hosts listing the same owner/name are two projects: a bare name is
+// ambiguous, and ?connection= reads each through its own host
+func TestConnectionRouting(t *testing.T) {
+	isolateState(t)
+	first := standInGitHub(t, "alice", "first host")
+	second := standInGitHub(t, "alice", "second host")
+	call(t, githubConnect, "POST", "/api/github/connect", `{"token":"one","baseUrl":"`+first.URL+`"}`)
+	call(t, githubConnect, "POST", "/api/github/connect", `{"token":"two","baseUrl":"`+second.URL+`"}`)
+
+	firstID := connectionID("github", first.URL, "alice")
+	secondID := connectionID("github", second.URL, "alice")
+	if firstID == secondID {
+		t.Fatalf("both hosts got connection %s", firstID)
+	}
+
+	tests := []struct {
+		name       string
+		connection string
+		wantStatus int
+		want       string // In the description on success, the error otherwise
+	}{
+		{"bare name", "", 404, "listed by 2 connections"},
+		{"first host", firstID, 200, "first host"},
+		{"second host", secondID, 200, "second host"},
+		{"unknown connection", "github:elsewhere:bob", 404, "project not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/api/projects/acme/app/analyze"
+			if tt.connection != "" {
+				target += "?connection=" + url.QueryEscape(tt.connection)
+			}
+			rec := httptest.NewRecorder()
+			analyzeProject(rec, httptest.NewRequest("POST", target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			var doc struct {
+				Error    string `json:"error"`
+				Metadata struct {
+					Description string `json:"description"`
+				} `json:"metadata"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &doc)
+			got := doc.Error
+			if tt.wantStatus == 200 {
+				got = doc.Metadata.Description
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindRepo(t *testing.T) {
+	isolateState(t)
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	addConnectionUnsafe(&GitHubConnection{ID: "github:a:x"}, []DiscoveredRepo{{FullName: "acme/app"}, {FullName: "acme/lib"}})
+	addConnectionUnsafe(&GitHubConnection{ID: "gitlab:b:x"}, []DiscoveredRepo{{FullName: "acme/app"}})
+
+	tests := []struct {
+		key            string
+		wantConnection string
+		wantErr        string
+	}{
+		{"github:a:x/acme/app", "github:a:x", ""},
+		{"gitlab:b:x/acme/app", "gitlab:b:x", ""},
+		{"acme/lib", "github:a:x", ""},
+		{"acme/app", "", "acme/app is listed by 2 connections"},
+		{"acme/none", "", "project not found"},
+		{"gitlab:b:x/acme/lib", "", "project not found"},
+	}
+	for _, tt := range tests {
+		repo, err := findRepoUnsafe(tt.key)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("findRepoUnsafe(%q) error = %v, want %q", tt.key, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || repo.ConnectionID != tt.wantConnection {
+			t.Errorf("findRepoUnsafe(%q) = %+v, %v; want a repo of %s", tt.key, repo, err, tt.wantConnection)
+		}
+	}
+}
+
+// Rediscovery keeps a connection's analysis states, and removing it drops
+// only its own repos and analyses
+func TestAddAndRemoveConnection(t *testing.T) {
+	isolateState(t)
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	registerConnection(&liveConnection{id: "github:a:x", provider: "github"})
+	registerConnection(&liveConnection{id: "gitlab:b:x", provider: "gitlab"})
+
+	addConnectionUnsafe(&GitHubConnection{ID: "github:a:x"}, []DiscoveredRepo{{FullName: "acme/app"}, {FullName: "acme/lib"}})
+	addConnectionUnsafe(&GitHubConnection{ID: "gitlab:b:x"}, []DiscoveredRepo{{FullName: "acme/app"}})
+	state.DiscoveredRepos[0].AnalysisState = "ready"
+	state.Analyses["github:a:x/acme/app"] = &RepoAnalysis{}
+	state.Analyses["github:a:x/acme/app@v1"] = &RepoAnalysis{}
+	state.Analyses["gitlab:b:x/acme/app"] = &RepoAnalysis{}
+	state.SelectedProject = "github:a:x/acme/app"
+
+	addConnectionUnsafe(&GitHubConnection{ID: "github:a:x"}, []DiscoveredRepo{{FullName: "acme/app"}})
+	if repo, err := findRepoUnsafe("github:a:x/acme/app"); err != nil || repo.AnalysisState != "ready" || len(state.DiscoveredRepos) != 2 {
+		t.Errorf("after rediscovery repos = %+v", state.DiscoveredRepos)
+	}
+	if len(state.Connections) != 2 || state.Connection.ID != "gitlab:b:x" {
+		t.Errorf("rediscovery changed the connections: %d, current %s", len(state.Connections), state.Connection.ID)
+	}
+
+	removeConnectionUnsafe("github:a:x")
+	if isLiveConnection("github:a:x") || !isLiveConnection("gitlab:b:x") {
+		t.Errorf("removal unregistered the wrong connection")
+	}
+	if len(state.DiscoveredRepos) != 1 || state.DiscoveredRepos[0].ConnectionID != "gitlab:b:x" {
+		t.Errorf("repos after removal = %+v", state.DiscoveredRepos)
+	}
+	if len(state.Analyses) != 1 || state.Analyses["gitlab:b:x/acme/app"] == nil {
+		t.Errorf("analyses after removal = %v", state.Analyses)
+	}
+	if state.SelectedProject != "" || state.Connection == nil || state.Connection.ID != "gitlab:b:x" {
+		t.Errorf("selection %q, current %+v after removal", state.SelectedProject, state.Connection)
+	}
+}
+
+// Repos whose connection is gone are read with GITHUB_TOKEN only on its host
+func TestEnvConnectionFallback(t *testing.T) {
+	isolateState(t)
+	live := &liveConnection{id: "github:api.github.com:alice", provider: "github"}
+	registerConnection(live)
+	envConnection = &liveConnection{id: "github:api.github.com:bot", provider: "github"}
+	registerConnection(envConnection)
+
+	tests := []struct {
+		id   string
+		want *liveConnection
+	}{
+		{"github:api.github.com:alice", live},
+		{"github:api.github.com:bot", envConnection},
+		{"github:api.github.com:gone", envConnection},
+		{"github:ghe.example.com:gone", nil},
+		{"gitlab:api.github.com:gone", nil},
+		{"local", nil},
+	}
+	for _, tt := range tests {
+		if got := connectionFor(tt.id); got != tt.want {
+			t.Errorf("connectionFor(%q) = %+v, want %+v", tt.id, got, tt.want)
+		}
+	}
+
+	removeConnectionUnsafe(envConnection.id)
+	if got := connectionFor("github:api.github.com:gone"); got != nil {
+		t.Errorf("after removing the env connection, fallback = %+v", got)
+	}
+}
+
+// A state.json written before connections were keyed is assigned to its
+// recorded account, which is not connected until it reconnects
+func TestLegacyStateMigration(t *testing.T) {
+	isolateState(t)
+	legacy := `{
+		"connection": {"isConnected": true, "username": "alice"},
+		"discoveredRepos": [{"fullName": "acme/app"}, {"fullName": "acme/lib"}],
+		"analyses": {"acme/app": {"totalCommits": 3}, "acme/app@v1": {"totalCommits": 2}, "acme/lib": {"totalCommits": 1}},
+		"selectedProject": "acme/app"
+	}`
+	if err := os.WriteFile(stateFile, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loadState()
+
+	id := connectionID("github", envGitHubAPIURL, "alice")
+	stateLock.RLock()
+	for _, repo := range state.DiscoveredRepos {
+		if repo.ConnectionID != id {
+			t.Errorf("%s assigned to %q, want %q", repo.FullName, repo.ConnectionID, id)
+		}
+	}
+	for _, key := range []string{id + "/acme/app", id + "/acme/app@v1", id + "/acme/lib"} {
+		if state.Analyses[key] == nil {
+			t.Errorf("analysis %s missing after migration: %v", key, state.Analyses)
+		}
+	}
+	if len(state.Analyses) != 3 || state.SelectedProject != id+"/acme/app" {
+		t.Errorf("analyses %v, selected %q", state.Analyses, state.SelectedProject)
+	}
+	stateLock.RUnlock()
+
+	var status struct {
+		IsConnected bool `json:"isConnected"`
+	}
+	json.Unmarshal(call(t, githubStatus, "GET", "/api/github/status", ""), &status)
+	if status.IsConnected {
+		t.Errorf("restored account reported as connected without credentials")
+	}
+	registerConnection(&liveConnection{id: id, provider: "github"})
+	json.Unmarshal(call(t, githubStatus, "GET", "/api/github/status", ""), &status)
+	if !status.IsConnected {
+		t.Errorf("reconnected account reported as disconnected")
+	}
+}
+
+// GitLab caps per_page at 100, so longer commit listings must be paged, and
+// its diffs carry no file headers, so "--- foo" is a removed line
+func TestGitLabCommitsAndDiffStats(t *testing.T) {
+	const total = 250
+	maxPerPage := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/repository/commits"):
+			perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if perPage > maxPerPage {
+				maxPerPage = perPage
+			}
+			if perPage > 100 {
+				perPage = 100
+			}
+			var commits []string
+			for i := (page - 1) * perPage; i < page*perPage && i < total; i++ {
+				commits = append(commits, fmt.Sprintf(`{"id":"c%d"}`, i))
+			}
+			w.Write([]byte("[" + strings.Join(commits, ",") + "]"))
+		case strings.HasSuffix(r.URL.Path, "/repository/commits/abc/diff"):
+			w.Write([]byte(`[{"new_path":"schema.sql","diff":"@@ -1,2 +1,2 @@\n--- foo\n+++ bar\n keep\n"}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := NewGitLabClient(server.URL, "secret")
+
+	tests := []struct {
+		limit, want int
+	}{
+		{5, 5},
+		{150, 150},
+		{1000, total},
+	}
+	for _, tt := range tests {
+		commits, err := client.GetCommits(context.Background(), "acme", "app", tt.limit)
+		if err != nil {
+			t.Fatalf("GetCommits(%d): %v", tt.limit, err)
+		}
+		if len(commits) != tt.want {
+			t.Errorf("GetCommits(%d) returned %d commits, want %d", tt.limit, len(commits), tt.want)
+		}
+	}
+	if maxPerPage > 100 {
+		t.Errorf("requested per_page=%d, GitLab allows at most 100", maxPerPage)
+	}
+
+	stats, err := client.GetCommitFileStats(context.Background(), "acme", "app", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Additions != 1 || stats[0].Deletions != 1 {
+		t.Errorf("GetCommitFileStats = %+v, want one addition and one deletion", stats)
+	}
+}
+
+// A subgroup project keeps its whole namespace as owner, and is addressed by
+// its full path in a single escaped segment
+func TestGitLabSubgroupProjects(t *testing.T) {
+	project := `{"id":7,"path":"api","path_with_namespace":"acme/platform/api","default_branch":"main","namespace":{"full_path":"acme/platform"}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.EscapedPath() {
+		case "/api/v4/groups/acme%2Fplatform/projects":
+			w.Write([]byte("[" + project + "]"))
+		case "/api/v4/projects/acme%2Fplatform%2Fapi":
+			w.Write([]byte(project))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := NewGitLabClient(server.URL, "secret")
+
+	repos, err := client.ListTeamRepos(context.Background(), "acme", "platform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].FullName != "acme/platform/api" || repos[0].Owner.Login != "acme/platform" {
+		t.Fatalf("ListTeamRepos = %+v", repos)
+	}
+
+	owner, name, ok := splitFullName(repos[0].FullName)
+	if !ok || owner != "acme/platform" || name != "api" {
+		t.Fatalf("splitFullName(%q) = %q, %q, %v", repos[0].FullName, owner, name, ok)
+	}
+	repo, err := client.GetRepository(context.Background(), owner, name)
+	if err != nil || repo.DefaultBranch != "main" {
+		t.Errorf("GetRepository(%q, %q) = %+v, %v", owner, name, repo, err)
+	}
+}
+
+func TestSubmoduleRepoName(t *testing.T) {
+	tests := []struct {
+		url, superproject, want string
+	}{
+		{"https://github.com/acme/lib.git", "acme/app", "acme/lib"},
+		{"git@gitlab.example.com:group/sub/proj.git", "acme/app", "group/sub/proj"},
+		{"https://gitlab.example.com/group/sub/proj/", "acme/app", "group/sub/proj"},
+		{"../lib.git", "acme/app", "acme/lib"},
+		{"../lib", "group/sub/app", "group/sub/lib"},
+		{"../../other/lib", "acme/app", "other/lib"},
+		{"../../../lib", "acme/app", ""},
+		{"https://github.com/lonely", "acme/app", ""},
+	}
+	for _, tt := range tests {
+		if got := submoduleRepoName(tt.url, tt.superproject); got != tt.want {
+			t.Errorf("submoduleRepoName(%q, %q) = %q, want %q", tt.url, tt.superproject, got, tt.want)
+		}
+	}
+}
+
+// A submodule is linked only when the same path is discovered on its own
+// host, not when another host lists a repo of that name
+func TestSubmoduleLinkedByHost(t *testing.T) {
+	isolateState(t)
+	gitmodules := `[submodule "lib"]
+	path = lib
+	url = ../lib.git
+[submodule "tools"]
+	path = tools
+	url = https://github.com/acme/tools.git
+[submodule "public"]
+	path = public
+	url = git@github.com:acme/public.git
+`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/repos/acme/app/contents/.gitmodules" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"encoding":"base64","content":"` + base64.StdEncoding.EncodeToString([]byte(gitmodules)) + `"}`))
+	}))
+	defer server.Close()
+
+	ghe := connectionID("github", server.URL, "alice")
+	stateLock.Lock()
+	state.DiscoveredRepos = []DiscoveredRepo{
+		{FullName: "acme/lib", ConnectionID: ghe},
+		{FullName: "acme/tools", ConnectionID: ghe},
+		{FullName: "acme/public", ConnectionID: "github:api.github.com:alice"},
+	}
+	stateLock.Unlock()
+
+	tree := &GitHubTreeResponse{Tree: []GitHubTreeNode{
+		{Path: ".gitmodules", Type: "blob"},
+		{Path: "lib", Type: "commit", SHA: "1"},
+		{Path: "tools", Type: "commit", SHA: "2"},
+		{Path: "public", Type: "commit", SHA: "3"},
+	}}
+	submodules, _ := detectSubmodules(context.Background(), NewGitHubClient(server.URL, "secret"), "acme", "app", tree)
+
+	want := map[string]bool{"lib": true, "tools": false, "public": true}
+	for _, sub := range submodules {
+		if sub.Linked != want[sub.Path] {
+			t.Errorf("%s (%s at %s) linked = %v, want %v", sub.Path, sub.FullName, sub.URL, sub.Linked, want[sub.Path])
+		}
+	}
+	if len(submodules) != len(want) {
+		t.Errorf("found %d submodules, want %d", len(submodules), len(want))
+	}
+}
+
+// The deep analysis estimate follows the window's commit limit; PRs are
+// bounded by it too, and Full History counts as maxWindowCommits
+func TestDeepAnalysisCost(t *testing.T) {
+	// Base, import graph and issues: 30 + 100 + (10 + 50)
+	const fixed = 190
+	tests := []struct {
+		window AnalysisWindow
+		want   int
+	}{
+		{defaultAnalysisWindow, fixed + (2 + 200) + (1 + 3*100)},
+		{AnalysisWindow{MaxCommits: 50}, fixed + (1 + 50) + (1 + 3*50)},
+		{AnalysisWindow{Days: 30}, fixed + (10 + 1000) + (1 + 3*100)},
+		{AnalysisWindow{MaxCommits: 5000}, fixed + (10 + 1000) + (1 + 3*100)},
+	}
+	for _, tt := range tests {
+		if got := deepAnalysisCost(tt.window); got != tt.want {
+			t.Errorf("deepAnalysisCost(%+v) = %d, want %d", tt.window, got, tt.want)
+		}
+	}
+}
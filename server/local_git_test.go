@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixtureRepo builds root/acme/app as a git repository with a small history:
+// core is edited by two commits, api imports core, and README changes once.
+func fixtureRepo(t *testing.T) (root, dir string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root = t.TempDir()
+	dir = filepath.Join(root, "acme", "app")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	when := time.Now().AddDate(0, 0, -10)
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		stamp := when.Format(time.RFC3339)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Ada", "GIT_AUTHOR_EMAIL=ada@example.com",
+			"GIT_COMMITTER_NAME=Ada", "GIT_COMMITTER_EMAIL=ada@example.com",
+			"GIT_AUTHOR_DATE="+stamp, "GIT_COMMITTER_DATE="+stamp,
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_SYSTEM=/dev/null")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit := func(message string) {
+		t.Helper()
+		run("add", "-A")
+		run("commit", "-q", "-m", message)
+		when = when.Add(24 * time.Hour)
+	}
+
+	run("init", "-q", "-b", "main")
+	write("go.mod", "module example.com/app\n\ngo 1.21\n")
+	write("core/core.go", "package core\n\nfunc Run() {}\n")
+	write("README.md", "# app\n")
+	commit("Initial commit")
+
+	write("api/api.go", "package api\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/app/core\"\n)\n\nfunc Serve() { fmt.Println(); core.Run() }\n")
+	commit("Add api")
+
+	write("core/core.go", "package core\n\nfunc Run() { println(\"run\") }\n")
+	commit("fix: core crash on start")
+
+	write("README.md", "# app\n\nUsage.\n")
+	commit("docs: usage")
+	return root, dir
+}
+
+func TestLocalGitClientReadsFixtureRepo(t *testing.T) {
+	root, _ := fixtureRepo(t)
+	client := NewLocalGitClient(root)
+	ctx := context.Background()
+
+	repos, err := client.ListRepos(ctx)
+	if err != nil || len(repos) != 1 || repos[0].FullName != "acme/app" {
+		t.Fatalf("ListRepos = %+v, %v; want acme/app", repos, err)
+	}
+	if repos[0].DefaultBranch != "main" {
+		t.Errorf("DefaultBranch = %q, want main", repos[0].DefaultBranch)
+	}
+
+	commits, err := client.ListCommits(ctx, "acme", "app", CommitQuery{})
+	if err != nil || len(commits) != 4 {
+		t.Fatalf("ListCommits = %d commits, %v; want 4", len(commits), err)
+	}
+	if commits[0].Commit.Message != "docs: usage" {
+		t.Errorf("newest commit = %q, want docs: usage", commits[0].Commit.Message)
+	}
+
+	stats, err := client.GetCommitFileStats(ctx, "acme", "app", commits[1].SHA)
+	if err != nil || len(stats) != 1 || stats[0].Filename != "core/core.go" || stats[0].Status != "modified" {
+		t.Fatalf("GetCommitFileStats = %+v, %v; want core/core.go modified", stats, err)
+	}
+
+	content, err := client.GetFileContent(ctx, "acme", "app", "README.md")
+	if err != nil || !strings.Contains(string(content), "Usage.") {
+		t.Errorf("GetFileContent(README.md) = %q, %v", content, err)
+	}
+	if content, err := client.GetFileContent(ctx, "acme", "app", "missing.txt"); err != nil || content != nil {
+		t.Errorf("GetFileContent(missing) = %q, %v; want nil, nil", content, err)
+	}
+}
+
+func TestLocalGitClientDetachedHead(t *testing.T) {
+	root, dir := fixtureRepo(t)
+	cmd := exec.Command("git", "checkout", "-q", "--detach", "HEAD~1")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git checkout: %v\n%s", err, out)
+	}
+
+	client := NewLocalGitClient(root)
+	listing, err := client.GetRepository(context.Background(), "acme", "app")
+	if err != nil {
+		t.Fatalf("GetRepository on detached HEAD: %v", err)
+	}
+	if len(listing.DefaultBranch) != 40 {
+		t.Fatalf("DefaultBranch = %q, want the detached commit SHA", listing.DefaultBranch)
+	}
+	if _, err := client.GetFileTree(context.Background(), "acme", "app", listing.DefaultBranch); err != nil {
+		t.Errorf("GetFileTree at detached commit: %v", err)
+	}
+}
+
+func TestAnalyzersOnFixtureRepo(t *testing.T) {
+	root, _ := fixtureRepo(t)
+	registryLookups = false
+	defer func() { registryLookups = true }()
+
+	client := NewLocalGitClient(root)
+	ctx := context.Background()
+	window := AnalysisWindow{Days: 365, MaxCommits: 50}
+
+	analysis, err := analyzeRepository(ctx, client, "acme", "app", &AnalysisRef{Name: "main", IsDefault: true}, window)
+	if err != nil {
+		t.Fatalf("analyzeRepository: %v", err)
+	}
+	if analysis.FileCount != 4 {
+		t.Errorf("FileCount = %d, want 4", analysis.FileCount)
+	}
+	if analysis.ContributorCount != 1 {
+		t.Errorf("ContributorCount = %d, want 1", analysis.ContributorCount)
+	}
+
+	concentration := analyzeConcentration(ctx, client, "acme", "app", window)
+	if !concentration.Available || concentration.TotalCommitsAnalyzed != 4 {
+		t.Fatalf("concentration = %+v; want 4 commits analyzed", concentration)
+	}
+	touches := make(map[string]int)
+	for _, hotspot := range concentration.Hotspots {
+		touches[hotspot.Path] = hotspot.CommitCount
+	}
+	if touches["core/core.go"] != 2 || touches["README.md"] != 2 || touches["api/api.go"] != 1 {
+		t.Errorf("hotspot touches = %v", touches)
+	}
+
+	tree, err := client.GetFileTree(ctx, "acme", "app", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph := buildImportGraph(ctx, client, "acme", "app", tree, nil)
+	topology := analyzeTopology(tree, nil, graph)
+	if topology.EdgeSource != "imports" {
+		t.Errorf("EdgeSource = %q, want imports", topology.EdgeSource)
+	}
+	found := false
+	for _, edge := range topology.Edges {
+		if edge.Source == "api" && edge.Target == "core" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("topology edges = %+v; want api -> core", topology.Edges)
+	}
+
+	deps := analyzeDependencies(ctx, client, "acme", "app", tree, concentration)
+	for _, edge := range deps.Edges {
+		if edge.Target == "fmt" {
+			t.Errorf("standard library import fmt became a dependency")
+		}
+	}
+}
+
+// memorySource serves file contents from a map; the import resolver reads
+// nothing else
+type memorySource struct {
+	RepoDataSource
+	files map[string]string
+}
+
+func (s memorySource) GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error) {
+	content, ok := s.files[path]
+	if !ok {
+		return nil, nil
+	}
+	return []byte(content), nil
+}
+
+// wantImport is an import of file as written, and how it should resolve
+type wantImport struct {
+	file, spec                 string
+	kind, target, pkg, version string
+}
+
+// checkImports extracts and resolves the imports of every source file in
+// files, and checks each of want against the import of its file and spec
+func checkImports(t *testing.T, files map[string]string, want []wantImport) {
+	t.Helper()
+	tree := &GitHubTreeResponse{}
+	for path := range files {
+		tree.Tree = append(tree.Tree, GitHubTreeNode{Path: path, Type: "blob"})
+	}
+	resolver := newImportResolver(context.Background(), memorySource{files: files}, "acme", "app", tree)
+
+	got := make(map[string]SourceImport)
+	for path, content := range files {
+		if !isImportSource(path) {
+			continue
+		}
+		for _, imp := range extractImports(path, []byte(content)) {
+			resolver.resolve(&imp)
+			got[imp.File+" "+imp.Spec] = imp
+		}
+	}
+	for _, w := range want {
+		imp, ok := got[w.file+" "+w.spec]
+		if !ok {
+			t.Errorf("%s: no import of %q", w.file, w.spec)
+			continue
+		}
+		if imp.Kind != w.kind || imp.Target != w.target || imp.Package != w.pkg || imp.Version != w.version {
+			t.Errorf("%s: %q resolved to %s %q package %q %q, want %s %q package %q %q",
+				w.file, w.spec, imp.Kind, imp.Target, imp.Package, imp.Version, w.kind, w.target, w.pkg, w.version)
+		}
+	}
+}
+
+func TestResolveGoImports(t *testing.T) {
+	files := map[string]string{
+		"go.mod":                  "module example.com/app\n\ngo 1.21\n\nrequire (\n\tgithub.com/pkg/errors v0.9.1\n\tgolang.org/x/sync v0.5.0 // indirect\n)\n",
+		"internal/store/store.go": "package store\n",
+		"cmd/app/main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/app/internal/store"
+	"github.com/pkg/errors"
+	group "golang.org/x/sync/errgroup"
+	"github.com/unlisted/mod"
+)
+`,
+	}
+	checkImports(t, files, []wantImport{
+		{"cmd/app/main.go", "fmt", "stdlib", "", "", ""},
+		{"cmd/app/main.go", "example.com/app/internal/store", "internal", "internal/store/", "", ""},
+		{"cmd/app/main.go", "github.com/pkg/errors", "external", "", "github.com/pkg/errors", "v0.9.1"},
+		{"cmd/app/main.go", "golang.org/x/sync/errgroup", "external", "", "golang.org/x/sync", "v0.5.0"},
+		{"cmd/app/main.go", "github.com/unlisted/mod", "external", "", "github.com/unlisted/mod", ""},
+	})
+}
+
+func TestParseGoMod(t *testing.T) {
+	tests := []struct {
+		content, module string
+		requires        map[string]string
+	}{
+		{"module example.com/app\n", "example.com/app", map[string]string{}},
+		{"module \"example.com/quoted\"\nrequire github.com/pkg/errors v0.9.1\n", "example.com/quoted", map[string]string{"github.com/pkg/errors": "v0.9.1"}},
+		{"module m\n\nrequire (\n\ta.dev/x v1.0.0 // indirect\n\tb.dev/y v2.1.0\n)\n", "m", map[string]string{"a.dev/x": "v1.0.0", "b.dev/y": "v2.1.0"}},
+	}
+	for _, tt := range tests {
+		module, requires := parseGoMod([]byte(tt.content))
+		if module != tt.module || len(requires) != len(tt.requires) {
+			t.Errorf("parseGoMod(%q) = %q, %v", tt.content, module, requires)
+			continue
+		}
+		for path, version := range tt.requires {
+			if requires[path] != version {
+				t.Errorf("parseGoMod(%q): %s = %q, want %q", tt.content, path, requires[path], version)
+			}
+		}
+	}
+}
+
+func TestResolveJSImports(t *testing.T) {
+	files := map[string]string{
+		"package.json":                 `{"name":"web","dependencies":{"react":"^18.2.0","@scope/ui":"1.0.0"},"workspaces":["packages/*"]}`,
+		"packages/shared/package.json": `{"name":"@acme/shared","version":"0.1.0"}`,
+		"packages/shared/index.ts":     "export const shared = 1\n",
+		"tsconfig.json": `{
+  // Aliases resolve against baseUrl
+  "compilerOptions": {"baseUrl": ".", "paths": {"@/*": ["src/*"],},},
+}
+`,
+		"src/components/Button.tsx": "export const Button = 1\n",
+		"src/utils/index.ts":        "export const helper = 1\n",
+		"src/styles.css":            "",
+		"src/lazy.ts":               "",
+		"src/app.tsx": `import React from 'react';
+import { Button } from '@/components/Button';
+import './styles.css';
+import { readFile } from 'node:fs';
+export { helper } from './utils';
+import {
+  Card,
+} from '@scope/ui/card';
+import { shared } from '@acme/shared';
+const lazy = () => import('./lazy.js');
+// import gone from 'commented-out';
+`,
+	}
+	checkImports(t, files, []wantImport{
+		{"src/app.tsx", "react", "external", "", "react", "^18.2.0"},
+		{"src/app.tsx", "@/components/Button", "internal", "src/components/Button.tsx", "", ""},
+		{"src/app.tsx", "./styles.css", "internal", "src/styles.css", "", ""},
+		{"src/app.tsx", "node:fs", "stdlib", "", "", ""},
+		{"src/app.tsx", "./utils", "internal", "src/utils/index.ts", "", ""},
+		{"src/app.tsx", "@scope/ui/card", "external", "", "@scope/ui", "1.0.0"},
+		{"src/app.tsx", "@acme/shared", "internal", "packages/shared/", "", ""},
+		{"src/app.tsx", "./lazy.js", "internal", "src/lazy.ts", "", ""},
+	})
+	for _, imp := range extractImports("src/app.tsx", []byte(files["src/app.tsx"])) {
+		if imp.Spec == "commented-out" {
+			t.Errorf("commented-out import extracted: %+v", imp)
+		}
+	}
+}
+
+func TestJSPackageName(t *testing.T) {
+	tests := []struct{ spec, want string }{
+		{"react", "react"},
+		{"react-dom/client", "react-dom"},
+		{"@scope/ui", "@scope/ui"},
+		{"@scope/ui/card/index.js", "@scope/ui"},
+	}
+	for _, tt := range tests {
+		if got := jsPackageName(tt.spec); got != tt.want {
+			t.Errorf("jsPackageName(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestResolvePythonImports(t *testing.T) {
+	files := map[string]string{
+		"pyproject.toml":          "[project]\nname = \"svc\"\ndependencies = [\"requests>=2.0\", \"PyYAML==6.0\"]\n",
+		"requirements-dev.txt":    "pytest==8.1.1  # tests\n",
+		"src/svc/__init__.py":     "",
+		"src/svc/models.py":       "",
+		"src/svc/api/__init__.py": "",
+		"src/svc/api/helpers.py":  "",
+		"src/svc/api/views.py": `import os
+import requests
+import yaml
+from svc import models
+from .. import models as m2
+from .helpers import thing
+import svc.api.views
+# import commented
+`,
+		"tests/test_views.py": "import pytest\nfrom svc.api import views\n",
+	}
+	checkImports(t, files, []wantImport{
+		{"src/svc/api/views.py", "os", "stdlib", "", "", ""},
+		{"src/svc/api/views.py", "requests", "external", "", "requests", "2.0"},
+		{"src/svc/api/views.py", "yaml", "external", "", "PyYAML", "6.0"},
+		{"src/svc/api/views.py", "svc.models", "internal", "src/svc/models.py", "", ""},
+		{"src/svc/api/views.py", "..models", "internal", "src/svc/models.py", "", ""},
+		{"src/svc/api/views.py", ".helpers.thing", "internal", "src/svc/api/helpers.py", "", ""},
+		{"src/svc/api/views.py", "svc.api.views", "internal", "src/svc/api/views.py", "", ""},
+		{"tests/test_views.py", "pytest", "external", "", "pytest", "8.1.1"},
+		{"tests/test_views.py", "svc.api.views", "internal", "src/svc/api/views.py", "", ""},
+	})
+}
+
+func TestParseRequirement(t *testing.T) {
+	tests := []struct {
+		spec          string
+		name, version string
+		ok            bool
+	}{
+		{"requests", "requests", "", true},
+		{"requests[socks]>=2.31", "requests", "2.31", true},
+		{"Django ~= 4.2 ; python_version >= '3.8'", "Django", "4.2", true},
+		{"zope.interface==6.0", "zope.interface", "6.0", true},
+		{"-r base.txt", "", "", false},
+		{"# comment", "", "", false},
+	}
+	for _, tt := range tests {
+		req, ok := parseRequirement(tt.spec)
+		if ok != tt.ok || req.Name != tt.name || req.Version != tt.version {
+			t.Errorf("parseRequirement(%q) = %+v, %v", tt.spec, req, ok)
+		}
+	}
+	if got := normalizePyName("Zope_Interface.Ext"); got != "zope-interface-ext" {
+		t.Errorf("normalizePyName = %q", got)
+	}
+}
+
+func TestResolveOtherLanguageImports(t *testing.T) {
+	files := map[string]string{
+		// Java and Kotlin
+		"src/main/java/com/acme/app/Main.java":         "package com.acme.app;\n\nimport com.acme.app.util.Strings;\nimport java.util.List;\nimport org.slf4j.Logger;\n",
+		"src/main/java/com/acme/app/util/Strings.java": "package com.acme.app.util;\n",
+		"src/main/kotlin/com/acme/app/Service.kt":      "package com.acme.app\n\nimport com.acme.app.util.Strings\nimport kotlin.collections.List\n",
+		// Rust
+		"Cargo.toml":    "[package]\nname = \"engine\"\n\n[dependencies]\nserde = \"1.0\"\ntokio = { version = \"1.35\", features = [\"full\"] }\n",
+		"src/main.rs":   "mod parser;\nuse crate::parser::parse;\nuse std::collections::HashMap;\nuse serde::{Deserialize, Serialize};\nextern crate tokio;\n",
+		"src/parser.rs": "pub fn parse() {}\n",
+		// C#
+		"App/App.csproj":         `<Project><PropertyGroup><RootNamespace>Acme.App</RootNamespace></PropertyGroup><ItemGroup><PackageReference Include="Newtonsoft.Json" Version="13.0.1" /></ItemGroup></Project>`,
+		"App/Program.cs":         "using System;\nusing Acme.App.Services;\nusing Newtonsoft.Json;\n\nnamespace Acme.App;\n",
+		"App/Services/Worker.cs": "namespace Acme.App.Services;\n",
+		// Ruby
+		"Gemfile":           "source 'https://rubygems.org'\ngem 'rails', '~> 7.0'\n",
+		"lib/app.rb":        "require 'json'\nrequire 'rails'\nrequire_relative 'app/helper'\nrequire 'app/other'\n",
+		"lib/app/helper.rb": "",
+		"lib/app/other.rb":  "",
+		// PHP
+		"composer.json":          `{"require":{"monolog/monolog":"^3.0"},"autoload":{"psr-4":{"Acme\\":"web/"}}}`,
+		"web/Controller.php":     "<?php\nnamespace Acme;\n\nuse Acme\\Service\\Mailer;\nuse Monolog\\Logger;\nrequire_once __DIR__ . '/bootstrap.php';\n",
+		"web/Service/Mailer.php": "<?php\nnamespace Acme\\Service;\n",
+		"web/bootstrap.php":      "<?php\n",
+	}
+	util := "src/main/java/com/acme/app/util/Strings.java"
+	checkImports(t, files, []wantImport{
+		{"src/main/java/com/acme/app/Main.java", "com.acme.app.util.Strings", "internal", util, "", ""},
+		{"src/main/java/com/acme/app/Main.java", "java.util.List", "stdlib", "", "", ""},
+		{"src/main/java/com/acme/app/Main.java", "org.slf4j.Logger", "external", "", "org.slf4j", ""},
+		{"src/main/kotlin/com/acme/app/Service.kt", "com.acme.app.util.Strings", "internal", util, "", ""},
+		{"src/main/kotlin/com/acme/app/Service.kt", "kotlin.collections.List", "stdlib", "", "", ""},
+
+		{"src/main.rs", "self::parser", "internal", "src/parser.rs", "", ""},
+		{"src/main.rs", "crate::parser::parse", "internal", "src/parser.rs", "", ""},
+		{"src/main.rs", "std::collections::HashMap", "stdlib", "", "", ""},
+		{"src/main.rs", "serde::Deserialize", "external", "", "serde", "1.0"},
+		{"src/main.rs", "serde::Serialize", "external", "", "serde", "1.0"},
+		{"src/main.rs", "tokio", "external", "", "tokio", "1.35"},
+
+		{"App/Program.cs", "System", "stdlib", "", "", ""},
+		{"App/Program.cs", "Acme.App.Services", "internal", "App/Services/", "", ""},
+		{"App/Program.cs", "Newtonsoft.Json", "external", "", "Newtonsoft.Json", "13.0.1"},
+
+		{"lib/app.rb", "json", "stdlib", "", "", ""},
+		{"lib/app.rb", "rails", "external", "", "rails", "7.0"},
+		{"lib/app.rb", "./app/helper", "internal", "lib/app/helper.rb", "", ""},
+		{"lib/app.rb", "app/other", "internal", "lib/app/other.rb", "", ""},
+
+		{"web/Controller.php", `Acme\Service\Mailer`, "internal", "web/Service/Mailer.php", "", ""},
+		{"web/Controller.php", `Monolog\Logger`, "external", "", "monolog/monolog", "^3.0"},
+		{"web/Controller.php", "./bootstrap.php", "internal", "web/bootstrap.php", "", ""},
+	})
+}
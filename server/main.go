@@ -1,21 +1,39 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"go/parser"
+	"go/token"
+	"hash/fnv"
 	"io"
 	"log"
 	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/go-pdf/fpdf"
 )
@@ -42,10 +60,55 @@ type GitHubRepoListing struct {
 	StargazersCount int       `json:"stargazers_count"`
 	ForksCount      int       `json:"forks_count"`
 	Private         bool      `json:"private"`
+	Archived        bool      `json:"archived"`
+	Fork            bool      `json:"fork"`
+	Topics          []string  `json:"topics"`
 	UpdatedAt       time.Time `json:"updated_at"`
 	PushedAt        time.Time `json:"pushed_at"`
 }
 
+type GitHubPullRequest struct {
+	Number       int         `json:"number"`
+	Title        string      `json:"title"`
+	State        string      `json:"state"`
+	Draft        bool        `json:"draft"`
+	User         *GitHubUser `json:"user"`
+	MergedBy     *GitHubUser `json:"merged_by"` // Only present on the single-PR endpoint
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	MergedAt     *time.Time  `json:"merged_at"`
+	ClosedAt     *time.Time  `json:"closed_at"`
+	Additions    int         `json:"additions"`
+	Deletions    int         `json:"deletions"`
+	ChangedFiles int         `json:"changed_files"`
+	Base         struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+type GitHubReview struct {
+	User        *GitHubUser `json:"user"`
+	State       string      `json:"state"` // APPROVED | CHANGES_REQUESTED | COMMENTED | DISMISSED | PENDING
+	SubmittedAt time.Time   `json:"submitted_at"`
+}
+
+type GitHubReviewComment struct {
+	User      *GitHubUser `json:"user"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type GitHubIssue struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	State  string `json:"state"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ClosedAt    *time.Time      `json:"closed_at"`
+	PullRequest json.RawMessage `json:"pull_request,omitempty"` // Set when the "issue" is a PR
+}
+
 type GitHubCommit struct {
 	SHA    string `json:"sha"`
 	Commit struct {
@@ -76,6 +139,8 @@ type GitHubTreeResponse struct {
 	SHA       string           `json:"sha"`
 	Tree      []GitHubTreeNode `json:"tree"`
 	Truncated bool             `json:"truncated"`
+	// Fraction of directories listed when a truncated tree was walked; see treeCompleteness
+	Completeness float64 `json:"completeness,omitempty"`
 }
 
 type GitHubTreeNode struct {
@@ -83,6 +148,26 @@ type GitHubTreeNode struct {
 	Mode string `json:"mode"`
 	Type string `json:"type"`
 	Size int    `json:"size"`
+	SHA  string `json:"sha,omitempty"`
+}
+
+// treeNodes returns the entries of tree, or nil when the tree could not be fetched
+func treeNodes(tree *GitHubTreeResponse) []GitHubTreeNode {
+	if tree == nil {
+		return nil
+	}
+	return tree.Tree
+}
+
+// treeCompleteness returns how much of the repository tree was retrieved (0-1)
+func treeCompleteness(tree *GitHubTreeResponse) float64 {
+	if tree == nil {
+		return 0
+	}
+	if !tree.Truncated {
+		return 1
+	}
+	return tree.Completeness
 }
 
 // GitHub Stats API types
@@ -101,6 +186,7 @@ type CodeFrequencyWeek struct {
 // ==================== APPLICATION TYPES ====================
 
 type GitHubConnection struct {
+	ID           string    `json:"id"` // Registry key, see connectionID
 	IsConnected  bool      `json:"isConnected"`
 	Username     string    `json:"username"`
 	AvatarURL    string    `json:"avatarUrl"`
@@ -108,6 +194,25 @@ type GitHubConnection struct {
 	Organization string    `json:"organization"`
 	ConnectedAt  time.Time `json:"connectedAt"`
 	RepoCount    int       `json:"repoCount"`
+	Provider     string    `json:"provider"`          // "github", "gitlab" or "local"
+	BaseURL      string    `json:"baseUrl,omitempty"` // Self-managed instance URL, empty for the public host
+
+	Discovery DiscoveryScope `json:"discovery"` // Which repos the connection lists
+}
+
+// DiscoveryScope picks where a connection's repos come from and filters them.
+// The zero value lists every repo the account can see, as before scopes.
+type DiscoveryScope struct {
+	Organization string   `json:"organization,omitempty"` // List the org's (GitLab: group's) repos instead of the account's
+	Team         string   `json:"team,omitempty"`         // Team slug within Organization; lists only the team's repos
+	Topics       []string `json:"topics,omitempty"`       // Keep repos tagged with every one of these topics
+
+	ExcludeArchived  bool     `json:"excludeArchived,omitempty"`
+	ExcludeForks     bool     `json:"excludeForks,omitempty"`
+	Languages        []string `json:"languages,omitempty"`        // Keep only these primary languages
+	ExcludeLanguages []string `json:"excludeLanguages,omitempty"` // Drop these primary languages
+	Include          []string `json:"include,omitempty"`          // Glob patterns on name or owner/name; a repo must match one
+	Exclude          []string `json:"exclude,omitempty"`          // Glob patterns on name or owner/name; matching repos are dropped
 }
 
 type DiscoveredRepo struct {
@@ -123,9 +228,11 @@ type DiscoveredRepo struct {
 	Private       bool      `json:"private"`
 	UpdatedAt     time.Time `json:"updatedAt"`
 	AnalysisState string    `json:"analysisState"` // "none", "analyzing", "ready"
+	ConnectionID  string    `json:"connectionId"`  // Connection the repo was discovered through
 }
 
 type RepoAnalysis struct {
+	Ref               *AnalysisRef                 `json:"ref,omitempty"` // Revision analyzed
 	FetchedAt         time.Time                    `json:"fetchedAt"`
 	RepoAgeMonths     int                          `json:"repoAgeMonths"`
 	DaysSinceLastPush int                          `json:"daysSinceLastPush"`
@@ -154,6 +261,7 @@ type RepoAnalysis struct {
 	DocDrift          *DocDriftAnalysis            `json:"docDrift,omitempty"`
 	IntentAnalysis    *IntentDistribution          `json:"intentAnalysis,omitempty"`
 	StructuralDepth   *StructuralDepthAnalysis     `json:"structuralDepth,omitempty"`
+	Submodules        []Submodule                  `json:"submodules,omitempty"`
 	Volatility        *ActivityVolatility          `json:"volatility,omitempty"`
 	TestSurface       *TestSurfaceAnalysis         `json:"testSurface,omitempty"`
 	SecurityAnalysis  *SecurityConsistencyAnalysis `json:"securityAnalysis,omitempty"`
@@ -320,14 +428,17 @@ type RepositoryAnalysisCache struct {
 // ==================== SINGLE ANALYSIS LIFECYCLE ====================
 
 // RepositoryAnalysisState holds ALL precomputed analysis for a repository
-// This is the SINGLE SOURCE OF TRUTH - no computation in request handlers
+// This is the SINGLE SOURCE OF TRUTH - every analysis run for the project reads
+// through its run snapshot, so raw data is fetched once and shared by sections
 type RepositoryAnalysisState struct {
 	ProjectKey     string    `json:"projectKey"`
 	AnalyzedAt     time.Time `json:"analyzedAt"`
 	AnalysisTimeMs int64     `json:"analysisTimeMs"`
 	Status         string    `json:"status"` // pending, analyzing, ready, failed
 
-	// Raw data (fetched ONCE from GitHub)
+	snapshot *runSnapshot // Serves raw data to runs; see analysisRunSnapshot
+
+	// Raw data (fetched ONCE from GitHub), copied from the snapshot when a full analysis completes
 	RawCommits      []GitHubCommit      `json:"-"` // Not serialized, large
 	RawTree         []GitHubTreeNode    `json:"-"`
 	RawContributors []GitHubContributor `json:"-"`
@@ -774,6 +885,7 @@ type ImpactUnit struct {
 	FanIn          int      `json:"fanIn"`          // Incoming edges (dependents)
 	FanOut         int      `json:"fanOut"`         // Outgoing edges (dependencies)
 	IsCyclic       bool     `json:"isCyclic"`       // Part of circular dependency
+	External       bool     `json:"external"`       // Submodule vendored from another repository
 }
 
 type ImpactAnalysis struct {
@@ -787,27 +899,52 @@ type ImpactAnalysis struct {
 	LowCount      int                 `json:"lowCount"`      // fragility < 25
 	MostFragile   string              `json:"mostFragile,omitempty"`
 	LargestBlast  string              `json:"largestBlast,omitempty"`
+	EdgeSource    string              `json:"edgeSource,omitempty"` // Where the topology's edges came from
 	Confidence    *AnalysisConfidence `json:"confidence,omitempty"`
 }
 
 // ==================== CHANGE CONCENTRATION TYPES ====================
 
 type ChurnFile struct {
-	Path        string  `json:"path"`
-	CommitCount int     `json:"commitCount"`
-	Percent     float64 `json:"percent"`
+	Path         string  `json:"path"`
+	CommitCount  int     `json:"commitCount"`
+	Percent      float64 `json:"percent"`      // Share of file touches
+	LinesChanged int     `json:"linesChanged"` // Additions + deletions
+	LinePercent  float64 `json:"linePercent"`  // Share of lines changed
+	FileDefects
 }
 
 type ConcentrationAnalysis struct {
-	Available            bool                `json:"available"`
-	Reason               string              `json:"reason,omitempty"`
-	Window               string              `json:"window"` // 7d, 30d, all
-	TotalCommitsAnalyzed int                 `json:"totalCommitsAnalyzed"`
-	TotalFilesTouched    int                 `json:"totalFilesTouched"`
-	ConcentrationIndex   float64             `json:"concentrationIndex"` // 0-100%
-	Hotspots             []ChurnFile         `json:"hotspots"`
-	OwnershipRisk        *BusFactorAnalysis  `json:"ownershipRisk,omitempty"`
-	Confidence           *AnalysisConfidence `json:"confidence,omitempty"`
+	Available              bool                `json:"available"`
+	Reason                 string              `json:"reason,omitempty"`
+	Window                 string              `json:"window"` // AnalysisWindow label, e.g. "Last 90 Days"
+	TotalCommitsAnalyzed   int                 `json:"totalCommitsAnalyzed"`
+	TotalFilesTouched      int                 `json:"totalFilesTouched"`
+	TotalLinesChanged      int                 `json:"totalLinesChanged"`
+	ConcentrationIndex     float64             `json:"concentrationIndex"`     // 0-100%, by touches
+	LineConcentrationIndex float64             `json:"lineConcentrationIndex"` // 0-100%, by lines changed
+	Hotspots               []ChurnFile         `json:"hotspots"`               // Ranked by touches
+	LineHotspots           []ChurnFile         `json:"lineHotspots"`           // Ranked by lines changed
+	OwnershipRisk          *BusFactorAnalysis  `json:"ownershipRisk,omitempty"`
+	Confidence             *AnalysisConfidence `json:"confidence,omitempty"`
+	Defects                *DefectSummary      `json:"defects,omitempty"`
+}
+
+// FileDefects attributes bug issues closed by commits ("fixes #123") to the files those commits touched
+type FileDefects struct {
+	DefectCount    int     `json:"defectCount"`    // Distinct bug issues fixed by commits touching the file
+	DefectDensity  float64 `json:"defectDensity"`  // Bug issues per commit touching the file
+	MeanHoursToFix float64 `json:"meanHoursToFix"` // Issue opened to closed (or to the fix commit while still open)
+}
+
+type DefectSummary struct {
+	Available       bool    `json:"available"`
+	Reason          string  `json:"reason,omitempty"`
+	IssuesIngested  int     `json:"issuesIngested"`
+	BugIssuesLinked int     `json:"bugIssuesLinked"` // Distinct bug issues referenced by a closing keyword
+	FixCommits      int     `json:"fixCommits"`      // Commits closing at least one bug issue
+	MeanHoursToFix  float64 `json:"meanHoursToFix"`
+	LookupFailures  int     `json:"lookupFailures"` // Referenced issues that could not be fetched, so count as neither bug nor fix
 }
 
 // ==================== BUS FACTOR TYPES ====================
@@ -845,6 +982,45 @@ type BusFactorAnalysis struct {
 	DistributedFileCount int     `json:"distributedFileCount"`          // Files with <50% single-owner
 	DominantContributor  string  `json:"dominantContributor,omitempty"` // Who owns the most risk
 	DominantOwnership    float64 `json:"dominantOwnership"`             // Their % of critical files
+	Window               string  `json:"window"`                        // Commit history the ownership was derived from
+}
+
+// ==================== REVIEW FLOW TYPES ====================
+
+type PRSizeBucket struct {
+	Label    string  `json:"label"`    // XS | S | M | L | XL
+	MaxLines int     `json:"maxLines"` // Upper bound of additions+deletions; 0 for the open-ended bucket
+	Count    int     `json:"count"`
+	Percent  float64 `json:"percent"`
+}
+
+type ReviewerLoad struct {
+	Login       string  `json:"login"`
+	PRsReviewed int     `json:"prsReviewed"` // Distinct PRs with a review or review comment from this person
+	Reviews     int     `json:"reviews"`
+	Comments    int     `json:"comments"`
+	Share       float64 `json:"share"` // Percent of reviewed PRs this person reviewed
+}
+
+type ReviewAnalysis struct {
+	Available                bool           `json:"available"`
+	Reason                   string         `json:"reason,omitempty"`
+	PRsAnalyzed              int            `json:"prsAnalyzed"`
+	MergedCount              int            `json:"mergedCount"`
+	OpenCount                int            `json:"openCount"`
+	ReviewedCount            int            `json:"reviewedCount"`
+	MedianHoursToFirstReview float64        `json:"medianHoursToFirstReview"`
+	P90HoursToFirstReview    float64        `json:"p90HoursToFirstReview"`
+	MedianHoursToMerge       float64        `json:"medianHoursToMerge"`
+	P90HoursToMerge          float64        `json:"p90HoursToMerge"`
+	MedianPRSize             int            `json:"medianPrSize"` // Lines changed
+	SizeDistribution         []PRSizeBucket `json:"sizeDistribution"`
+	Reviewers                []ReviewerLoad `json:"reviewers"`
+	TopReviewerShare         float64        `json:"topReviewerShare"` // Percent of reviewed PRs handled by the busiest reviewer
+	SelfMergedUnreviewed     int            `json:"selfMergedUnreviewed"`
+	SelfMergedUnreviewedRate float64        `json:"selfMergedUnreviewedRate"` // Percent of merged PRs
+	Base                     string         `json:"base,omitempty"`           // Only PRs targeting this branch
+	Window                   string         `json:"window"`
 }
 
 // ==================== TEMPORAL HOTSPOT TYPES ====================
@@ -852,12 +1028,15 @@ type BusFactorAnalysis struct {
 type TemporalHotspot struct {
 	Path               string      `json:"path"`
 	CommitCount        int         `json:"commitCount"`
+	LinesChanged       int         `json:"linesChanged"`
 	FrequencyBaseline  float64     `json:"frequencyBaseline"`
 	ShortestIntervalHr float64     `json:"shortestIntervalHr"`
 	MeanIntervalHr     float64     `json:"meanIntervalHr"`
 	SeverityScore      float64     `json:"severityScore"`
-	Classification     string      `json:"classification"` // burst | drift
+	LineSeverityScore  float64     `json:"lineSeverityScore"` // Severity weighted by lines changed per touch
+	Classification     string      `json:"classification"`    // burst | drift
 	Timestamps         []time.Time `json:"timestamps"`
+	FileDefects
 }
 
 type TemporalAnalysis struct {
@@ -866,7 +1045,10 @@ type TemporalAnalysis struct {
 	BaselineFound    bool              `json:"baselineFound"`
 	MedianFrequency  float64           `json:"medianFrequency"`
 	TemporalHotspots []TemporalHotspot `json:"temporalHotspots"`
+	LineHotspots     []TemporalHotspot `json:"lineHotspots"` // Ranked by LineSeverityScore
+	Window           string            `json:"window"`
 	WindowDays       int               `json:"windowDays"`
+	Defects          *DefectSummary    `json:"defects,omitempty"`
 }
 
 type DirectoryInfo struct {
@@ -884,7 +1066,7 @@ type DependencyNode struct {
 	Version           string  `json:"version"`       // from manifest
 	LatestVersion     string  `json:"latestVersion"` // Latest available from registry
 	Volatility        float64 `json:"volatility"`    // commit frequency in manifest
-	Lag               string  `json:"lag"`           // major | minor | up-to-date | unknown
+	Lag               string  `json:"lag"`           // major | minor | up-to-date | unknown | n/a
 	RiskAmplification float64 `json:"riskAmplification"`
 	FanIn             int     `json:"fanIn"`      // Incoming edges
 	FanOut            int     `json:"fanOut"`     // Outgoing edges
@@ -958,6 +1140,8 @@ type StructuralDepthAnalysis struct {
 	Imbalances      []string    `json:"imbalances"`
 	SurfaceRatio    float64     `json:"surfaceRatio"`
 	StructureStatus string      `json:"structureStatus"` // flat, layered, over-segmented
+
+	Confidence *AnalysisConfidence `json:"confidence,omitempty"` // Scaled by tree completeness
 }
 
 type ActivityVolatility struct {
@@ -981,6 +1165,8 @@ type TestSurfaceAnalysis struct {
 	MismatchedDeps        bool     `json:"mismatchedDeps"` // true if test deps exist but no files
 	TestDependenciesFound []string `json:"testDependenciesFound"`
 	Interpretation        string   `json:"interpretation"`
+
+	Confidence *AnalysisConfidence `json:"confidence,omitempty"` // Scaled by tree completeness
 }
 
 type SecurityClaim struct {
@@ -1019,6 +1205,7 @@ type TopologyModule struct {
 	DependedBy []string `json:"dependedBy"`
 	FanOut     int      `json:"fanOut"`
 	FanIn      int      `json:"fanIn"`
+	External   bool     `json:"external,omitempty"` // A submodule: another repository vendored at a pinned commit
 }
 
 type TopologyCluster struct {
@@ -1033,7 +1220,7 @@ type TopologyCluster struct {
 type TopologyEdge struct {
 	Source string `json:"source"`
 	Target string `json:"target"`
-	Weight int    `json:"weight"`
+	Weight int    `json:"weight"` // Imports from Source resolving into Target; 1 for heuristic edges
 }
 
 type TopologyMetrics struct {
@@ -1061,23 +1248,31 @@ type DocDriftAnalysis struct {
 	TemporalOffsetDays float64  `json:"temporalOffset"` // DaysDoc - DaysCode (avg)
 	Classification     string   `json:"classification"` // "Documentation-leading", "Code-leading", "Aligned"
 	Interpretation     string   `json:"interpretation"`
+	Window             string   `json:"window"`
 }
 
 type TopologyAnalysis struct {
-	Available       bool              `json:"available"`
-	Reason          string            `json:"reason,omitempty"`
-	ProjectFullName string            `json:"projectFullName,omitempty"`
-	Modules         []TopologyModule  `json:"modules"`
-	Clusters        []TopologyCluster `json:"clusters"`
-	Edges           []TopologyEdge    `json:"edges"`
-	Metrics         TopologyMetrics   `json:"metrics"`
+	Available       bool                `json:"available"`
+	Reason          string              `json:"reason,omitempty"`
+	ProjectFullName string              `json:"projectFullName,omitempty"`
+	Modules         []TopologyModule    `json:"modules"`
+	Clusters        []TopologyCluster   `json:"clusters"`
+	Edges           []TopologyEdge      `json:"edges"`
+	Metrics         TopologyMetrics     `json:"metrics"`
+	EdgeSource      string              `json:"edgeSource,omitempty"` // "imports", or "naming-heuristic" when no source could be read
+	SourceFiles     int                 `json:"sourceFiles"`          // Source files in the tree
+	ParsedFiles     int                 `json:"parsedFiles"`          // Source files whose imports were read
+	Submodules      []Submodule         `json:"submodules,omitempty"`
+	Confidence      *AnalysisConfidence `json:"confidence,omitempty"`
 }
 
 type AppState struct {
-	Connection      *GitHubConnection        `json:"connection"`
+	Connection      *GitHubConnection        `json:"connection"`  // Most recently connected account
+	Connections     []*GitHubConnection      `json:"connections"` // Every connected account
 	DiscoveredRepos []DiscoveredRepo         `json:"discoveredRepos"`
 	Analyses        map[string]*RepoAnalysis `json:"analyses"`
 	SelectedProject string                   `json:"selectedProject"`
+	AnalysisWindow  *AnalysisWindow          `json:"analysisWindow,omitempty"` // nil means defaultAnalysisWindow
 }
 
 // ==================== ANALYSIS CACHE ====================
@@ -1105,6 +1300,7 @@ type AnalysisCache struct {
 	temporal      map[string]*CacheEntry
 	topology      map[string]*CacheEntry
 	tree          map[string]*CacheEntry
+	reviews       map[string]*CacheEntry
 }
 
 func NewAnalysisCache() *AnalysisCache {
@@ -1117,6 +1313,7 @@ func NewAnalysisCache() *AnalysisCache {
 		temporal:      make(map[string]*CacheEntry),
 		topology:      make(map[string]*CacheEntry),
 		tree:          make(map[string]*CacheEntry),
+		reviews:       make(map[string]*CacheEntry),
 	}
 }
 
@@ -1142,6 +1339,8 @@ func (ac *AnalysisCache) Get(tabName, projectKey string) (interface{}, bool) {
 		cache = ac.topology
 	case "tree":
 		cache = ac.tree
+	case "reviews":
+		cache = ac.reviews
 	default:
 		return nil, false
 	}
@@ -1176,6 +1375,8 @@ func (ac *AnalysisCache) GetWithTimestamp(tabName, projectKey string) (interface
 		cache = ac.topology
 	case "tree":
 		cache = ac.tree
+	case "reviews":
+		cache = ac.reviews
 	default:
 		return nil, time.Time{}, false
 	}
@@ -1214,9 +1415,28 @@ func (ac *AnalysisCache) Set(tabName, projectKey string, data interface{}, ttl t
 		ac.topology[projectKey] = entry
 	case "tree":
 		ac.tree[projectKey] = entry
+	case "reviews":
+		ac.reviews[projectKey] = entry
 	}
 }
 
+// InvalidateAll drops every cached result, e.g. after the analysis window changes
+func (ac *AnalysisCache) InvalidateAll() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	ac.dashboard = make(map[string]*CacheEntry)
+	ac.trajectory = make(map[string]*CacheEntry)
+	ac.impact = make(map[string]*CacheEntry)
+	ac.dependencies = make(map[string]*CacheEntry)
+	ac.concentration = make(map[string]*CacheEntry)
+	ac.temporal = make(map[string]*CacheEntry)
+	ac.topology = make(map[string]*CacheEntry)
+	ac.tree = make(map[string]*CacheEntry)
+	ac.reviews = make(map[string]*CacheEntry)
+	log.Printf("[Cache] Invalidated all caches")
+}
+
 func (ac *AnalysisCache) InvalidateProject(projectKey string) {
 	ac.mu.Lock()
 	defer ac.mu.Unlock()
@@ -1229,6 +1449,7 @@ func (ac *AnalysisCache) InvalidateProject(projectKey string) {
 	delete(ac.temporal, projectKey)
 	delete(ac.topology, projectKey)
 	delete(ac.tree, projectKey)
+	delete(ac.reviews, projectKey)
 	log.Printf("[Cache] Invalidated all caches for project: %s", projectKey)
 }
 
@@ -1238,702 +1459,4556 @@ var (
 	state         AppState
 	stateLock     sync.RWMutex
 	stateFile     = "state.json"
-	githubToken   string // In-memory only, never persisted
+	localRepoRoot string // LOCAL_REPOS_DIR: directory of mirrored clones, read as the "local" connection
 	analysisCache = NewAnalysisCache()
+
+	envGitHubAPIURL string // GITHUB_API_URL: default API root for GitHub connections
 )
 
-// ==================== GITHUB API CLIENT ====================
+// ==================== REPOSITORY DATA SOURCE ====================
+
+// CommitQuery filters a commit listing. Zero values leave a filter unset.
+type CommitQuery struct {
+	Since  time.Time
+	Until  time.Time
+	Path   string // Only commits touching this path
+	Author string // GitHub login or email
+	Ref    string // Branch, tag or SHA to list history from; empty means the default branch
+	Limit  int    // Maximum commits to return; 0 means all
+}
+
+// RepoDataSource is everything the analyzers read from a repository host.
+// GitHubClient talks to the REST API, LocalGitClient reads clones on disk.
+type RepoDataSource interface {
+	GetRepository(ctx context.Context, owner, repo string) (*GitHubRepoListing, error)
+	GetCommits(ctx context.Context, owner, repo string, limit int) ([]GitHubCommit, error)
+	ListCommits(ctx context.Context, owner, repo string, q CommitQuery) ([]GitHubCommit, error)
+	GetContributors(ctx context.Context, owner, repo string) ([]GitHubContributor, error)
+	GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error)
+	GetFileContentAt(ctx context.Context, owner, repo, path, ref string) ([]byte, error)
+	GetFileTree(ctx context.Context, owner, repo, branch string) (*GitHubTreeResponse, error)
+	GetCommitActivity(ctx context.Context, owner, repo string) ([]CommitActivityWeek, error)
+	GetCodeFrequency(ctx context.Context, owner, repo string) ([]CodeFrequencyWeek, error)
+	GetCommitFiles(ctx context.Context, owner, repo, sha string) ([]string, error)
+	GetCommitFileStats(ctx context.Context, owner, repo, sha string) ([]CommitFileStat, error)
+}
+
+// PullRequestSource is implemented by hosts with a pull request API.
+// Local clones have no review history.
+type PullRequestSource interface {
+	ListPullRequests(ctx context.Context, owner, repo, base string, since time.Time, limit int) ([]GitHubPullRequest, error)
+	GetPullRequest(ctx context.Context, owner, repo string, number int) (*GitHubPullRequest, error)
+	GetPullRequestReviews(ctx context.Context, owner, repo string, number int) ([]GitHubReview, error)
+	GetPullRequestReviewComments(ctx context.Context, owner, repo string, number int) ([]GitHubReviewComment, error)
+}
+
+// IssueSource is implemented by hosts with an issue tracker
+type IssueSource interface {
+	ListIssues(ctx context.Context, owner, repo string, since time.Time, limit int) ([]GitHubIssue, error)
+	GetIssue(ctx context.Context, owner, repo string, number int) (*GitHubIssue, error)
+}
+
+// newRepoDataSource returns the data source for repo's connection. A repo is
+// only ever read through the connection that listed it, so without that
+// connection it fails rather than trying another host or credential.
+func newRepoDataSource(repo *DiscoveredRepo) (RepoDataSource, error) {
+	conn := connectionFor(repo.ConnectionID)
+	if conn == nil {
+		return nil, fmt.Errorf("not connected: reconnect %s to read %s", repo.ConnectionID, repo.FullName)
+	}
+	return conn.dataSource(), nil
+}
+
+// resolveRepoRef resolves ref on repo's own connection; see resolveAnalysisRef
+func resolveRepoRef(ctx context.Context, repo *DiscoveredRepo, owner, name, ref string) (RepoDataSource, *AnalysisRef, error) {
+	source, err := newRepoDataSource(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resolveAnalysisRef(ctx, source, owner, name, repo.DefaultBranch, ref)
+}
 
-type GitHubClient struct {
-	token      string
-	httpClient *http.Client
+// isDataSourceConfigured reports whether repo has a connection to be read through
+func isDataSourceConfigured(repo *DiscoveredRepo) bool {
+	return connectionFor(repo.ConnectionID) != nil
 }
 
-func NewGitHubClient(token string) *GitHubClient {
-	return &GitHubClient{
-		token:      token,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
-	}
+// ==================== CONNECTION REGISTRY ====================
+
+// liveConnection is a connected account and its credentials. Credentials stay
+// in memory; only the GitHubConnection describing the account is persisted.
+type liveConnection struct {
+	id       string
+	provider string // "github", "gitlab" or "local"
+	baseURL  string // API root or instance URL; the clone directory for "local"
+	creds    connectionCredentials
 }
 
-func (c *GitHubClient) request(path string) ([]byte, int, error) {
-	url := "https://api.github.com" + path
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, 0, err
+var (
+	connections     = make(map[string]*liveConnection)
+	connectionsLock sync.RWMutex
+
+	// envConnection is the GITHUB_TOKEN connection, also registered in
+	// connections. Besides the repos it discovers, it serves repos on its host
+	// whose own connection is gone, such as those restored from state.json
+	// after a restart. Set at startup.
+	envConnection *liveConnection
+)
+
+// connectionID names a connection by provider, host and account, so
+// reconnecting an account replaces its entry instead of adding another
+func connectionID(provider, baseURL, login string) string {
+	if provider == "local" {
+		return "local"
+	}
+	if provider == "github" {
+		baseURL = normalizeGitHubAPIURL(baseURL)
 	}
+	host := baseURL
+	if parsed, err := url.Parse(baseURL); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+	return strings.ToLower(provider + ":" + host + ":" + login)
+}
 
-	if c.token != "" {
-		req.Header.Set("Authorization", "Bearer "+c.token)
+func registerConnection(conn *liveConnection) {
+	connectionsLock.Lock()
+	connections[conn.id] = conn
+	connectionsLock.Unlock()
+}
+
+// connectionHost is the provider:host part of a connection ID, "" for local
+func connectionHost(id string) string {
+	if i := strings.LastIndex(id, ":"); i > 0 {
+		return id[:i]
 	}
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("User-Agent", "RepoAnalyst-App")
+	return ""
+}
 
-	log.Printf("[GitHub API] GET %s", path)
+// connectionFor returns the connection registered as id. When it is gone, a
+// GitHub repo on the GITHUB_TOKEN host is read with that token; any other
+// gets nil, since another host or provider cannot serve it.
+func connectionFor(id string) *liveConnection {
+	connectionsLock.RLock()
+	defer connectionsLock.RUnlock()
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, 0, err
+	if conn, ok := connections[id]; ok {
+		return conn
 	}
-	defer resp.Body.Close()
+	if envConnection != nil && strings.HasPrefix(id, "github:") && connectionHost(id) == connectionHost(envConnection.id) {
+		return envConnection
+	}
+	return nil
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, resp.StatusCode, err
+// isLiveConnection reports whether id itself is registered, as opposed to
+// being served by the GITHUB_TOKEN fallback
+func isLiveConnection(id string) bool {
+	connectionsLock.RLock()
+	defer connectionsLock.RUnlock()
+	return connections[id] != nil
+}
+
+// liveConnections returns every registered connection, ordered by ID
+func liveConnections() []*liveConnection {
+	connectionsLock.RLock()
+	result := make([]*liveConnection, 0, len(connections))
+	for _, conn := range connections {
+		result = append(result, conn)
 	}
+	connectionsLock.RUnlock()
 
-	log.Printf("[GitHub API] Response: %d (%d bytes)", resp.StatusCode, len(body))
-	return body, resp.StatusCode, nil
+	sort.Slice(result, func(i, j int) bool { return result[i].id < result[j].id })
+	return result
 }
 
-func (c *GitHubClient) GetAuthenticatedUser() (*GitHubUser, error) {
-	body, status, err := c.request("/user")
-	if err != nil {
-		return nil, err
+// dataSource returns a client authenticated as this connection
+func (c *liveConnection) dataSource() RepoDataSource {
+	var client *GitHubClient
+	switch {
+	case c.provider == "local":
+		return NewLocalGitClient(c.baseURL)
+	case c.provider == "gitlab":
+		return NewGitLabClient(c.baseURL, c.creds.token)
+	case c.creds.app != nil:
+		client = NewGitHubAppClient(c.creds.app)
+	case c.creds.oauth != nil:
+		client = NewGitHubOAuthClient(c.baseURL, c.creds.oauth)
+	default:
+		client = NewGitHubClient(c.baseURL, c.creds.token)
+	}
+	client.connection = c.id
+	return client
+}
+
+// addConnectionUnsafe records a connected account and the repos discovered
+// through it, replacing what an earlier discovery for the account found.
+// The same owner/name may also be listed by other connections, e.g. a mirror
+// on GitLab; each stays a separate project, see repoKey. Callers hold stateLock.
+func addConnectionUnsafe(info *GitHubConnection, discovered []DiscoveredRepo) {
+	previous := make(map[string]string) // Analysis states of this connection's earlier discovery
+	kept := make([]DiscoveredRepo, 0, len(state.DiscoveredRepos)+len(discovered))
+	for _, repo := range state.DiscoveredRepos {
+		if repo.ConnectionID == info.ID {
+			previous[repo.FullName] = repo.AnalysisState
+			continue
+		}
+		kept = append(kept, repo)
 	}
-	if status != 200 {
-		return nil, fmt.Errorf("authentication failed: %d", status)
+
+	for _, repo := range discovered {
+		repo.ConnectionID = info.ID
+		if analysisState, ok := previous[repo.FullName]; ok {
+			repo.AnalysisState = analysisState
+		}
+		kept = append(kept, repo)
 	}
+	state.DiscoveredRepos = kept
 
-	var user GitHubUser
-	if err := json.Unmarshal(body, &user); err != nil {
-		return nil, err
+	info.RepoCount = len(discovered)
+	replaced := false
+	for i, conn := range state.Connections {
+		if conn.ID == info.ID {
+			state.Connections[i] = info
+			replaced = true
+		}
+	}
+	if !replaced {
+		state.Connections = append(state.Connections, info)
+	}
+	// A new account becomes the one shown first; rediscovery keeps the order
+	if !replaced || state.Connection == nil || state.Connection.ID == info.ID {
+		state.Connection = info
 	}
-	return &user, nil
 }
 
-func (c *GitHubClient) ListUserRepos() ([]GitHubRepoListing, error) {
-	var allRepos []GitHubRepoListing
-	page := 1
+// removeConnectionUnsafe forgets a connection along with its repos and their
+// stored analyses. Callers hold stateLock.
+func removeConnectionUnsafe(id string) {
+	connectionsLock.Lock()
+	delete(connections, id)
+	if envConnection != nil && envConnection.id == id {
+		envConnection = nil
+	}
+	connectionsLock.Unlock()
 
-	for {
-		body, status, err := c.request(fmt.Sprintf("/user/repos?per_page=100&page=%d&sort=updated", page))
-		if err != nil {
-			return nil, err
+	kept := make([]DiscoveredRepo, 0, len(state.DiscoveredRepos))
+	for _, repo := range state.DiscoveredRepos {
+		if repo.ConnectionID != id {
+			kept = append(kept, repo)
+			continue
 		}
-		if status != 200 {
-			return nil, fmt.Errorf("failed to list repos: %d", status)
+		key := repoKey(&repo)
+		for analysis := range state.Analyses {
+			if analysis == key || strings.HasPrefix(analysis, key+"@") {
+				delete(state.Analyses, analysis)
+			}
 		}
-
-		var repos []GitHubRepoListing
-		if err := json.Unmarshal(body, &repos); err != nil {
-			return nil, err
+		if state.SelectedProject == key {
+			state.SelectedProject = ""
 		}
+	}
+	state.DiscoveredRepos = kept
 
-		if len(repos) == 0 {
-			break
+	remaining := make([]*GitHubConnection, 0, len(state.Connections))
+	for _, conn := range state.Connections {
+		if conn.ID != id {
+			remaining = append(remaining, conn)
 		}
+	}
+	state.Connections = remaining
+	state.Connection = nil
+	if len(remaining) > 0 {
+		state.Connection = remaining[len(remaining)-1]
+	}
+}
 
-		allRepos = append(allRepos, repos...)
-		page++
-
-		if len(repos) < 100 {
-			break
-		}
+// splitFullName splits owner/name at the last slash, since a GitLab owner is
+// a namespace that may hold slashes of its own (group/subgroup/project)
+func splitFullName(fullName string) (owner, name string, ok bool) {
+	i := strings.LastIndex(fullName, "/")
+	if i <= 0 || i == len(fullName)-1 {
+		return "", "", false
 	}
+	return fullName[:i], fullName[i+1:], true
+}
 
-	return allRepos, nil
+// repoKey identifies a discovered repo: the same owner/name can be listed by
+// several connections, e.g. on github.com and a GHES host, and each is its own
+// project with its own analyses
+func repoKey(repo *DiscoveredRepo) string {
+	return repo.ConnectionID + "/" + repo.FullName
 }
 
-func (c *GitHubClient) GetRepository(owner, repo string) (*GitHubRepoListing, error) {
-	body, status, err := c.request(fmt.Sprintf("/repos/%s/%s", owner, repo))
-	if err != nil {
-		return nil, err
+// findRepoUnsafe returns the discovered repo with the given repoKey. A bare
+// owner/name is accepted when exactly one connection lists it. Callers hold
+// stateLock.
+func findRepoUnsafe(key string) (*DiscoveredRepo, error) {
+	var match *DiscoveredRepo
+	matches := 0
+	for i := range state.DiscoveredRepos {
+		repo := &state.DiscoveredRepos[i]
+		if repoKey(repo) == key {
+			return repo, nil
+		}
+		if repo.FullName == key {
+			match = repo
+			matches++
+		}
 	}
-	if status != 200 {
-		return nil, fmt.Errorf("repo not found: %d", status)
+	switch matches {
+	case 0:
+		return nil, fmt.Errorf("project not found")
+	case 1:
+		return match, nil
 	}
+	return nil, fmt.Errorf("%s is listed by %d connections; pass connectionId", key, matches)
+}
 
-	var repoData GitHubRepoListing
-	if err := json.Unmarshal(body, &repoData); err != nil {
-		return nil, err
+// projectKeyParam qualifies fullName with the request's ?connection=, which
+// picks one listing when several connections list the same owner/name
+func projectKeyParam(r *http.Request, fullName string) string {
+	if connection := r.URL.Query().Get("connection"); connection != "" {
+		return connection + "/" + fullName
 	}
-	return &repoData, nil
+	return fullName
 }
 
-func (c *GitHubClient) GetCommits(owner, repo string, limit int) ([]GitHubCommit, error) {
-	body, status, err := c.request(fmt.Sprintf("/repos/%s/%s/commits?per_page=%d", owner, repo, limit))
-	if err != nil {
-		return nil, err
+// repoConnectionUnsafe describes the account repo was discovered through.
+// Callers hold stateLock.
+func repoConnectionUnsafe(repo *DiscoveredRepo) *GitHubConnection {
+	if repo != nil {
+		for _, conn := range state.Connections {
+			if conn.ID == repo.ConnectionID {
+				return conn
+			}
+		}
 	}
-	if status != 200 {
-		return nil, fmt.Errorf("failed to fetch commits: %d", status)
+	return state.Connection
+}
+
+// ==================== ANALYSIS WINDOW ====================
+
+// AnalysisWindow bounds the commit history the history-based analyzers read.
+// Both limits apply together; a zero value disables that limit, except that
+// no window reads more than maxWindowCommits commits.
+type AnalysisWindow struct {
+	Days       int `json:"days"`       // Only commits from the last N days
+	MaxCommits int `json:"maxCommits"` // At most N most recent commits
+
+	asOf time.Time // When set, Days counts back from here instead of from now
+}
+
+// defaultAnalysisWindow keeps a first analysis within a few hundred API calls
+var defaultAnalysisWindow = AnalysisWindow{Days: 90, MaxCommits: 200}
+
+// maxWindowCommits caps every window, including Full History: the analyzers
+// fetch file stats once per commit, so the commit count is the API call count
+const maxWindowCommits = 1000
+
+func currentAnalysisWindow() AnalysisWindow {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+	if state.AnalysisWindow == nil {
+		return defaultAnalysisWindow
 	}
+	return *state.AnalysisWindow
+}
 
-	var commits []GitHubCommit
-	if err := json.Unmarshal(body, &commits); err != nil {
-		return nil, err
+// commitLimit is the most commits the window reads
+func (w AnalysisWindow) commitLimit() int {
+	if w.MaxCommits <= 0 || w.MaxCommits > maxWindowCommits {
+		return maxWindowCommits
 	}
-	return commits, nil
+	return w.MaxCommits
 }
 
-func (c *GitHubClient) GetContributors(owner, repo string) ([]GitHubContributor, error) {
-	body, status, err := c.request(fmt.Sprintf("/repos/%s/%s/contributors?per_page=100", owner, repo))
-	if err != nil {
-		return nil, err
+func (w AnalysisWindow) Query() CommitQuery {
+	q := CommitQuery{Limit: w.commitLimit()}
+	if w.Days > 0 {
+		now := w.asOf
+		if now.IsZero() {
+			now = time.Now()
+		}
+		q.Since = now.AddDate(0, 0, -w.Days)
 	}
-	if status != 200 {
-		return nil, fmt.Errorf("failed to fetch contributors: %d", status)
+	return q
+}
+
+// Label describes the window for the analyzers' Window fields
+func (w AnalysisWindow) Label() string {
+	switch {
+	case w.Days > 0 && w.MaxCommits > 0:
+		return fmt.Sprintf("Last %d Days (up to %d Commits)", w.Days, w.MaxCommits)
+	case w.Days > 0:
+		return fmt.Sprintf("Last %d Days (up to %d Commits)", w.Days, maxWindowCommits)
+	case w.MaxCommits > 0:
+		return fmt.Sprintf("Last %d Commits", w.MaxCommits)
 	}
+	return fmt.Sprintf("Full History (up to %d Commits)", maxWindowCommits)
+}
 
-	var contributors []GitHubContributor
-	if err := json.Unmarshal(body, &contributors); err != nil {
-		return nil, err
+// spanDays is the number of days the window covers: the configured day count,
+// or the span of the commits actually read when only a commit limit is set
+func (w AnalysisWindow) spanDays(commits []GitHubCommit) int {
+	if w.Days > 0 || len(commits) == 0 {
+		return w.Days
 	}
-	return contributors, nil
+	oldest, newest := commits[0].Commit.Author.Date, commits[0].Commit.Author.Date
+	for _, c := range commits[1:] {
+		if c.Commit.Author.Date.Before(oldest) {
+			oldest = c.Commit.Author.Date
+		}
+		if c.Commit.Author.Date.After(newest) {
+			newest = c.Commit.Author.Date
+		}
+	}
+	return int(math.Ceil(newest.Sub(oldest).Hours()/24)) + 1
 }
 
-func (c *GitHubClient) GetFileContent(owner, repo, path string) ([]byte, error) {
-	body, status, err := c.request(fmt.Sprintf("/repos/%s/%s/contents/%s", owner, repo, path))
-	if err != nil {
-		return nil, err
+// fetchCommitFileStats fetches the changed files of each commit with bounded
+// concurrency. The result is index-aligned with commits; failed lookups are nil.
+func fetchCommitFileStats(ctx context.Context, client RepoDataSource, owner, repo string, commits []GitHubCommit) [][]CommitFileStat {
+	fileSets := make([][]CommitFileStat, len(commits))
+	sem := make(chan struct{}, 5) // 5 concurrent fetches
+	var wg sync.WaitGroup
+
+	for i := range commits {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}        // acquire
+			defer func() { <-sem }() // release
+			if ctx.Err() != nil {
+				return // Cancelled or past the deadline; leave the lookup failed
+			}
+			files, err := client.GetCommitFileStats(ctx, owner, repo, commits[i].SHA)
+			if err == nil && files == nil {
+				files = []CommitFileStat{}
+			}
+			fileSets[i] = files
+		}(i)
 	}
-	if status == 404 {
-		return nil, nil
+	wg.Wait()
+	return fileSets
+}
+
+// RenameGraph maps the paths each commit touched to the file's newest path,
+// so history recorded under old names folds into the file's current name.
+// A path only maps forward for commits older than its rename: a file added
+// at the old path afterwards keeps its own history.
+type RenameGraph struct {
+	canonical []map[string]string // Index-aligned with the commits; path -> newest path
+}
+
+// buildRenameGraph collects renames from commit file stats ordered newest
+// commit first, as commit listings are
+func buildRenameGraph(fileSets [][]CommitFileStat) *RenameGraph {
+	g := &RenameGraph{canonical: make([]map[string]string, len(fileSets))}
+
+	// Walking newest first, renamedTo holds the newest path of every file
+	// renamed in a commit already visited. A rename starts the mapping for
+	// older commits; an add at the old path, met earlier in the walk, sits
+	// on the newer side of it and so is never mapped.
+	renamedTo := make(map[string]string)
+	for i, files := range fileSets {
+		paths := make(map[string]string, len(files))
+		for _, f := range files {
+			if newest, ok := renamedTo[f.Filename]; ok {
+				paths[f.Filename] = newest
+			} else {
+				paths[f.Filename] = f.Filename
+			}
+		}
+		g.canonical[i] = paths
+
+		// Before this commit, a file renamed or added here did not exist at
+		// its new path; older commits touching that path touched another file
+		for _, f := range files {
+			if f.Status == "added" || (f.PreviousFilename != "" && f.PreviousFilename != f.Filename) {
+				delete(renamedTo, f.Filename)
+			}
+		}
+		for _, f := range files {
+			if f.PreviousFilename != "" && f.PreviousFilename != f.Filename {
+				renamedTo[f.PreviousFilename] = paths[f.Filename]
+			}
+		}
 	}
-	if status != 200 {
-		return nil, fmt.Errorf("failed to fetch file: %d", status)
+	return g
+}
+
+// Canonical returns the newest known path for path as changed by the commit
+// at index commit
+func (g *RenameGraph) Canonical(commit int, path string) string {
+	if commit < len(g.canonical) {
+		if newest, ok := g.canonical[commit][path]; ok {
+			return newest
+		}
 	}
+	return path
+}
 
-	var content GitHubContent
-	if err := json.Unmarshal(body, &content); err != nil {
-		return nil, err
+// ==================== ANALYSIS REF ====================
+
+// AnalysisRef records the revision an analysis ran against
+type AnalysisRef struct {
+	Name      string `json:"name"`          // Branch, tag or SHA as requested, or the default branch
+	SHA       string `json:"sha,omitempty"` // Commit Name resolved to; empty for an empty repository
+	IsDefault bool   `json:"isDefault"`     // Name is the repository's default branch
+}
+
+// Label renders the ref for report headers, e.g. "release/2.1 @ 1a2b3c4"
+func (ref *AnalysisRef) Label() string {
+	if ref == nil {
+		return ""
 	}
+	if len(ref.SHA) >= 7 && !strings.HasPrefix(ref.SHA, ref.Name) {
+		return ref.Name + " @ " + ref.SHA[:7]
+	}
+	return ref.Name
+}
 
-	if content.Encoding == "base64" {
-		decoded, err := base64.StdEncoding.DecodeString(content.Content)
-		if err != nil {
-			return nil, err
+// validRefName rejects refs git could read as an option or revision range
+func validRefName(ref string) bool {
+	if len(ref) > 255 || strings.HasPrefix(ref, "-") || strings.Contains(ref, "..") || strings.Contains(ref, "@{") {
+		return false
+	}
+	for _, r := range ref {
+		if r <= ' ' || r == 0x7f || strings.ContainsRune("~^:?*[\\", r) {
+			return false
 		}
-		return decoded, nil
 	}
-	return []byte(content.Content), nil
+	return true
 }
 
-func (c *GitHubClient) GetFileTree(owner, repo, branch string) (*GitHubTreeResponse, error) {
-	body, status, err := c.request(fmt.Sprintf("/repos/%s/%s/git/trees/%s?recursive=1", owner, repo, branch))
-	if err != nil {
-		return nil, err
+// requestedRef returns the ?ref= parameter of an analysis or export request
+func requestedRef(r *http.Request) (string, error) {
+	ref := strings.TrimSpace(r.URL.Query().Get("ref"))
+	if ref != "" && !validRefName(ref) {
+		return "", fmt.Errorf("invalid ref %q", ref)
 	}
-	if status != 200 {
-		return nil, fmt.Errorf("failed to fetch tree: %d", status)
+	return ref, nil
+}
+
+// analysisKey scopes cached and stored analyses to a ref of a project, named
+// by its repoKey. The default branch keeps the bare key.
+func analysisKey(project, ref, defaultBranch string) string {
+	if ref == "" || ref == defaultBranch {
+		return project
 	}
+	return project + "@" + ref
+}
 
-	var tree GitHubTreeResponse
-	if err := json.Unmarshal(body, &tree); err != nil {
-		return nil, err
+// storedAnalysisUnsafe returns the stored analysis of repo at ref, or nil.
+// Callers hold stateLock.
+func storedAnalysisUnsafe(repo *DiscoveredRepo, ref string) *RepoAnalysis {
+	if repo == nil {
+		return nil
 	}
-	return &tree, nil
+	return state.Analyses[analysisKey(repoKey(repo), ref, repo.DefaultBranch)]
 }
 
-// GitHub Stats API - returns weekly commit counts for last 52 weeks
-// Note: GitHub returns 202 when stats are being computed for the first time
-func (c *GitHubClient) GetCommitActivity(owner, repo string) ([]CommitActivityWeek, error) {
-	maxRetries := 5
-	var body []byte
-	var status int
-	var err error
+// resolveAnalysisRef resolves ref to a commit. The default branch keeps the
+// plain client; any other ref gets a source pinned to the resolved commit so
+// every read in the run sees the same revision.
+func resolveAnalysisRef(ctx context.Context, client RepoDataSource, owner, repo, defaultBranch, ref string) (RepoDataSource, *AnalysisRef, error) {
+	target := &AnalysisRef{Name: ref, IsDefault: ref == "" || ref == defaultBranch}
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		body, status, err = c.request(fmt.Sprintf("/repos/%s/%s/stats/commit_activity", owner, repo))
+	q := CommitQuery{Limit: 1}
+	if !target.IsDefault {
+		q.Ref = ref
+	}
+	commits, err := client.ListCommits(ctx, owner, repo, q)
+	if err != nil && !target.IsDefault {
+		return nil, nil, fmt.Errorf("failed to resolve ref %q: %w", ref, err)
+	}
+	if len(commits) > 0 {
+		target.SHA = commits[0].SHA
+	}
+
+	if target.IsDefault {
 		if err != nil {
-			return nil, err
+			log.Printf("[Analysis] Warning: Failed to resolve default branch of %s/%s: %v", owner, repo, err)
 		}
-
-		if status == 200 {
-			break
+		target.Name = defaultBranch
+		if target.Name == "" {
+			target.Name = "main"
+			if target.SHA != "" {
+				target.Name = target.SHA
+			}
 		}
+		return client, target, nil
+	}
 
-		// GitHub returns 202 when stats are being computed
-		if status == 202 {
-			waitTime := time.Duration(2+attempt) * time.Second // Progressive backoff: 2s, 3s, 4s, 5s, 6s
-			log.Printf("[GitHub Stats] Commit activity is being computed (attempt %d/%d), waiting %v...", attempt+1, maxRetries, waitTime)
-			time.Sleep(waitTime)
-			continue
-		}
+	if target.SHA == "" {
+		return nil, nil, fmt.Errorf("ref %q not found", ref)
+	}
+	return &refSource{RepoDataSource: client, sha: target.SHA}, target, nil
+}
 
-		// Other error status
-		return nil, fmt.Errorf("failed to fetch commit activity: %d", status)
+// refSource pins a data source to one commit of a non-default ref
+type refSource struct {
+	RepoDataSource
+	sha string
+}
+
+// unpinned returns the source behind a ref-pinned one, for host APIs such as
+// pull requests and issues that are not tied to a commit
+func unpinned(client RepoDataSource) RepoDataSource {
+	if snapshot, ok := client.(*runSnapshot); ok {
+		client = snapshot.RepoDataSource
+	}
+	if pinned, ok := client.(*refSource); ok {
+		return pinned.RepoDataSource
 	}
+	return client
+}
 
-	if status != 200 {
-		log.Printf("[GitHub Stats] Stats still not ready after %d attempts - returning empty data", maxRetries)
-		// Return empty data instead of error - this allows the UI to show "no data" instead of error
-		return []CommitActivityWeek{}, nil
+func (s *refSource) GetCommits(ctx context.Context, owner, repo string, limit int) ([]GitHubCommit, error) {
+	return s.ListCommits(ctx, owner, repo, CommitQuery{Limit: limit})
+}
+
+func (s *refSource) ListCommits(ctx context.Context, owner, repo string, q CommitQuery) ([]GitHubCommit, error) {
+	if q.Ref == "" {
+		q.Ref = s.sha
 	}
+	return s.RepoDataSource.ListCommits(ctx, owner, repo, q)
+}
 
-	var activity []CommitActivityWeek
-	if err := json.Unmarshal(body, &activity); err != nil {
-		return nil, err
+func (s *refSource) GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error) {
+	return s.RepoDataSource.GetFileContentAt(ctx, owner, repo, path, s.sha)
+}
+
+func (s *refSource) GetFileContentAt(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	if ref == "" {
+		ref = s.sha
 	}
-	return activity, nil
+	return s.RepoDataSource.GetFileContentAt(ctx, owner, repo, path, ref)
 }
 
-// GitHub Stats API - returns weekly additions/deletions
-func (c *GitHubClient) GetCodeFrequency(owner, repo string) ([]CodeFrequencyWeek, error) {
-	maxRetries := 3
-	var body []byte
-	var status int
-	var err error
+func (s *refSource) GetFileTree(ctx context.Context, owner, repo, _ string) (*GitHubTreeResponse, error) {
+	return s.RepoDataSource.GetFileTree(ctx, owner, repo, s.sha)
+}
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		body, status, err = c.request(fmt.Sprintf("/repos/%s/%s/stats/code_frequency", owner, repo))
-		if err != nil {
-			return nil, err
+// GetCommitActivity derives weekly counts from the ref's own history, since
+// the stats endpoints only describe the default branch
+func (s *refSource) GetCommitActivity(ctx context.Context, owner, repo string) ([]CommitActivityWeek, error) {
+	now := time.Now()
+	commits, err := s.ListCommits(ctx, owner, repo, CommitQuery{Since: weekStart(now).AddDate(0, 0, -7*51)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch commit activity: %w", err)
+	}
+
+	timestamps := make([]time.Time, len(commits))
+	for i, c := range commits {
+		timestamps[i] = c.Commit.Author.Date
+	}
+	return buildCommitActivity(timestamps, now), nil
+}
+
+// GetCodeFrequency is unavailable off the default branch: deriving it would
+// cost one commit-detail request per commit in the last year
+func (s *refSource) GetCodeFrequency(ctx context.Context, owner, repo string) ([]CodeFrequencyWeek, error) {
+	return nil, fmt.Errorf("code frequency is only available for the default branch")
+}
+
+// ==================== RUN SNAPSHOT ====================
+
+// runSnapshot is the data an analysis run reads. It wraps the run's source so
+// each commit listing, commit detail, tree, contributor list and file is
+// fetched once however many analyzers ask for it, and concurrent lookups of
+// the same key share one request. A snapshot belongs to one project at one
+// commit, so keys leave out owner and repo.
+type runSnapshot struct {
+	RepoDataSource
+	sha       string         // Commit the run analyzes; a new commit needs a new snapshot
+	window    AnalysisWindow // Anchored at creation so every analyzer issues the same commit query
+	createdAt time.Time
+
+	mu           sync.Mutex
+	calls        map[string]*snapshotCall
+	commits      []GitHubCommit // The window's commit listing, once fetched
+	tree         *GitHubTreeResponse
+	contributors []GitHubContributor
+	fetchTime    time.Duration // Summed over all lookups, including concurrent ones
+}
+
+type snapshotCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+func newRunSnapshot(client RepoDataSource, sha string, window AnalysisWindow) *runSnapshot {
+	now := time.Now()
+	window.asOf = now
+	return &runSnapshot{
+		RepoDataSource: client,
+		sha:            sha,
+		window:         window,
+		createdAt:      now,
+		calls:          make(map[string]*snapshotCall),
+	}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// load returns the value stored under key, calling fetch only when no earlier
+// or in-flight lookup exists. Only successful lookups are kept: a failed one
+// is shared with the callers already waiting on it, then forgotten so the
+// next caller fetches again.
+func (s *runSnapshot) load(ctx context.Context, key string, fetch func() (interface{}, error)) (interface{}, error) {
+	for {
+		s.mu.Lock()
+		call, ok := s.calls[key]
+		if !ok {
+			call = &snapshotCall{done: make(chan struct{})}
+			s.calls[key] = call
+			s.mu.Unlock()
+
+			start := time.Now()
+			call.val, call.err = fetch()
+
+			s.mu.Lock()
+			s.fetchTime += time.Since(start)
+			if call.err != nil {
+				delete(s.calls, key)
+			}
+			s.mu.Unlock()
+			close(call.done)
+			return call.val, call.err
 		}
+		s.mu.Unlock()
 
-		if status == 200 {
-			break
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// A lookup abandoned by another request is retried under this one
+		if !isContextError(call.err) || ctx.Err() != nil {
+			return call.val, call.err
 		}
+	}
+}
 
-		if status == 202 {
-			log.Printf("[GitHub Stats] Code frequency is being computed (attempt %d/%d), waiting...", attempt+1, maxRetries)
-			time.Sleep(3 * time.Second)
-			continue
+func commitQueryKey(q CommitQuery) string {
+	return fmt.Sprintf("commits:%d:%d:%s:%s:%s:%d", q.Since.Unix(), q.Until.Unix(), q.Path, q.Author, q.Ref, q.Limit)
+}
+
+func (s *runSnapshot) GetRepository(ctx context.Context, owner, repo string) (*GitHubRepoListing, error) {
+	v, err := s.load(ctx, "repository", func() (interface{}, error) {
+		return s.RepoDataSource.GetRepository(ctx, owner, repo)
+	})
+	repoData, _ := v.(*GitHubRepoListing)
+	return repoData, err
+}
+
+func (s *runSnapshot) GetCommits(ctx context.Context, owner, repo string, limit int) ([]GitHubCommit, error) {
+	v, err := s.load(ctx, fmt.Sprintf("recent:%d", limit), func() (interface{}, error) {
+		return s.RepoDataSource.GetCommits(ctx, owner, repo, limit)
+	})
+	commits, _ := v.([]GitHubCommit)
+	return commits, err
+}
+
+func (s *runSnapshot) ListCommits(ctx context.Context, owner, repo string, q CommitQuery) ([]GitHubCommit, error) {
+	key := commitQueryKey(q)
+	v, err := s.load(ctx, key, func() (interface{}, error) {
+		commits, err := s.RepoDataSource.ListCommits(ctx, owner, repo, q)
+		if err == nil && key == commitQueryKey(s.window.Query()) {
+			s.mu.Lock()
+			s.commits = commits
+			s.mu.Unlock()
 		}
+		return commits, err
+	})
+	commits, _ := v.([]GitHubCommit)
+	return commits, err
+}
 
-		return nil, fmt.Errorf("failed to fetch code frequency: %d", status)
-	}
+func (s *runSnapshot) GetContributors(ctx context.Context, owner, repo string) ([]GitHubContributor, error) {
+	v, err := s.load(ctx, "contributors", func() (interface{}, error) {
+		contributors, err := s.RepoDataSource.GetContributors(ctx, owner, repo)
+		if err == nil {
+			s.mu.Lock()
+			s.contributors = contributors
+			s.mu.Unlock()
+		}
+		return contributors, err
+	})
+	contributors, _ := v.([]GitHubContributor)
+	return contributors, err
+}
 
-	if status != 200 {
-		log.Printf("[GitHub Stats] Code frequency still not ready after %d attempts", maxRetries)
-		return []CodeFrequencyWeek{}, nil // Return empty, don't fail
-	}
+func (s *runSnapshot) GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error) {
+	return s.GetFileContentAt(ctx, owner, repo, path, "")
+}
 
-	// Returns array of [timestamp, additions, deletions]
-	var raw [][]int
-	if err := json.Unmarshal(body, &raw); err != nil {
-		return nil, err
-	}
+func (s *runSnapshot) GetFileContentAt(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	v, err := s.load(ctx, "file:"+ref+":"+path, func() (interface{}, error) {
+		if ref == "" {
+			return s.RepoDataSource.GetFileContent(ctx, owner, repo, path)
+		}
+		return s.RepoDataSource.GetFileContentAt(ctx, owner, repo, path, ref)
+	})
+	content, _ := v.([]byte)
+	return content, err
+}
 
-	var result []CodeFrequencyWeek
-	for _, week := range raw {
-		if len(week) >= 3 {
-			result = append(result, CodeFrequencyWeek{
-				Week:      week[0],
-				Additions: week[1],
-				Deletions: week[2],
-			})
+func (s *runSnapshot) GetFileTree(ctx context.Context, owner, repo, branch string) (*GitHubTreeResponse, error) {
+	v, err := s.load(ctx, "tree:"+branch, func() (interface{}, error) {
+		tree, err := s.RepoDataSource.GetFileTree(ctx, owner, repo, branch)
+		if err == nil {
+			s.mu.Lock()
+			s.tree = tree
+			s.mu.Unlock()
 		}
-	}
-	return result, nil
+		return tree, err
+	})
+	tree, _ := v.(*GitHubTreeResponse)
+	return tree, err
 }
 
-type GitHubCommitDetail struct {
-	Files []struct {
-		Filename string `json:"filename"`
-	} `json:"files"`
+func (s *runSnapshot) GetCommitActivity(ctx context.Context, owner, repo string) ([]CommitActivityWeek, error) {
+	v, err := s.load(ctx, "activity", func() (interface{}, error) {
+		return s.RepoDataSource.GetCommitActivity(ctx, owner, repo)
+	})
+	activity, _ := v.([]CommitActivityWeek)
+	return activity, err
+}
+
+func (s *runSnapshot) GetCodeFrequency(ctx context.Context, owner, repo string) ([]CodeFrequencyWeek, error) {
+	v, err := s.load(ctx, "frequency", func() (interface{}, error) {
+		return s.RepoDataSource.GetCodeFrequency(ctx, owner, repo)
+	})
+	frequency, _ := v.([]CodeFrequencyWeek)
+	return frequency, err
 }
 
-func (c *GitHubClient) GetCommitFiles(owner, repo, sha string) ([]string, error) {
-	body, status, err := c.request(fmt.Sprintf("/repos/%s/%s/commits/%s", owner, repo, sha))
+// GetCommitFiles shares the commit detail lookup with GetCommitFileStats
+func (s *runSnapshot) GetCommitFiles(ctx context.Context, owner, repo, sha string) ([]string, error) {
+	stats, err := s.GetCommitFileStats(ctx, owner, repo, sha)
 	if err != nil {
 		return nil, err
 	}
-	if status != 200 {
-		return nil, fmt.Errorf("failed to fetch commit detail: %d", status)
-	}
+	return commitFilenames(stats), nil
+}
 
-	var detail GitHubCommitDetail
-	if err := json.Unmarshal(body, &detail); err != nil {
-		return nil, err
+func (s *runSnapshot) GetCommitFileStats(ctx context.Context, owner, repo, sha string) ([]CommitFileStat, error) {
+	v, err := s.load(ctx, "files:"+sha, func() (interface{}, error) {
+		return s.RepoDataSource.GetCommitFileStats(ctx, owner, repo, sha)
+	})
+	stats, _ := v.([]CommitFileStat)
+	return stats, err
+}
+
+// recordRaw copies what the snapshot has fetched into state's raw data fields
+func (s *runSnapshot) recordRaw(state *RepositoryAnalysisState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state.RawCommits = s.commits
+	state.RawContributors = s.contributors
+	state.RawTree = treeNodes(s.tree)
+	state.FetchTimeMs = s.fetchTime.Milliseconds()
+}
+
+// analysisRunSnapshot returns the snapshot a run for projectKey at target reads
+// through. Runs share the project's snapshot while it is younger than
+// REPO_CACHE_TTL, still describes target's commit and was taken with the
+// configured window; otherwise, or when fresh is set, a new one wraps client.
+func analysisRunSnapshot(projectKey string, client RepoDataSource, target *AnalysisRef, fresh bool) *runSnapshot {
+	window := currentAnalysisWindow()
+
+	analysisStatesMutex.Lock()
+	defer analysisStatesMutex.Unlock()
+
+	st, ok := analysisStates[projectKey]
+	if !ok {
+		st = &RepositoryAnalysisState{ProjectKey: projectKey, Status: "pending"}
+		analysisStates[projectKey] = st
+	}
+	if snap := st.snapshot; snap != nil && !fresh &&
+		time.Since(snap.createdAt) <= REPO_CACHE_TTL &&
+		snap.sha == target.SHA &&
+		snap.window.Days == window.Days && snap.window.MaxCommits == window.MaxCommits {
+		return snap
 	}
 
-	files := make([]string, len(detail.Files))
-	for i, f := range detail.Files {
-		files[i] = f.Filename
+	st.snapshot = newRunSnapshot(client, target.SHA, window)
+	return st.snapshot
+}
+
+// completeAnalysisRun stores a finished full analysis as the project's state,
+// along with the raw data its run read
+func completeAnalysisRun(projectKey string, snapshot *runSnapshot, analysis *RepoAnalysis, elapsed time.Duration) {
+	st := &RepositoryAnalysisState{
+		ProjectKey:     projectKey,
+		AnalysisTimeMs: elapsed.Milliseconds(),
+		snapshot:       snapshot,
+		Trajectory:     analysis.Trajectory,
+		Impact:         analysis.Impact,
+		Dependencies:   analysis.Deps,
+		Concentration:  analysis.Concentration,
+		Temporal:       analysis.Temporal,
 	}
-	return files, nil
+	snapshot.recordRaw(st)
+	setAnalysisState(projectKey, st)
 }
 
-// ==================== ANALYSIS ENGINE ====================
+// resetAnalysisStates drops every project's state and snapshot, for when the
+// connection they were fetched through goes away
+func resetAnalysisStates() {
+	analysisStatesMutex.Lock()
+	analysisStates = make(map[string]*RepositoryAnalysisState)
+	analysisStatesMutex.Unlock()
+}
 
-func analyzeRepository(client *GitHubClient, owner, repo, defaultBranch string) (*RepoAnalysis, error) {
-	log.Printf("[Analysis] Starting analysis for %s/%s", owner, repo)
+// ==================== RATE LIMIT BUDGET ====================
 
-	repoData, err := client.GetRepository(owner, repo)
-	if err != nil {
-		return nil, err
-	}
+// RateBudget is the primary rate limit GitHub reports for one credential
+type RateBudget struct {
+	Key       string    `json:"key"`
+	Resource  string    `json:"resource"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Used      int       `json:"used"`
+	ResetAt   time.Time `json:"resetAt"`
+	Known     bool      `json:"known"` // false until a response carried rate limit headers
+}
 
-	commits, err := client.GetCommits(owner, repo, 100)
-	if err != nil {
-		log.Printf("[Analysis] Warning: Failed to fetch commits: %v", err)
-		commits = []GitHubCommit{}
+// rateBudgetTracker guards a RateBudget. Each request optimistically reserves
+// one call so concurrent analyzers do not overshoot; response headers then
+// correct the count.
+type rateBudgetTracker struct {
+	mu sync.Mutex
+	RateBudget
+}
+
+const (
+	rateLimitReserve    = 10              // Pause when this few calls remain
+	maxRateLimitWait    = 2 * time.Minute // Longer waits fail fast instead of stalling a request
+	maxRateLimitRetries = 3
+)
+
+// deepAnalysisBaseCost covers the calls a full run makes regardless of the
+// window: repository, tree, contributors, activity and code frequency, the
+// manifests the import resolver reads, and a little slack for subtree pages
+const deepAnalysisBaseCost = 30
+
+// deepAnalysisCost estimates the API calls of a full analysis under window,
+// taking each analyzer at its ceiling. The run snapshot fetches every input
+// once, so the terms add up rather than multiply:
+//   - commit listing pages plus one file stats call per commit
+//   - up to maxImportGraphFiles source files for the import graph
+//   - the PR listing plus detail, reviews and review comments per PR
+//   - the issue listing pages plus maxIssueLookups single-issue fetches
+func deepAnalysisCost(window AnalysisWindow) int {
+	commits := window.commitLimit()
+	prs := maxReviewPRs
+	if window.MaxCommits > 0 && window.MaxCommits < prs {
+		prs = window.MaxCommits
+	}
+	pages := func(n int) int { return (n + 99) / 100 }
+
+	return deepAnalysisBaseCost +
+		pages(commits) + commits +
+		maxImportGraphFiles +
+		pages(prs) + 3*prs +
+		pages(maxDefectIssues) + maxIssueLookups
+}
+
+var (
+	rateBudgets     = make(map[string]*rateBudgetTracker)
+	rateBudgetsLock sync.Mutex
+)
+
+func rateBudgetFor(key string) *rateBudgetTracker {
+	rateBudgetsLock.Lock()
+	defer rateBudgetsLock.Unlock()
+
+	budget, ok := rateBudgets[key]
+	if !ok {
+		budget = &rateBudgetTracker{RateBudget: RateBudget{Key: key}}
+		rateBudgets[key] = budget
 	}
+	return budget
+}
 
-	// Fetch yearly commit activity (daily stats for 52 weeks) for the heatmap
-	activity, err := client.GetCommitActivity(owner, repo)
-	if err != nil {
-		log.Printf("[Analysis] Warning: Failed to fetch yearly activity: %v", err)
+func resetRateBudgets() {
+	rateBudgetsLock.Lock()
+	rateBudgets = make(map[string]*rateBudgetTracker)
+	rateBudgetsLock.Unlock()
+}
+
+// snapshotRateBudgets returns copies of every tracked budget, lowest remaining first
+func snapshotRateBudgets() []RateBudget {
+	rateBudgetsLock.Lock()
+	budgets := make([]*rateBudgetTracker, 0, len(rateBudgets))
+	for _, b := range rateBudgets {
+		budgets = append(budgets, b)
 	}
+	rateBudgetsLock.Unlock()
 
-	contributors, err := client.GetContributors(owner, repo)
-	if err != nil {
-		log.Printf("[Analysis] Warning: Failed to fetch contributors: %v", err)
-		contributors = []GitHubContributor{}
+	result := make([]RateBudget, 0, len(budgets))
+	for _, b := range budgets {
+		b.mu.Lock()
+		result = append(result, b.RateBudget)
+		b.mu.Unlock()
 	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Remaining < result[j].Remaining })
+	return result
+}
 
-	branch := defaultBranch
-	if branch == "" {
-		branch = "main"
+// sleepContext waits for d, returning early with ctx's error if ctx ends first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	var fileCount, dirCount int
-	filesByExt := make(map[string]int)
-	dirFileCounts := make(map[string]int)
+// acquire reserves one call, sleeping until the window resets when the budget
+// is nearly spent. It gives up if the reset is further away than maxRateLimitWait
+// or ctx ends while waiting.
+func (b *rateBudgetTracker) acquire(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	tree, err := client.GetFileTree(owner, repo, branch)
-	if err != nil {
-		log.Printf("[Analysis] Warning: Failed to fetch tree: %v", err)
-	} else {
-		for _, node := range tree.Tree {
-			switch node.Type {
-			case "blob":
-				fileCount++
-				ext := ""
-				if idx := strings.LastIndex(node.Path, "."); idx != -1 {
-					ext = node.Path[idx:]
-				}
-				filesByExt[ext]++
+	if !b.Known {
+		return nil
+	}
 
-				parts := strings.Split(node.Path, "/")
-				if len(parts) > 1 {
-					dirFileCounts[parts[0]]++
-				}
-			case "tree":
-				dirCount++
+	if b.Remaining <= rateLimitReserve {
+		wait := time.Until(b.ResetAt) + time.Second
+		if wait > 0 {
+			if wait > maxRateLimitWait {
+				return fmt.Errorf("rate limit exhausted (%d remaining), resets at %s", b.Remaining, b.ResetAt.Format(time.RFC3339))
+			}
+			log.Printf("[GitHub API] Rate limit nearly spent (%d remaining), pausing %v", b.Remaining, wait.Round(time.Second))
+			b.mu.Unlock()
+			err := sleepContext(ctx, wait)
+			b.mu.Lock()
+			if err != nil {
+				return err
 			}
 		}
+		// A new window has started; trust the next response's headers
+		if time.Now().After(b.ResetAt) {
+			b.Known = false
+			return nil
+		}
 	}
 
-	var topDirs []DirectoryInfo
-	for dir, count := range dirFileCounts {
-		topDirs = append(topDirs, DirectoryInfo{Path: dir, FileCount: count})
-	}
-	sort.Slice(topDirs, func(i, j int) bool {
-		return topDirs[i].FileCount > topDirs[j].FileCount
-	})
-	if len(topDirs) > 10 {
-		topDirs = topDirs[:10]
+	b.Remaining--
+	return nil
+}
+
+// update records the X-RateLimit-* headers of a response
+func (b *rateBudgetTracker) update(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
 	}
 
-	var dependencies []DependencyDetail
-	depCount := 0
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	if content, err := client.GetFileContent(owner, repo, "package.json"); err == nil && content != nil {
-		var pkg struct {
-			Dependencies    map[string]string `json:"dependencies"`
-			DevDependencies map[string]string `json:"devDependencies"`
-		}
-		if json.Unmarshal(content, &pkg) == nil {
-			for name, version := range pkg.Dependencies {
-				dependencies = append(dependencies, DependencyDetail{Name: name, Version: version, Type: "production"})
-				depCount++
-			}
-			for name, version := range pkg.DevDependencies {
-				dependencies = append(dependencies, DependencyDetail{Name: name, Version: version, Type: "development"})
-				depCount++
-			}
-		}
+	b.Known = true
+	b.Remaining = remaining
+	b.Limit, _ = strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	b.Used, _ = strconv.Atoi(header.Get("X-RateLimit-Used"))
+	b.Resource = header.Get("X-RateLimit-Resource")
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		b.ResetAt = time.Unix(reset, 0)
 	}
+}
 
-	if content, err := client.GetFileContent(owner, repo, "requirements.txt"); err == nil && content != nil {
-		lines := strings.Split(string(content), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
-			re := regexp.MustCompile(`^([a-zA-Z0-9_-]+)([><=!]+)?(.*)$`)
-			if matches := re.FindStringSubmatch(line); matches != nil {
-				dependencies = append(dependencies, DependencyDetail{
-					Name:    matches[1],
-					Version: strings.TrimSpace(matches[3]),
-					Type:    "production",
-				})
-				depCount++
-			}
-		}
+// rateLimitBackoff decides whether a response was rate limited and how long to
+// wait before retrying. Plain permission 403s are not rate limits.
+func rateLimitBackoff(status int, header http.Header, body []byte, attempt int) (time.Duration, bool) {
+	if status != 403 && status != 429 {
+		return 0, false
 	}
 
-	if content, err := client.GetFileContent(owner, repo, "go.mod"); err == nil && content != nil {
-		lines := strings.Split(string(content), "\n")
-		inRequire := false
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if strings.HasPrefix(line, "require (") {
-				inRequire = true
-				continue
-			}
-			if line == ")" {
-				inRequire = false
-				continue
-			}
-			if inRequire || strings.HasPrefix(line, "require ") {
-				parts := strings.Fields(strings.TrimPrefix(line, "require "))
-				if len(parts) >= 2 {
-					dependencies = append(dependencies, DependencyDetail{
-						Name:    parts[0],
-						Version: parts[1],
-						Type:    "production",
-					})
-					depCount++
-				}
-			}
+	if secs, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Until(time.Unix(reset, 0)) + time.Second, true
 		}
 	}
 
-	commitTimeline := make(map[string]int)
-	now := time.Now()
-	thirtyDaysAgo := now.AddDate(0, 0, -30)
-	commitsLast30 := 0
+	// Secondary limits without Retry-After: back off 15s, 30s, 60s
+	if status == 429 || bytes.Contains(bytes.ToLower(body), []byte("secondary rate limit")) {
+		return time.Duration(1<<attempt) * 15 * time.Second, true
+	}
+	return 0, false
+}
 
-	var recentCommits []CommitSummary
-	for i, c := range commits {
-		dateStr := c.Commit.Author.Date.Format("2006-01-02")
-		commitTimeline[dateStr]++
+// ==================== RESPONSE CACHE ====================
 
-		if c.Commit.Author.Date.After(thirtyDaysAgo) {
-			commitsLast30++
-		}
+// responseCache stores GitHub API bodies on disk keyed by credential scope and
+// URL, so a response is only served back to the credential that fetched it.
+// Entries with an
+// ETag or Last-Modified are revalidated with conditional requests (a 304 does
+// not count against the rate limit); immutable objects are served without
+// contacting GitHub at all.
+type responseCache struct {
+	dir string
+}
 
-		if i < 10 {
-			message := c.Commit.Message
-			if len(message) > 80 {
-				message = message[:80] + "..."
-			}
+type cachedResponse struct {
+	Scope        string    `json:"scope"` // Credential that fetched the response; see GitHubClient.cacheScope
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Link         string    `json:"link,omitempty"` // Pagination header, replayed with the body
+	Immutable    bool      `json:"immutable"`
+	StoredAt     time.Time `json:"storedAt"`
+	Body         []byte    `json:"body"`
+}
 
-			// Intent classification for recent commits
-			// We try to get files for the most recent to be more accurate
-			files, _ := client.GetCommitFiles(owner, repo, c.SHA)
-			intent, conf, signal := classifyCommitIntent(c.Commit.Message, files)
-
-			recentCommits = append(recentCommits, CommitSummary{
-				SHA:              c.SHA[:7],
-				Message:          message,
-				Author:           c.Commit.Author.Name,
-				Date:             c.Commit.Author.Date,
-				Intent:           intent,
-				Confidence:       conf,
-				TriggeringSignal: signal,
-			})
-		}
+// header rebuilds the response headers callers rely on
+func (cr *cachedResponse) header() http.Header {
+	header := make(http.Header)
+	if cr.Link != "" {
+		header.Set("Link", cr.Link)
 	}
+	return header
+}
 
-	var timelineSlice []CommitTimelinePoint
-	for date, count := range commitTimeline {
-		timelineSlice = append(timelineSlice, CommitTimelinePoint{Date: date, Count: count})
-	}
-	sort.Slice(timelineSlice, func(i, j int) bool {
-		return timelineSlice[i].Date < timelineSlice[j].Date
-	})
+// immutablePathRe matches objects addressed by a full SHA, whose content never changes
+var immutablePathRe = regexp.MustCompile(`^/repos/[^/]+/[^/]+/(commits|git/trees)/[0-9a-f]{40}(\?|$)`)
 
-	repoAge := int(now.Sub(repoData.UpdatedAt).Hours() / 24 / 30)
-	daysSincePush := int(now.Sub(repoData.PushedAt).Hours() / 24)
+var githubResponseCache *responseCache // nil disables caching
 
-	activityScore := float64(commitsLast30) / 10.0
-	if activityScore > 10 {
-		activityScore = 10
+func newResponseCache(dir string) (*responseCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
 	}
+	return &responseCache{dir: dir}, nil
+}
 
-	stalenessScore := float64(daysSincePush) / 30.0
+func (rc *responseCache) file(scope, url string) string {
+	sum := sha256.Sum256([]byte(scope + "\n" + url))
+	return filepath.Join(rc.dir, fmt.Sprintf("%x.json", sum))
+}
 
-	teamRiskScore := 1.0
-	if len(contributors) > 0 {
-		teamRiskScore = 1.0 / float64(len(contributors))
+func (rc *responseCache) get(scope, url string) *cachedResponse {
+	if rc == nil {
+		return nil
+	}
+	data, err := os.ReadFile(rc.file(scope, url))
+	if err != nil {
+		return nil
 	}
+	var entry cachedResponse
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Scope != scope || entry.URL != url {
+		return nil
+	}
+	return &entry
+}
 
-	trend := "stable"
-	if commitsLast30 > 10 {
-		trend = "active"
-	} else if commitsLast30 < 3 {
-		trend = "declining"
+// put stores a 200 response if it can be revalidated or never changes
+func (rc *responseCache) put(scope, url, path string, header http.Header, body []byte) {
+	if rc == nil {
+		return
+	}
+	entry := cachedResponse{
+		Scope:        scope,
+		URL:          url,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Link:         header.Get("Link"),
+		Immutable:    immutablePathRe.MatchString(path),
+		StoredAt:     time.Now(),
+		Body:         body,
+	}
+	if entry.ETag == "" && entry.LastModified == "" && !entry.Immutable {
+		return
 	}
 
-	analysis := &RepoAnalysis{
-		FetchedAt:         now,
-		RepoAgeMonths:     repoAge,
-		DaysSinceLastPush: daysSincePush,
-		TotalCommits:      len(commits),
-		CommitsLast30Days: commitsLast30,
-		CommitsTrend:      trend,
-		ContributorCount:  len(contributors),
-		DependencyCount:   depCount,
-		FileCount:         fileCount,
-		DirectoryCount:    dirCount,
-		TopDirectories:    topDirs,
-		Dependencies:      dependencies,
-		RecentCommits:     recentCommits,
-		CommitTimeline:    timelineSlice,
-		CommitActivity:    activity,
-		FilesByExtension:  filesByExt,
-		ActivityScore:     activityScore,
-		StalenessScore:    stalenessScore,
-		TeamRiskScore:     teamRiskScore,
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// Write then rename so concurrent readers never see a partial entry
+	tmp, err := os.CreateTemp(rc.dir, "entry-*")
+	if err != nil {
+		log.Printf("[Cache] Failed to store %s: %v", path, err)
+		return
+	}
+	_, werr := tmp.Write(data)
+	cerr := tmp.Close()
+	if werr != nil || cerr != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), rc.file(scope, url)); err != nil {
+		os.Remove(tmp.Name())
 	}
+}
 
-	// Compute Risk Trajectory from real GitHub stats
-	trajectory := analyzeTrajectory(client, owner, repo)
-	analysis.Trajectory = trajectory
+// ==================== FIXTURE RECORDING & REPLAY ====================
 
-	topology := analyzeTopology(tree)
-	impact := analyzeImpact(topology, tree)
-	analysis.Impact = impact
+// githubFixture is one recorded GitHub API exchange. GitHubClient writes them
+// when GITHUB_RECORD_DIR is set; the replay handler serves them back so the
+// whole server can run offline against a recorded session.
+type githubFixture struct {
+	Path   string `json:"path"` // Request path and query, relative to the API root
+	Status int    `json:"status"`
+	Link   string `json:"link,omitempty"` // Pagination header with the API root stripped
+	Body   string `json:"body"`
+}
 
-	// Compute Change Concentration from commit diffs
-	concentration := analyzeConcentration(client, owner, repo)
-	analysis.Concentration = concentration
+type fixtureRecorder struct {
+	dir string
+}
 
-	// Compute Real Dependency Graph from import statements
-	deps := analyzeDependencies(client, owner, repo, tree, concentration)
-	analysis.Deps = deps
+var githubFixtureRecorder *fixtureRecorder // nil disables recording
 
-	// Compute Temporal Hotspots from commit timestamps and diffs
-	temporal := analyzeTemporal(client, owner, repo)
-	analysis.Temporal = temporal
+func newFixtureRecorder(dir string) (*fixtureRecorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &fixtureRecorder{dir: dir}, nil
+}
 
-	// Bus Factor Deepening - Joins authorship with criticality
-	busFactor := analyzeBusFactor(client, owner, repo, deps, concentration)
-	analysis.BusFactor = busFactor
+var fixtureNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
 
-	// Embed into concentration for frontend consumption in Team View
-	if concentration != nil {
-		concentration.OwnershipRisk = busFactor
+// fixtureFile names a fixture after its path so recordings diff readably, with
+// a hash suffix to keep apart paths that sanitize alike
+func fixtureFile(path string) string {
+	name := strings.Trim(fixtureNameRe.ReplaceAllString(path, "_"), "_")
+	if len(name) > 120 {
+		name = name[:120]
 	}
+	sum := sha256.Sum256([]byte(path))
+	return fmt.Sprintf("%s-%x.json", name, sum[:4])
+}
 
-	// Documentation Drift Analysis
-	docDrift := analyzeDocDrift(client, owner, repo)
-	analysis.DocDrift = docDrift
-
-	// Commit Intent Classification
-	intentAnalysis := analyzeCommitIntents(client, owner, repo, commits)
-	analysis.IntentAnalysis = intentAnalysis
+// record writes one response; a later response for the same path replaces it
+func (fr *fixtureRecorder) record(baseURL, path string, status int, header http.Header, body []byte) {
+	if fr == nil {
+		return
+	}
+	fixture := githubFixture{
+		Path:   path,
+		Status: status,
+		Link:   strings.ReplaceAll(header.Get("Link"), baseURL, ""),
+		Body:   string(body),
+	}
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(fr.dir, fixtureFile(path)), data, 0600); err != nil {
+		log.Printf("[Record] Failed to store %s: %v", path, err)
+	}
+}
 
-	// Structural Depth Analysis
-	structuralDepth := analyzeStructuralDepth(tree.Tree)
-	analysis.StructuralDepth = structuralDepth
+// fixtureTimeParams carry the wall clock, so their values never repeat
+// between a recording and its replay
+var fixtureTimeParams = []string{"since", "until"}
 
-	// Activity Volatility Analysis
-	volatility := analyzeActivityVolatility(commits)
-	analysis.Volatility = volatility
+// undatedPath drops the time parameters from path and orders the rest
+func undatedPath(path string) string {
+	u, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+	q := u.Query()
+	for _, p := range fixtureTimeParams {
+		q.Del(p)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
 
-	// Test Surface Ratio Analysis
-	testSurface := analyzeTestSurface(tree.Tree, dependencies)
-	analysis.TestSurface = testSurface
+// fixtureReplayHandler serves a fixture directory as a GitHub API root, at /
+// or at the /api/v3 prefix GitHub Enterprise clients use. A request matches
+// the fixture recorded for its exact path and query, or else one recorded for
+// the same path with different since/until values.
+type fixtureReplayHandler struct {
+	exact   map[string]*githubFixture
+	undated map[string]*githubFixture
+}
 
-	// Privacy & Security Signal Consistency Check
-	securityAnalysis := analyzeSecurityConsistency(client, owner, repo, tree.Tree, dependencies)
-	analysis.SecurityAnalysis = securityAnalysis
+func newFixtureReplayHandler(dir string) (*fixtureReplayHandler, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
 
-	log.Printf("[Analysis] Complete: %d files, %d commits, %d deps", fileCount, len(commits), depCount)
-	return analysis, nil
+	h := &fixtureReplayHandler{
+		exact:   make(map[string]*githubFixture),
+		undated: make(map[string]*githubFixture),
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var fixture githubFixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("invalid fixture %s: %v", entry.Name(), err)
+		}
+		h.exact[fixture.Path] = &fixture
+		if key := undatedPath(fixture.Path); h.undated[key] == nil {
+			h.undated[key] = &fixture
+		}
+	}
+	log.Printf("[Replay] Loaded %d fixtures from %s", len(h.exact), dir)
+	return h, nil
 }
 
-// ==================== RISK TRAJECTORY ANALYSIS ====================
+func (h *fixtureReplayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := ""
+	path := r.URL.RequestURI()
+	if strings.HasPrefix(path, "/api/v3/") {
+		prefix = "/api/v3"
+		path = strings.TrimPrefix(path, prefix)
+	}
 
-// analyzeTrajectory computes risk trajectory from real GitHub stats API
-// Returns weekly snapshots of risk scores computed from commit activity and code churn
-func analyzeTrajectory(client *GitHubClient, owner, repo string) *TrajectoryAnalysis {
-	log.Printf("[Trajectory] Starting trajectory analysis for %s/%s", owner, repo)
+	fixture, ok := h.exact[path]
+	if !ok {
+		fixture, ok = h.undated[undatedPath(path)]
+	}
+	if !ok {
+		log.Printf("[Replay] No fixture for %s", path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		w.Write([]byte(`{"message":"Not Found (no fixture recorded)"}`))
+		return
+	}
 
-	// Parallel fetch: commit activity and code frequency
-	var wg sync.WaitGroup
-	var commitActivity []CommitActivityWeek
-	var codeFrequency []CodeFrequencyWeek
-	var errActivity, errFrequency error
+	if fixture.Link != "" {
+		w.Header().Set("Link", strings.ReplaceAll(fixture.Link, "</", "<http://"+r.Host+prefix+"/"))
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(fixture.Status)
+	w.Write([]byte(fixture.Body))
+}
 
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		commitActivity, errActivity = client.GetCommitActivity(owner, repo)
-	}()
+// startFixtureReplay serves dir on addr in the background and returns the API
+// root to point GitHub clients at
+func startFixtureReplay(dir, addr string) (string, error) {
+	handler, err := newFixtureReplayHandler(dir)
+	if err != nil {
+		return "", err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
 	go func() {
-		defer wg.Done()
-		codeFrequency, errFrequency = client.GetCodeFrequency(owner, repo)
+		log.Fatal(http.Serve(listener, handler))
 	}()
-	wg.Wait()
+	return "http://" + listener.Addr().String(), nil
+}
 
-	if errActivity != nil {
-		log.Printf("[Trajectory] Warning: Failed to fetch commit activity: %v", errActivity)
-		return &TrajectoryAnalysis{
-			Available: false,
-			Reason:    "Failed to fetch commit activity",
-			Snapshots: make([]TrajectorySnapshot, 0),
-		}
+// ==================== GITHUB API CLIENT ====================
+
+type GitHubClient struct {
+	baseURL    string
+	token      string
+	app        *GitHubAppAuth      // When set, requests use the installation token of the repo owner
+	oauth      *GitHubOAuthSession // When set, requests use the device flow user token
+	connection string              // Registry ID; keeps each account's rate limit budgets apart
+	httpClient *http.Client
+}
+
+const defaultGitHubAPIURL = "https://api.github.com"
+
+// NewGitHubClient creates a client for github.com, or for a GitHub Enterprise
+// Server instance when baseURL points at its API root
+func NewGitHubClient(baseURL, token string) *GitHubClient {
+	return &GitHubClient{
+		baseURL:    normalizeGitHubAPIURL(baseURL),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
 	}
+}
 
-	if errFrequency != nil {
-		log.Printf("[Trajectory] Warning: Failed to fetch code frequency: %v", errFrequency)
-		// Continue without code frequency data
-		codeFrequency = []CodeFrequencyWeek{}
+// normalizeGitHubAPIURL accepts either the API root or the bare web host:
+// https://github.com maps to the public API, https://ghe.example.com becomes
+// https://ghe.example.com/api/v3
+func normalizeGitHubAPIURL(baseURL string) string {
+	baseURL = strings.TrimSuffix(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		return defaultGitHubAPIURL
 	}
 
-	if len(commitActivity) == 0 {
-		return &TrajectoryAnalysis{
-			Available: false,
-			Reason:    "GitHub is computing repository statistics. Please try again in a few moments.",
-			Snapshots: make([]TrajectorySnapshot, 0),
-		}
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return baseURL
+	}
+	switch strings.ToLower(parsed.Host) {
+	case "github.com", "www.github.com":
+		return defaultGitHubAPIURL
+	case "api.github.com":
+		return baseURL
 	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		return baseURL + "/api/v3"
+	}
+	return baseURL
+}
 
-	// Create code frequency lookup by week timestamp
-	codeFreqMap := make(map[int64]CodeFrequencyWeek)
-	for _, cf := range codeFrequency {
-		codeFreqMap[int64(cf.Week)] = cf
+// NewGitHubAppClient creates a client that authenticates with installation tokens
+func NewGitHubAppClient(app *GitHubAppAuth) *GitHubClient {
+	client := NewGitHubClient(app.baseURL, "")
+	client.app = app
+	return client
+}
+
+// tokenFor picks the credential for a request path: the installation token of
+// the repository owner in app mode, the personal token otherwise. The second
+// value names the rate limit budget that credential draws from.
+func (c *GitHubClient) tokenFor(ctx context.Context, path string) (string, string, error) {
+	token, budgetKey, err := c.credentialFor(ctx, path)
+	if c.connection != "" {
+		budgetKey = c.connection + "/" + budgetKey
 	}
+	return token, budgetKey, err
+}
 
-	// Calculate baseline metrics
-	totalCommits := 0
-	totalChurn := 0
-	activeWeeks := 0
-	for _, week := range commitActivity {
-		totalCommits += week.Total
-		if week.Total > 0 {
-			activeWeeks++
-		}
-		if cf, ok := codeFreqMap[week.Week]; ok {
-			totalChurn += abs(cf.Additions) + abs(cf.Deletions)
-		}
+func (c *GitHubClient) credentialFor(ctx context.Context, path string) (string, string, error) {
+	if c.oauth != nil {
+		token, err := c.oauth.Token(ctx)
+		return token, "token", err
+	}
+	if c.app == nil {
+		return c.token, "token", nil
 	}
+	if !strings.HasPrefix(path, "/repos/") {
+		return "", "app", nil
+	}
+	owner := strings.SplitN(strings.TrimPrefix(path, "/repos/"), "/", 2)[0]
+	token, err := c.app.TokenForOwner(ctx, owner)
+	return token, "installation:" + strings.ToLower(owner), err
+}
 
-	if activeWeeks == 0 {
-		return &TrajectoryAnalysis{
-			Available: false,
-			Reason:    "No active weeks in history",
-			Snapshots: make([]TrajectorySnapshot, 0),
-		}
+// request performs a GET, waiting out rate limits: it pauses when the tracked
+// budget is nearly spent and retries 403/429 rate limit responses with backoff.
+// A response that is still limited after the retries is returned as-is.
+// Cached immutable objects are returned without a request; other cached
+// entries are revalidated and a 304 is answered from the cache.
+func (c *GitHubClient) request(ctx context.Context, path string) ([]byte, int, error) {
+	body, status, _, err := c.requestWithHeader(ctx, path)
+	return body, status, err
+}
+
+// requestWithHeader is request for callers that need response headers (Link pagination)
+func (c *GitHubClient) requestWithHeader(ctx context.Context, path string) ([]byte, int, http.Header, error) {
+	body, status, header, err := c.fetch(ctx, path)
+	if err == nil {
+		githubFixtureRecorder.record(c.baseURL, path, status, header, body)
 	}
+	return body, status, header, err
+}
 
-	avgCommitsPerWeek := float64(totalCommits) / float64(len(commitActivity))
-	avgChurnPerWeek := float64(totalChurn) / float64(len(commitActivity))
-	if avgChurnPerWeek == 0 {
-		avgChurnPerWeek = 1 // Prevent division by zero
+// fetch answers a request from the response cache or GitHub, handling rate limits
+func (c *GitHubClient) fetch(ctx context.Context, path string) ([]byte, int, http.Header, error) {
+	token, budgetKey, err := c.tokenFor(ctx, path)
+	if err != nil {
+		return nil, 0, nil, err
 	}
 
-	// Build trajectory snapshots
-	snapshots := make([]TrajectorySnapshot, 0)
-	var previousRisk float64
-	peakRiskScore := 0.0
-	peakRiskWeek := ""
+	url := c.baseURL + path
+	scope := c.cacheScope(token, budgetKey)
+	cached := githubResponseCache.get(scope, url)
+	if cached != nil && cached.Immutable {
+		log.Printf("[GitHub API] GET %s (cached)", path)
+		return cached.Body, 200, cached.header(), nil
+	}
+	budget := rateBudgetFor(budgetKey)
 
-	for _, week := range commitActivity {
-		weekTime := time.Unix(week.Week, 0)
-		weekStart := weekTime.Format("2006-01-02")
-		_, weekNum := weekTime.ISOWeek()
-		dateLabel := fmt.Sprintf("%d-W%02d", weekTime.Year(), weekNum)
+	for attempt := 0; ; attempt++ {
+		if err := budget.acquire(ctx); err != nil {
+			return nil, 0, nil, err
+		}
 
-		// Get code frequency for this week
-		additions := 0
-		deletions := 0
-		if cf, ok := codeFreqMap[week.Week]; ok {
-			additions = abs(cf.Additions)
-			deletions = abs(cf.Deletions)
+		body, status, header, err := c.do(ctx, path, token, cached)
+		if err != nil {
+			return nil, status, header, err
 		}
+		budget.update(header)
 
-		churnScore := float64(additions + deletions)
+		if status == 304 && cached != nil {
+			return cached.Body, 200, cached.header(), nil
+		}
+		if status == 200 {
+			githubResponseCache.put(scope, url, path, header, body)
+		}
 
-		// Compute risk score:
+		wait, limited := rateLimitBackoff(status, header, body, attempt)
+		if !limited {
+			return body, status, header, nil
+		}
+		if attempt >= maxRateLimitRetries || wait > maxRateLimitWait {
+			log.Printf("[GitHub API] Rate limited on %s, giving up after %d attempts", path, attempt+1)
+			return body, status, header, nil
+		}
+
+		log.Printf("[GitHub API] Rate limited on %s (%d), retrying in %v", path, status, wait.Round(time.Second))
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, 0, nil, err
+		}
+	}
+}
+
+// cacheScope names the credential a response was fetched with. Installation
+// and OAuth tokens rotate, so those are scoped by app or connection and owner;
+// a personal token is scoped by a fingerprint of the token itself.
+func (c *GitHubClient) cacheScope(token, budgetKey string) string {
+	switch {
+	case c.app != nil:
+		return fmt.Sprintf("app:%d@%s/%s", c.app.appID, c.app.baseURL, budgetKey)
+	case c.oauth != nil && c.connection != "":
+		return "oauth:" + budgetKey
+	}
+	sum := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("%s/%x", budgetKey, sum[:8])
+}
+
+func (c *GitHubClient) do(ctx context.Context, path, token string, cached *cachedResponse) ([]byte, int, http.Header, error) {
+	url := c.baseURL + path
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", "RepoAnalyst-App")
+
+	log.Printf("[GitHub API] GET %s", path)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, resp.Header, err
+	}
+
+	log.Printf("[GitHub API] Response: %d (%d bytes)", resp.StatusCode, len(body))
+	return body, resp.StatusCode, resp.Header, nil
+}
+
+// RefreshRateLimit queries /rate_limit, which does not count against the
+// budget, so the tracked budget reflects GitHub's view
+func (c *GitHubClient) RefreshRateLimit(ctx context.Context) error {
+	_, status, err := c.request(ctx, "/rate_limit")
+	if err != nil {
+		return err
+	}
+	if status != 200 {
+		return fmt.Errorf("failed to fetch rate limit: %d", status)
+	}
+	return nil
+}
+
+func (c *GitHubClient) GetAuthenticatedUser(ctx context.Context) (*GitHubUser, error) {
+	if c.app != nil {
+		return c.app.Identity(ctx)
+	}
+
+	body, status, err := c.request(ctx, "/user")
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("authentication failed: %d", status)
+	}
+
+	var user GitHubUser
+	if err := json.Unmarshal(body, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *GitHubClient) ListUserRepos(ctx context.Context) ([]GitHubRepoListing, error) {
+	if c.app != nil {
+		return c.app.ListRepos(ctx)
+	}
+	return c.listRepos(ctx, "/user/repos", "&sort=updated")
+}
+
+// ListOrgRepos lists an organization's repos visible to the credential. In
+// app mode that is the installation's repos owned by the organization.
+func (c *GitHubClient) ListOrgRepos(ctx context.Context, org string) ([]GitHubRepoListing, error) {
+	if c.app != nil {
+		repos, err := c.app.ListRepos(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var owned []GitHubRepoListing
+		for _, repo := range repos {
+			if strings.EqualFold(repo.Owner.Login, org) {
+				owned = append(owned, repo)
+			}
+		}
+		return owned, nil
+	}
+	return c.listRepos(ctx, "/orgs/"+url.PathEscape(org)+"/repos", "&sort=updated&type=all")
+}
+
+// ListTeamRepos lists the repos a team of org has access to
+func (c *GitHubClient) ListTeamRepos(ctx context.Context, org, team string) ([]GitHubRepoListing, error) {
+	if c.app != nil {
+		return nil, fmt.Errorf("team discovery needs a user token, not a GitHub App")
+	}
+	return c.listRepos(ctx, "/orgs/"+url.PathEscape(org)+"/teams/"+url.PathEscape(team)+"/repos", "")
+}
+
+// listRepos pages through a repository listing; query holds extra parameters
+func (c *GitHubClient) listRepos(ctx context.Context, listPath, query string) ([]GitHubRepoListing, error) {
+	var allRepos []GitHubRepoListing
+	page := 1
+
+	for {
+		body, status, err := c.request(ctx, fmt.Sprintf("%s?per_page=100&page=%d%s", listPath, page, query))
+		if err != nil {
+			return nil, err
+		}
+		if status != 200 {
+			return nil, fmt.Errorf("failed to list repos: %d", status)
+		}
+
+		var repos []GitHubRepoListing
+		if err := json.Unmarshal(body, &repos); err != nil {
+			return nil, err
+		}
+
+		if len(repos) == 0 {
+			break
+		}
+
+		allRepos = append(allRepos, repos...)
+		page++
+
+		if len(repos) < 100 {
+			break
+		}
+	}
+
+	return allRepos, nil
+}
+
+func (c *GitHubClient) GetRepository(ctx context.Context, owner, repo string) (*GitHubRepoListing, error) {
+	body, status, err := c.request(ctx, fmt.Sprintf("/repos/%s/%s", owner, repo))
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("repo not found: %d", status)
+	}
+
+	var repoData GitHubRepoListing
+	if err := json.Unmarshal(body, &repoData); err != nil {
+		return nil, err
+	}
+	return &repoData, nil
+}
+
+func (c *GitHubClient) GetCommits(ctx context.Context, owner, repo string, limit int) ([]GitHubCommit, error) {
+	body, status, err := c.request(ctx, fmt.Sprintf("/repos/%s/%s/commits?per_page=%d", owner, repo, limit))
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("failed to fetch commits: %d", status)
+	}
+
+	var commits []GitHubCommit
+	if err := json.Unmarshal(body, &commits); err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+// linkNextRe extracts the rel="next" URL from a Link header
+var linkNextRe = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// CommitIterator walks a commit listing page by page, following Link headers
+type CommitIterator struct {
+	ctx    context.Context
+	client *GitHubClient
+	next   string // Path of the next page, empty when exhausted
+	page   []GitHubCommit
+}
+
+// IterateCommits returns an iterator over commits matching q, newest first.
+// q.Limit is not applied here; callers stop when they have enough.
+func (c *GitHubClient) IterateCommits(ctx context.Context, owner, repo string, q CommitQuery) *CommitIterator {
+	params := url.Values{}
+	params.Set("per_page", "100")
+	if !q.Since.IsZero() {
+		params.Set("since", q.Since.UTC().Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		params.Set("until", q.Until.UTC().Format(time.RFC3339))
+	}
+	if q.Path != "" {
+		params.Set("path", q.Path)
+	}
+	if q.Author != "" {
+		params.Set("author", q.Author)
+	}
+	if q.Ref != "" {
+		params.Set("sha", q.Ref)
+	}
+	return &CommitIterator{ctx: ctx, client: c, next: fmt.Sprintf("/repos/%s/%s/commits?%s", owner, repo, params.Encode())}
+}
+
+// Next returns the next commit, or nil when the listing is exhausted
+func (it *CommitIterator) Next() (*GitHubCommit, error) {
+	for len(it.page) == 0 {
+		if it.next == "" {
+			return nil, nil
+		}
+
+		body, status, header, err := it.client.requestWithHeader(it.ctx, it.next)
+		if err != nil {
+			return nil, err
+		}
+		if status == 409 {
+			return nil, nil // Empty repository
+		}
+		if status != 200 {
+			return nil, fmt.Errorf("failed to fetch commits: %d", status)
+		}
+
+		var commits []GitHubCommit
+		if err := json.Unmarshal(body, &commits); err != nil {
+			return nil, err
+		}
+		it.page = commits
+		it.next = ""
+		if m := linkNextRe.FindStringSubmatch(header.Get("Link")); m != nil {
+			it.next = strings.TrimPrefix(m[1], it.client.baseURL)
+		}
+	}
+
+	commit := it.page[0]
+	it.page = it.page[1:]
+	return &commit, nil
+}
+
+func (c *GitHubClient) ListCommits(ctx context.Context, owner, repo string, q CommitQuery) ([]GitHubCommit, error) {
+	it := c.IterateCommits(ctx, owner, repo, q)
+	var commits []GitHubCommit
+	for q.Limit <= 0 || len(commits) < q.Limit {
+		commit, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		if commit == nil {
+			break
+		}
+		commits = append(commits, *commit)
+	}
+	return commits, nil
+}
+
+func (c *GitHubClient) GetContributors(ctx context.Context, owner, repo string) ([]GitHubContributor, error) {
+	body, status, err := c.request(ctx, fmt.Sprintf("/repos/%s/%s/contributors?per_page=100", owner, repo))
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("failed to fetch contributors: %d", status)
+	}
+
+	var contributors []GitHubContributor
+	if err := json.Unmarshal(body, &contributors); err != nil {
+		return nil, err
+	}
+	return contributors, nil
+}
+
+func (c *GitHubClient) GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error) {
+	return c.GetFileContentAt(ctx, owner, repo, path, "")
+}
+
+// GetFileContentAt reads path as of ref; an empty ref reads the default branch
+func (c *GitHubClient) GetFileContentAt(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	endpoint := fmt.Sprintf("/repos/%s/%s/contents/%s", owner, repo, path)
+	if ref != "" {
+		endpoint += "?ref=" + url.QueryEscape(ref)
+	}
+	body, status, err := c.request(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if status == 404 {
+		return nil, nil
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("failed to fetch file: %d", status)
+	}
+
+	var content GitHubContent
+	if err := json.Unmarshal(body, &content); err != nil {
+		return nil, err
+	}
+
+	if content.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(content.Content)
+		if err != nil {
+			return nil, err
+		}
+		return decoded, nil
+	}
+	return []byte(content.Content), nil
+}
+
+func (c *GitHubClient) GetFileTree(ctx context.Context, owner, repo, branch string) (*GitHubTreeResponse, error) {
+	body, status, err := c.request(ctx, fmt.Sprintf("/repos/%s/%s/git/trees/%s?recursive=1", owner, repo, branch))
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("failed to fetch tree: %d", status)
+	}
+
+	var tree GitHubTreeResponse
+	if err := json.Unmarshal(body, &tree); err != nil {
+		return nil, err
+	}
+
+	if tree.Truncated {
+		log.Printf("[GitHub API] Tree for %s/%s truncated at %d entries, walking subtrees", owner, repo, len(tree.Tree))
+		return c.walkTree(ctx, owner, repo, tree.SHA), nil
+	}
+	return &tree, nil
+}
+
+// treeWalkConcurrency bounds in-flight directory listings during walkTree
+const treeWalkConcurrency = 8
+
+// walkTree assembles the full tree by listing each directory non-recursively.
+// Directories that cannot be listed leave the result Truncated, with
+// Completeness set to the fraction of directories that were listed.
+func (c *GitHubClient) walkTree(ctx context.Context, owner, repo, rootSHA string) *GitHubTreeResponse {
+	result := &GitHubTreeResponse{SHA: rootSHA, Tree: make([]GitHubTreeNode, 0)}
+	listed, failed := 0, 0
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, treeWalkConcurrency)
+
+	var walk func(sha, prefix string)
+	walk = func(sha, prefix string) {
+		defer wg.Done()
+
+		sem <- struct{}{}
+		body, status, err := c.request(ctx, fmt.Sprintf("/repos/%s/%s/git/trees/%s", owner, repo, sha))
+		<-sem
+
+		var level GitHubTreeResponse
+		if err == nil && status != 200 {
+			err = fmt.Errorf("failed to fetch tree: %d", status)
+		}
+		if err == nil {
+			err = json.Unmarshal(body, &level)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			log.Printf("[GitHub API] Subtree %q unavailable: %v", prefix, err)
+			failed++
+			return
+		}
+		// A single directory over GitHub's listing limit is kept but counted as partial
+		if level.Truncated {
+			failed++
+		} else {
+			listed++
+		}
+
+		for _, node := range level.Tree {
+			node.Path = prefix + node.Path
+			result.Tree = append(result.Tree, node)
+			if node.Type == "tree" {
+				wg.Add(1)
+				go walk(node.SHA, node.Path+"/")
+			}
+		}
+	}
+
+	wg.Add(1)
+	go walk(rootSHA, "")
+	wg.Wait()
+
+	sort.Slice(result.Tree, func(i, j int) bool { return result.Tree[i].Path < result.Tree[j].Path })
+	if failed > 0 {
+		result.Truncated = true
+		result.Completeness = float64(listed) / float64(listed+failed)
+	}
+	log.Printf("[GitHub API] Walked %d directories (%d incomplete), %d entries", listed+failed, failed, len(result.Tree))
+	return result
+}
+
+// GitHub Stats API - returns weekly commit counts for last 52 weeks
+// Note: GitHub returns 202 when stats are being computed for the first time
+func (c *GitHubClient) GetCommitActivity(ctx context.Context, owner, repo string) ([]CommitActivityWeek, error) {
+	maxRetries := 5
+	var body []byte
+	var status int
+	var err error
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		body, status, err = c.request(ctx, fmt.Sprintf("/repos/%s/%s/stats/commit_activity", owner, repo))
+		if err != nil {
+			return nil, err
+		}
+
+		if status == 200 {
+			break
+		}
+
+		// Empty repositories (and some GHES instances with stats disabled) answer 204
+		if status == 204 {
+			return []CommitActivityWeek{}, nil
+		}
+
+		// GitHub returns 202 when stats are being computed
+		if status == 202 {
+			waitTime := time.Duration(2+attempt) * time.Second // Progressive backoff: 2s, 3s, 4s, 5s, 6s
+			log.Printf("[GitHub Stats] Commit activity is being computed (attempt %d/%d), waiting %v...", attempt+1, maxRetries, waitTime)
+			if err := sleepContext(ctx, waitTime); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Other error status
+		return nil, fmt.Errorf("failed to fetch commit activity: %d", status)
+	}
+
+	if status != 200 {
+		log.Printf("[GitHub Stats] Stats still not ready after %d attempts - returning empty data", maxRetries)
+		// Return empty data instead of error - this allows the UI to show "no data" instead of error
+		return []CommitActivityWeek{}, nil
+	}
+
+	var activity []CommitActivityWeek
+	if err := json.Unmarshal(body, &activity); err != nil {
+		return nil, err
+	}
+	return activity, nil
+}
+
+// GitHub Stats API - returns weekly additions/deletions
+func (c *GitHubClient) GetCodeFrequency(ctx context.Context, owner, repo string) ([]CodeFrequencyWeek, error) {
+	maxRetries := 3
+	var body []byte
+	var status int
+	var err error
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		body, status, err = c.request(ctx, fmt.Sprintf("/repos/%s/%s/stats/code_frequency", owner, repo))
+		if err != nil {
+			return nil, err
+		}
+
+		if status == 200 {
+			break
+		}
+
+		if status == 204 {
+			return []CodeFrequencyWeek{}, nil
+		}
+
+		if status == 202 {
+			log.Printf("[GitHub Stats] Code frequency is being computed (attempt %d/%d), waiting...", attempt+1, maxRetries)
+			if err := sleepContext(ctx, 3*time.Second); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		return nil, fmt.Errorf("failed to fetch code frequency: %d", status)
+	}
+
+	if status != 200 {
+		log.Printf("[GitHub Stats] Code frequency still not ready after %d attempts", maxRetries)
+		return []CodeFrequencyWeek{}, nil // Return empty, don't fail
+	}
+
+	// Returns array of [timestamp, additions, deletions]
+	var raw [][]int
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	var result []CodeFrequencyWeek
+	for _, week := range raw {
+		if len(week) >= 3 {
+			result = append(result, CodeFrequencyWeek{
+				Week:      week[0],
+				Additions: week[1],
+				Deletions: week[2],
+			})
+		}
+	}
+	return result, nil
+}
+
+type GitHubCommitDetail struct {
+	Files []CommitFileStat `json:"files"`
+}
+
+// CommitFileStat is one file changed by a commit, in the GitHub commit detail shape
+type CommitFileStat struct {
+	Filename         string `json:"filename"`
+	Status           string `json:"status"` // added, modified, removed, renamed, copied, changed
+	Additions        int    `json:"additions"`
+	Deletions        int    `json:"deletions"`
+	Changes          int    `json:"changes"`
+	PreviousFilename string `json:"previous_filename,omitempty"` // Set for renames
+}
+
+// commitFilenames returns just the paths of a commit's file stats
+func commitFilenames(stats []CommitFileStat) []string {
+	files := make([]string, len(stats))
+	for i, f := range stats {
+		files[i] = f.Filename
+	}
+	return files
+}
+
+func (c *GitHubClient) GetCommitFileStats(ctx context.Context, owner, repo, sha string) ([]CommitFileStat, error) {
+	body, status, err := c.request(ctx, fmt.Sprintf("/repos/%s/%s/commits/%s", owner, repo, sha))
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("failed to fetch commit detail: %d", status)
+	}
+
+	var detail GitHubCommitDetail
+	if err := json.Unmarshal(body, &detail); err != nil {
+		return nil, err
+	}
+	return detail.Files, nil
+}
+
+func (c *GitHubClient) GetCommitFiles(ctx context.Context, owner, repo, sha string) ([]string, error) {
+	stats, err := c.GetCommitFileStats(ctx, owner, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	return commitFilenames(stats), nil
+}
+
+// ListPullRequests pages through PRs targeting base (any base when empty),
+// most recently updated first, stopping at the first one not updated since
+// since or once limit PRs are collected
+func (c *GitHubClient) ListPullRequests(ctx context.Context, owner, repo, base string, since time.Time, limit int) ([]GitHubPullRequest, error) {
+	params := url.Values{}
+	params.Set("state", "all")
+	params.Set("sort", "updated")
+	params.Set("direction", "desc")
+	params.Set("per_page", "100")
+	if base != "" {
+		params.Set("base", base)
+	}
+	next := fmt.Sprintf("/repos/%s/%s/pulls?%s", owner, repo, params.Encode())
+
+	var prs []GitHubPullRequest
+	for next != "" {
+		body, status, header, err := c.requestWithHeader(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		if status != 200 {
+			return nil, fmt.Errorf("failed to fetch pull requests: %d", status)
+		}
+
+		var page []GitHubPullRequest
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		for _, pr := range page {
+			if (!since.IsZero() && pr.UpdatedAt.Before(since)) || (limit > 0 && len(prs) >= limit) {
+				return prs, nil
+			}
+			prs = append(prs, pr)
+		}
+
+		next = ""
+		if m := linkNextRe.FindStringSubmatch(header.Get("Link")); m != nil {
+			next = strings.TrimPrefix(m[1], c.baseURL)
+		}
+	}
+	return prs, nil
+}
+
+// GetPullRequest returns a single PR, which unlike the listing carries size and merged_by
+func (c *GitHubClient) GetPullRequest(ctx context.Context, owner, repo string, number int) (*GitHubPullRequest, error) {
+	body, status, err := c.request(ctx, fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, repo, number))
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("failed to fetch pull request: %d", status)
+	}
+
+	var pr GitHubPullRequest
+	if err := json.Unmarshal(body, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (c *GitHubClient) GetPullRequestReviews(ctx context.Context, owner, repo string, number int) ([]GitHubReview, error) {
+	var reviews []GitHubReview
+	err := c.eachPage(ctx, fmt.Sprintf("/repos/%s/%s/pulls/%d/reviews?per_page=100", owner, repo, number), "reviews", func(body []byte) error {
+		var page []GitHubReview
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		reviews = append(reviews, page...)
+		return nil
+	})
+	return reviews, err
+}
+
+func (c *GitHubClient) GetPullRequestReviewComments(ctx context.Context, owner, repo string, number int) ([]GitHubReviewComment, error) {
+	var comments []GitHubReviewComment
+	err := c.eachPage(ctx, fmt.Sprintf("/repos/%s/%s/pulls/%d/comments?per_page=100", owner, repo, number), "review comments", func(body []byte) error {
+		var page []GitHubReviewComment
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		comments = append(comments, page...)
+		return nil
+	})
+	return comments, err
+}
+
+// eachPage requests path and every page its Link headers lead to, handing
+// each body to add; what names the listing in errors
+func (c *GitHubClient) eachPage(ctx context.Context, path, what string, add func(body []byte) error) error {
+	for next := path; next != ""; {
+		body, status, header, err := c.requestWithHeader(ctx, next)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("failed to fetch %s: %d", what, status)
+		}
+		if err := add(body); err != nil {
+			return err
+		}
+
+		next = ""
+		if m := linkNextRe.FindStringSubmatch(header.Get("Link")); m != nil {
+			next = strings.TrimPrefix(m[1], c.baseURL)
+		}
+	}
+	return nil
+}
+
+// ListIssues pages through issues (not PRs) updated since since, newest first
+func (c *GitHubClient) ListIssues(ctx context.Context, owner, repo string, since time.Time, limit int) ([]GitHubIssue, error) {
+	params := url.Values{}
+	params.Set("state", "all")
+	params.Set("sort", "updated")
+	params.Set("direction", "desc")
+	params.Set("per_page", "100")
+	if !since.IsZero() {
+		params.Set("since", since.UTC().Format(time.RFC3339))
+	}
+	next := fmt.Sprintf("/repos/%s/%s/issues?%s", owner, repo, params.Encode())
+
+	var issues []GitHubIssue
+	for next != "" {
+		body, status, header, err := c.requestWithHeader(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		if status == 410 {
+			return issues, nil // Issues disabled for the repository
+		}
+		if status != 200 {
+			return nil, fmt.Errorf("failed to fetch issues: %d", status)
+		}
+
+		var page []GitHubIssue
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		for _, issue := range page {
+			if len(issue.PullRequest) > 0 {
+				continue
+			}
+			if limit > 0 && len(issues) >= limit {
+				return issues, nil
+			}
+			issues = append(issues, issue)
+		}
+
+		next = ""
+		if m := linkNextRe.FindStringSubmatch(header.Get("Link")); m != nil {
+			next = strings.TrimPrefix(m[1], c.baseURL)
+		}
+	}
+	return issues, nil
+}
+
+// GetIssue returns one issue, or nil when it does not exist
+func (c *GitHubClient) GetIssue(ctx context.Context, owner, repo string, number int) (*GitHubIssue, error) {
+	body, status, err := c.request(ctx, fmt.Sprintf("/repos/%s/%s/issues/%d", owner, repo, number))
+	if err != nil {
+		return nil, err
+	}
+	if status == 404 || status == 410 {
+		return nil, nil
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("failed to fetch issue: %d", status)
+	}
+
+	var issue GitHubIssue
+	if err := json.Unmarshal(body, &issue); err != nil {
+		return nil, err
+	}
+	return &issue, nil
+}
+
+// ==================== REPOSITORY DISCOVERY ====================
+
+// validateDiscoveryScope rejects scopes that cannot be listed or matched
+func validateDiscoveryScope(scope DiscoveryScope) error {
+	if scope.Team != "" && scope.Organization == "" {
+		return fmt.Errorf("a team scope needs its organization")
+	}
+	for _, pattern := range append(append([]string(nil), scope.Include...), scope.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// discoverRepos lists the repos in scope through client and applies the
+// scope's filters
+func discoverRepos(ctx context.Context, client connectionClient, scope DiscoveryScope) ([]DiscoveredRepo, error) {
+	var repos []GitHubRepoListing
+	var err error
+	switch {
+	case scope.Team != "":
+		repos, err = client.ListTeamRepos(ctx, scope.Organization, scope.Team)
+	case scope.Organization != "":
+		repos, err = client.ListOrgRepos(ctx, scope.Organization)
+	default:
+		repos, err = client.ListUserRepos(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var discovered []DiscoveredRepo
+	for _, r := range repos {
+		if !scope.matches(r) {
+			continue
+		}
+		discovered = append(discovered, DiscoveredRepo{
+			ID:            r.ID,
+			FullName:      r.FullName,
+			Name:          r.Name,
+			Owner:         r.Owner.Login,
+			Description:   r.Description,
+			DefaultBranch: r.DefaultBranch,
+			Language:      r.Language,
+			Stars:         r.StargazersCount,
+			Forks:         r.ForksCount,
+			Private:       r.Private,
+			UpdatedAt:     r.UpdatedAt,
+			AnalysisState: "none",
+		})
+	}
+	if filtered := len(repos) - len(discovered); filtered > 0 {
+		log.Printf("[Discovery] Filtered out %d of %d repos", filtered, len(repos))
+	}
+	return discovered, nil
+}
+
+// matches reports whether a listed repo passes the scope's filters
+func (s DiscoveryScope) matches(repo GitHubRepoListing) bool {
+	if s.ExcludeArchived && repo.Archived {
+		return false
+	}
+	if s.ExcludeForks && repo.Fork {
+		return false
+	}
+	for _, topic := range s.Topics {
+		if !containsFold(repo.Topics, topic) {
+			return false
+		}
+	}
+	if len(s.Languages) > 0 && !containsFold(s.Languages, repo.Language) {
+		return false
+	}
+	if repo.Language != "" && containsFold(s.ExcludeLanguages, repo.Language) {
+		return false
+	}
+	if len(s.Include) > 0 && !matchesRepoPattern(s.Include, repo) {
+		return false
+	}
+	return !matchesRepoPattern(s.Exclude, repo)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesRepoPattern reports whether any glob matches the repo's name or full name
+func matchesRepoPattern(patterns []string, repo GitHubRepoListing) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, repo.Name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, repo.FullName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ==================== GITHUB APP AUTH ====================
+
+// GitHubAppAuth authenticates as a GitHub App: it signs short-lived JWTs with
+// the app's private key and exchanges them for per-installation access tokens.
+// Installation tokens last an hour and are refreshed shortly before expiry.
+// Network calls run outside mu; concurrent callers share one in-flight request.
+type GitHubAppAuth struct {
+	appID      int64
+	key        *rsa.PrivateKey
+	baseURL    string
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	installations map[string]*appInstallation // lowercase account login -> installation
+	missing       map[string]time.Time        // lowercase account login -> when a reload last failed to find it
+	reload        *appFlight                  // In-flight installation listing
+}
+
+type appInstallation struct {
+	ID        int64
+	Account   string
+	token     string
+	expiresAt time.Time
+	refresh   *appFlight // In-flight access token request
+}
+
+// appFlight is a request that concurrent callers wait on instead of repeating
+type appFlight struct {
+	done chan struct{}
+	err  error
+}
+
+// installationTokenSkew is how long before expiry an installation token is renewed
+const installationTokenSkew = 5 * time.Minute
+
+// unknownOwnerTTL is how long an owner missing from the installation list is
+// answered from memory before the list is fetched again
+const unknownOwnerTTL = 5 * time.Minute
+
+func NewGitHubAppAuth(baseURL string, appID int64, privateKeyPEM []byte) (*GitHubAppAuth, error) {
+	key, err := parseAppPrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &GitHubAppAuth{
+		appID:         appID,
+		key:           key,
+		baseURL:       normalizeGitHubAPIURL(baseURL),
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+		installations: make(map[string]*appInstallation),
+		missing:       make(map[string]time.Time),
+	}, nil
+}
+
+// parseAppPrivateKey accepts the PKCS#1 key GitHub generates as well as PKCS#8
+func parseAppPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// jwt returns an RS256 app token valid for 9 minutes (GitHub allows at most 10),
+// backdated a minute to tolerate clock drift
+func (a *GitHubAppAuth) jwt() (string, error) {
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(a.appID, 10),
+	})
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func (a *GitHubAppAuth) do(ctx context.Context, method, path, bearer string) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", "RepoAnalyst-App")
+
+	log.Printf("[GitHub App] %s %s", method, path)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return body, resp.StatusCode, err
+}
+
+// share runs fn unless another caller already runs it under *slot, in which
+// case it waits for that result. A run abandoned by its caller's context is
+// retried under this one. Caller must not hold a.mu.
+func (a *GitHubAppAuth) share(ctx context.Context, slot **appFlight, fn func() error) error {
+	for {
+		a.mu.Lock()
+		flight := *slot
+		if flight == nil {
+			flight = &appFlight{done: make(chan struct{})}
+			*slot = flight
+			a.mu.Unlock()
+
+			flight.err = fn()
+
+			a.mu.Lock()
+			*slot = nil
+			a.mu.Unlock()
+			close(flight.done)
+			return flight.err
+		}
+		a.mu.Unlock()
+
+		select {
+		case <-flight.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !isContextError(flight.err) || ctx.Err() != nil {
+			return flight.err
+		}
+	}
+}
+
+// Identity describes the app itself; it stands in for the authenticated user
+func (a *GitHubAppAuth) Identity(ctx context.Context) (*GitHubUser, error) {
+	jwt, err := a.jwt()
+	if err != nil {
+		return nil, err
+	}
+	body, status, err := a.do(ctx, "GET", "/app", jwt)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("app authentication failed: %d", status)
+	}
+
+	var app struct {
+		Slug  string `json:"slug"`
+		Name  string `json:"name"`
+		Owner struct {
+			AvatarURL string `json:"avatar_url"`
+		} `json:"owner"`
+	}
+	if err := json.Unmarshal(body, &app); err != nil {
+		return nil, err
+	}
+	return &GitHubUser{Login: app.Slug, Name: app.Name, AvatarURL: app.Owner.AvatarURL}, nil
+}
+
+// loadInstallations refreshes the account -> installation map, keeping tokens
+// already minted for installations that still exist
+func (a *GitHubAppAuth) loadInstallations(ctx context.Context) error {
+	return a.share(ctx, &a.reload, func() error { return a.fetchInstallations(ctx) })
+}
+
+func (a *GitHubAppAuth) fetchInstallations(ctx context.Context) error {
+	jwt, err := a.jwt()
+	if err != nil {
+		return err
+	}
+
+	type listedInstallation struct {
+		ID      int64 `json:"id"`
+		Account struct {
+			Login string `json:"login"`
+		} `json:"account"`
+	}
+	var listed []listedInstallation
+	page := 1
+	for {
+		body, status, err := a.do(ctx, "GET", fmt.Sprintf("/app/installations?per_page=100&page=%d", page), jwt)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("failed to list installations: %d", status)
+		}
+
+		var installs []listedInstallation
+		if err := json.Unmarshal(body, &installs); err != nil {
+			return err
+		}
+		listed = append(listed, installs...)
+		page++
+
+		if len(installs) < 100 {
+			break
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	found := make(map[string]*appInstallation)
+	for _, inst := range listed {
+		key := strings.ToLower(inst.Account.Login)
+		delete(a.missing, key)
+		if existing, ok := a.installations[key]; ok && existing.ID == inst.ID {
+			found[key] = existing
+			continue
+		}
+		found[key] = &appInstallation{ID: inst.ID, Account: inst.Account.Login}
+	}
+	a.installations = found
+	log.Printf("[GitHub App] %d installations", len(found))
+	return nil
+}
+
+// installationToken returns a valid token for inst, minting a new one when
+// the current token is missing or about to expire
+func (a *GitHubAppAuth) installationToken(ctx context.Context, inst *appInstallation) (string, error) {
+	a.mu.Lock()
+	token, expiresAt := inst.token, inst.expiresAt
+	a.mu.Unlock()
+	if token != "" && time.Until(expiresAt) > installationTokenSkew {
+		return token, nil
+	}
+
+	if err := a.share(ctx, &inst.refresh, func() error { return a.mintToken(ctx, inst) }); err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return inst.token, nil
+}
+
+func (a *GitHubAppAuth) mintToken(ctx context.Context, inst *appInstallation) error {
+	jwt, err := a.jwt()
+	if err != nil {
+		return err
+	}
+	body, status, err := a.do(ctx, "POST", fmt.Sprintf("/app/installations/%d/access_tokens", inst.ID), jwt)
+	if err != nil {
+		return err
+	}
+	if status != 201 {
+		return fmt.Errorf("failed to create installation token for %s: %d", inst.Account, status)
+	}
+
+	var tok struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	inst.token = tok.Token
+	inst.expiresAt = tok.ExpiresAt
+	a.mu.Unlock()
+	log.Printf("[GitHub App] Refreshed installation token for %s (expires %s)", inst.Account, tok.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// TokenForOwner returns the installation token covering the given account.
+// An unknown owner triggers one reload in case the app was installed since;
+// if it is still missing, further lookups fail fast for unknownOwnerTTL.
+func (a *GitHubAppAuth) TokenForOwner(ctx context.Context, owner string) (string, error) {
+	key := strings.ToLower(owner)
+	a.mu.Lock()
+	inst, ok := a.installations[key]
+	missingSince, missing := a.missing[key]
+	a.mu.Unlock()
+
+	if !ok {
+		if missing && time.Since(missingSince) < unknownOwnerTTL {
+			return "", fmt.Errorf("app is not installed on %s", owner)
+		}
+		if err := a.loadInstallations(ctx); err != nil {
+			return "", err
+		}
+		a.mu.Lock()
+		if inst, ok = a.installations[key]; !ok {
+			a.missing[key] = time.Now()
+		}
+		a.mu.Unlock()
+		if !ok {
+			return "", fmt.Errorf("app is not installed on %s", owner)
+		}
+	}
+	return a.installationToken(ctx, inst)
+}
+
+// ListRepos lists the repositories granted to every installation of the app
+func (a *GitHubAppAuth) ListRepos(ctx context.Context) ([]GitHubRepoListing, error) {
+	if err := a.loadInstallations(ctx); err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	installs := make([]*appInstallation, 0, len(a.installations))
+	for _, inst := range a.installations {
+		installs = append(installs, inst)
+	}
+	a.mu.Unlock()
+
+	var allRepos []GitHubRepoListing
+	for _, inst := range installs {
+		token, err := a.installationToken(ctx, inst)
+		if err != nil {
+			return nil, err
+		}
+
+		page := 1
+		for {
+			body, status, err := a.do(ctx, "GET", fmt.Sprintf("/installation/repositories?per_page=100&page=%d", page), token)
+			if err != nil {
+				return nil, err
+			}
+			if status != 200 {
+				return nil, fmt.Errorf("failed to list repos for %s: %d", inst.Account, status)
+			}
+
+			var result struct {
+				Repositories []GitHubRepoListing `json:"repositories"`
+			}
+			if err := json.Unmarshal(body, &result); err != nil {
+				return nil, err
+			}
+
+			allRepos = append(allRepos, result.Repositories...)
+			page++
+
+			if len(result.Repositories) < 100 {
+				break
+			}
+		}
+	}
+
+	return allRepos, nil
+}
+
+// loadGitHubAppFromEnv configures app auth from GITHUB_APP_ID plus either
+// GITHUB_APP_PRIVATE_KEY (PEM contents) or GITHUB_APP_PRIVATE_KEY_FILE
+func loadGitHubAppFromEnv() (*GitHubAppAuth, error) {
+	appID, err := strconv.ParseInt(os.Getenv("GITHUB_APP_ID"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_APP_ID: %v", err)
+	}
+
+	keyPEM := []byte(os.Getenv("GITHUB_APP_PRIVATE_KEY"))
+	if keyFile := os.Getenv("GITHUB_APP_PRIVATE_KEY_FILE"); len(keyPEM) == 0 && keyFile != "" {
+		if keyPEM, err = os.ReadFile(keyFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(keyPEM) == 0 {
+		return nil, fmt.Errorf("GITHUB_APP_PRIVATE_KEY or GITHUB_APP_PRIVATE_KEY_FILE is required")
+	}
+
+	return NewGitHubAppAuth(envGitHubAPIURL, appID, keyPEM)
+}
+
+// connectEnvToken connects the GITHUB_TOKEN account and discovers its repos.
+// When that fails the token is still kept, under a connection with no
+// account, to serve repos on its host; see connectionFor.
+func connectEnvToken(ctx context.Context, token string) {
+	creds := connectionCredentials{token: token}
+	info, _, err := registerAccount(ctx, NewGitHubClient(envGitHubAPIURL, token), creds, "github", envGitHubAPIURL, DiscoveryScope{})
+	if err == nil {
+		envConnection = connectionFor(info.ID)
+		log.Printf("[Startup] GitHub token from environment connected as %s", info.Username)
+		return
+	}
+	log.Printf("[Startup] GitHub token discovery failed: %v", err)
+
+	envConnection = &liveConnection{
+		id:       connectionID("github", envGitHubAPIURL, ""),
+		provider: "github",
+		baseURL:  envGitHubAPIURL,
+		creds:    creds,
+	}
+	registerConnection(envConnection)
+}
+
+// connectGitHubApp discovers every installation's repositories so an
+// env-configured app is usable without a connect call from the UI
+func connectGitHubApp(ctx context.Context, app *GitHubAppAuth) error {
+	client := NewGitHubAppClient(app)
+	identity, err := client.GetAuthenticatedUser(ctx)
+	if err != nil {
+		return err
+	}
+	discovered, err := discoverRepos(ctx, client, DiscoveryScope{})
+	if err != nil {
+		return err
+	}
+
+	conn := &liveConnection{
+		id:       connectionID("github", app.baseURL, identity.Login),
+		provider: "github",
+		baseURL:  app.baseURL,
+		creds:    connectionCredentials{app: app},
+	}
+	registerConnection(conn)
+
+	stateLock.Lock()
+	addConnectionUnsafe(&GitHubConnection{
+		ID:          conn.id,
+		IsConnected: true,
+		Username:    identity.Login,
+		AvatarURL:   identity.AvatarURL,
+		Name:        identity.Name,
+		ConnectedAt: time.Now(),
+		Provider:    "github",
+		BaseURL:     app.baseURL,
+	}, discovered)
+	stateLock.Unlock()
+
+	log.Printf("[GitHub App] Connected as %s, discovered %d repos", identity.Login, len(discovered))
+	return nil
+}
+
+// ==================== GITHUB OAUTH DEVICE FLOW ====================
+
+// OAuth app settings for the device flow. GITHUB_OAUTH_CLIENT_ID enables it;
+// the client secret is only needed to refresh expiring user tokens.
+var (
+	oauthClientID     string
+	oauthClientSecret string
+	oauthScopes       = "repo read:org"
+)
+
+// GitHubOAuthSession holds a user access token obtained through the device
+// flow. GitHub Apps with expiring user tokens also hand out a refresh token;
+// those access tokens are renewed shortly before they expire. Classic OAuth
+// App tokens do not expire.
+type GitHubOAuthSession struct {
+	webURL     string
+	httpClient *http.Client
+
+	mu           sync.Mutex
+	accessToken  string
+	refreshToken string
+	expiresAt    time.Time  // Zero for tokens that do not expire
+	refreshing   *appFlight // In-flight refresh
+}
+
+// oauthTokenSkew is how long before expiry a user token is refreshed
+const oauthTokenSkew = 5 * time.Minute
+
+// oauthTokenResponse is the access token endpoint's answer, for both the
+// device code exchange and refreshes
+type oauthTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"` // Seconds; 0 for tokens that do not expire
+	Interval         int    `json:"interval"`   // New minimum poll interval on slow_down
+	Error            string `json:"error"`      // authorization_pending, slow_down, expired_token, access_denied, ...
+	ErrorDescription string `json:"error_description"`
+}
+
+type oauthDeviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	Error           string `json:"error"`
+}
+
+// githubWebURL returns the host serving OAuth endpoints for an API root:
+// github.com for api.github.com, the instance root for GHES
+func githubWebURL(apiURL string) string {
+	apiURL = normalizeGitHubAPIURL(apiURL)
+	if apiURL == defaultGitHubAPIURL {
+		return "https://github.com"
+	}
+	return strings.TrimSuffix(apiURL, "/api/v3")
+}
+
+// oauthPost submits an OAuth form to the web host and decodes the JSON answer.
+// GitHub reports flow errors with a 200 and an error field, left to the caller.
+func oauthPost(ctx context.Context, httpClient *http.Client, webURL, path string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", webURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "RepoAnalyst-App")
+
+	log.Printf("[GitHub OAuth] POST %s", path)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s failed: %d", path, resp.StatusCode)
+	}
+	return json.Unmarshal(body, out)
+}
+
+func newGitHubOAuthSession(webURL string, token oauthTokenResponse) *GitHubOAuthSession {
+	s := &GitHubOAuthSession{
+		webURL:     webURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	s.store(token)
+	return s
+}
+
+// store records a token response. Caller holds s.mu or owns s exclusively.
+func (s *GitHubOAuthSession) store(token oauthTokenResponse) {
+	s.accessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		s.refreshToken = token.RefreshToken
+	}
+	s.expiresAt = time.Time{}
+	if token.ExpiresIn > 0 {
+		s.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+}
+
+// Token returns a valid access token, refreshing it when it is about to expire.
+// Concurrent callers share one refresh, since GitHub rotates the refresh token
+// on every use; the POST runs without holding s.mu.
+func (s *GitHubOAuthSession) Token(ctx context.Context) (string, error) {
+	for {
+		s.mu.Lock()
+		if s.expiresAt.IsZero() || time.Until(s.expiresAt) > oauthTokenSkew {
+			token := s.accessToken
+			s.mu.Unlock()
+			return token, nil
+		}
+		if s.refreshToken == "" {
+			expiredAt := s.expiresAt
+			s.mu.Unlock()
+			return "", fmt.Errorf("OAuth token expired at %s and cannot be refreshed; reconnect", expiredAt.Format(time.RFC3339))
+		}
+
+		flight := s.refreshing
+		if flight == nil {
+			flight = &appFlight{done: make(chan struct{})}
+			s.refreshing = flight
+			refreshToken := s.refreshToken
+			s.mu.Unlock()
+
+			flight.err = s.exchange(ctx, refreshToken)
+
+			s.mu.Lock()
+			s.refreshing = nil
+			s.mu.Unlock()
+			close(flight.done)
+			if flight.err != nil {
+				return "", flight.err
+			}
+			continue
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-flight.done:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if flight.err != nil && (!isContextError(flight.err) || ctx.Err() != nil) {
+			return "", flight.err
+		}
+	}
+}
+
+// exchange trades a refresh token for a new access token and stores it
+func (s *GitHubOAuthSession) exchange(ctx context.Context, refreshToken string) error {
+	form := url.Values{}
+	form.Set("client_id", oauthClientID)
+	if oauthClientSecret != "" {
+		form.Set("client_secret", oauthClientSecret)
+	}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+
+	var token oauthTokenResponse
+	if err := oauthPost(ctx, s.httpClient, s.webURL, "/login/oauth/access_token", form, &token); err != nil {
+		return fmt.Errorf("failed to refresh OAuth token: %w", err)
+	}
+	if token.Error != "" || token.AccessToken == "" {
+		return fmt.Errorf("failed to refresh OAuth token: %s %s", token.Error, token.ErrorDescription)
+	}
+
+	s.mu.Lock()
+	s.store(token)
+	expiresAt := s.expiresAt
+	s.mu.Unlock()
+	log.Printf("[GitHub OAuth] Refreshed user token, valid until %s", expiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// NewGitHubOAuthClient creates a client that authenticates with a device flow user token
+func NewGitHubOAuthClient(baseURL string, session *GitHubOAuthSession) *GitHubClient {
+	client := NewGitHubClient(baseURL, "")
+	client.oauth = session
+	return client
+}
+
+// deviceFlow is a device authorization waiting for the user to enter its code.
+// The UI only sees the flow ID; the device code stays on the server.
+type deviceFlow struct {
+	deviceCode string
+	baseURL    string // API root the resulting connection uses
+	discovery  DiscoveryScope
+	interval   time.Duration
+	expiresAt  time.Time
+	lastPoll   time.Time
+}
+
+var (
+	deviceFlows     = make(map[string]*deviceFlow)
+	deviceFlowsLock sync.Mutex
+)
+
+func newDeviceFlowID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", buf), nil
+}
+
+// githubDeviceStart begins the OAuth device flow and returns the code the
+// user enters at the verification URI
+func githubDeviceStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if oauthClientID == "" {
+		w.WriteHeader(501)
+		json.NewEncoder(w).Encode(map[string]string{"error": "OAuth device flow is not configured (set GITHUB_OAUTH_CLIENT_ID)"})
+		return
+	}
+
+	var input struct {
+		BaseURL      string         `json:"baseUrl"` // GHES API root; empty for github.com
+		Organization string         `json:"organization"`
+		Discovery    DiscoveryScope `json:"discovery"`
+	}
+	json.NewDecoder(r.Body).Decode(&input)
+	if input.BaseURL == "" {
+		input.BaseURL = envGitHubAPIURL
+	}
+	input.BaseURL = normalizeGitHubAPIURL(input.BaseURL)
+	if input.Discovery.Organization == "" {
+		input.Discovery.Organization = input.Organization
+	}
+	if err := validateDiscoveryScope(input.Discovery); err != nil {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	form := url.Values{}
+	form.Set("client_id", oauthClientID)
+	form.Set("scope", oauthScopes)
+
+	var code oauthDeviceCodeResponse
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if err := oauthPost(r.Context(), httpClient, githubWebURL(input.BaseURL), "/login/device/code", form, &code); err != nil {
+		w.WriteHeader(502)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to start device flow: " + err.Error()})
+		return
+	}
+	if code.Error != "" || code.DeviceCode == "" {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to start device flow: " + code.Error})
+		return
+	}
+
+	flowID, err := newDeviceFlowID()
+	if err != nil {
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	deviceFlowsLock.Lock()
+	for id, flow := range deviceFlows {
+		if now.After(flow.expiresAt) {
+			delete(deviceFlows, id)
+		}
+	}
+	deviceFlows[flowID] = &deviceFlow{
+		deviceCode: code.DeviceCode,
+		baseURL:    input.BaseURL,
+		discovery:  input.Discovery,
+		interval:   time.Duration(code.Interval) * time.Second,
+		expiresAt:  now.Add(time.Duration(code.ExpiresIn) * time.Second),
+	}
+	deviceFlowsLock.Unlock()
+
+	log.Printf("[GitHub OAuth] Device flow started, code %s expires in %ds", code.UserCode, code.ExpiresIn)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"flowId":          flowID,
+		"userCode":        code.UserCode,
+		"verificationUri": code.VerificationURI,
+		"expiresIn":       code.ExpiresIn,
+		"interval":        code.Interval,
+	})
+}
+
+// githubDevicePoll checks whether the user has authorized a device flow. Until
+// then it answers {"status": "pending"}; once authorized it connects the
+// account and answers as /api/github/connect does. Polls faster than the
+// interval GitHub asked for are answered without contacting GitHub.
+func githubDevicePoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	var input struct {
+		FlowID string `json:"flowId"`
+	}
+	json.NewDecoder(r.Body).Decode(&input)
+
+	deviceFlowsLock.Lock()
+	flow, ok := deviceFlows[input.FlowID]
+	var wait, interval time.Duration
+	if ok {
+		interval = flow.interval
+		wait = interval - time.Since(flow.lastPoll)
+		if wait <= 0 {
+			flow.lastPoll = time.Now()
+		}
+	}
+	deviceFlowsLock.Unlock()
+
+	respond := func(code int, body map[string]interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(body)
+	}
+	endFlow := func() {
+		deviceFlowsLock.Lock()
+		delete(deviceFlows, input.FlowID)
+		deviceFlowsLock.Unlock()
+	}
+
+	if !ok {
+		respond(404, map[string]interface{}{"error": "Unknown or finished device flow"})
+		return
+	}
+	if time.Now().After(flow.expiresAt) {
+		endFlow()
+		respond(410, map[string]interface{}{"status": "expired"})
+		return
+	}
+	if wait > 0 {
+		respond(200, map[string]interface{}{"status": "pending", "interval": int(interval.Seconds())})
+		return
+	}
+
+	form := url.Values{}
+	form.Set("client_id", oauthClientID)
+	form.Set("device_code", flow.deviceCode)
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
+
+	webURL := githubWebURL(flow.baseURL)
+	var token oauthTokenResponse
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if err := oauthPost(r.Context(), httpClient, webURL, "/login/oauth/access_token", form, &token); err != nil {
+		respond(502, map[string]interface{}{"error": "Failed to poll device flow: " + err.Error()})
+		return
+	}
+
+	switch token.Error {
+	case "":
+	case "authorization_pending":
+		respond(200, map[string]interface{}{"status": "pending", "interval": int(interval.Seconds())})
+		return
+	case "slow_down":
+		deviceFlowsLock.Lock()
+		flow.interval += 5 * time.Second
+		if token.Interval > 0 {
+			flow.interval = time.Duration(token.Interval) * time.Second
+		}
+		interval = flow.interval
+		deviceFlowsLock.Unlock()
+		respond(200, map[string]interface{}{"status": "pending", "interval": int(interval.Seconds())})
+		return
+	case "expired_token":
+		endFlow()
+		respond(410, map[string]interface{}{"status": "expired"})
+		return
+	case "access_denied":
+		endFlow()
+		respond(403, map[string]interface{}{"status": "denied"})
+		return
+	default:
+		endFlow()
+		respond(400, map[string]interface{}{"error": "Device flow failed: " + token.Error + " " + token.ErrorDescription})
+		return
+	}
+	endFlow()
+
+	session := newGitHubOAuthSession(webURL, token)
+	client := NewGitHubOAuthClient(flow.baseURL, session)
+	connectAccount(w, r, client, connectionCredentials{oauth: session}, "github", flow.baseURL, flow.discovery)
+}
+
+// ==================== LOCAL GIT CLIENT ====================
+
+// LocalGitClient reads repositories from clones under root, laid out as
+// root/{owner}/{repo} (working tree) or root/{owner}/{repo}.git (bare).
+// It shells out to the git binary and maps results into the GitHub shapes.
+type LocalGitClient struct {
+	root string
+}
+
+func NewLocalGitClient(root string) *LocalGitClient {
+	return &LocalGitClient{root: root}
+}
+
+// repoDir resolves owner/repo to a clone directory on disk
+func (c *LocalGitClient) repoDir(owner, repo string) (string, error) {
+	if !validateProjectPath(owner, repo) {
+		return "", fmt.Errorf("invalid repository name: %s/%s", owner, repo)
+	}
+	for _, candidate := range []string{
+		filepath.Join(c.root, owner, repo),
+		filepath.Join(c.root, owner, repo+".git"),
+	} {
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("repo not found: %s/%s", owner, repo)
+}
+
+// git runs a git command inside dir and returns stdout
+func (c *LocalGitClient) git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// ListRepos discovers every clone under root (the ListUserRepos equivalent)
+func (c *LocalGitClient) ListRepos(ctx context.Context) ([]GitHubRepoListing, error) {
+	owners, err := os.ReadDir(c.root)
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []GitHubRepoListing
+	for _, ownerEntry := range owners {
+		if !ownerEntry.IsDir() || strings.HasPrefix(ownerEntry.Name(), ".") {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(c.root, ownerEntry.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			name := strings.TrimSuffix(entry.Name(), ".git")
+			listing, err := c.GetRepository(ctx, ownerEntry.Name(), name)
+			if err != nil {
+				log.Printf("[LocalGit] Skipping %s/%s: %v", ownerEntry.Name(), entry.Name(), err)
+				continue
+			}
+			repos = append(repos, *listing)
+		}
+	}
+	return repos, nil
+}
+
+func (c *LocalGitClient) GetRepository(ctx context.Context, owner, repo string) (*GitHubRepoListing, error) {
+	dir, err := c.repoDir(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	// A detached HEAD has no branch name; its commit stands in for one
+	branch, err := c.git(ctx, dir, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		if branch, err = c.git(ctx, dir, "rev-parse", "HEAD"); err != nil {
+			return nil, err
+		}
+	}
+
+	listing := &GitHubRepoListing{
+		FullName:      owner + "/" + repo,
+		Name:          repo,
+		DefaultBranch: strings.TrimSpace(string(branch)),
+		Private:       true,
+	}
+	listing.Owner.Login = owner
+
+	// Stable pseudo-ID so the frontend can key on it like a GitHub repo ID
+	h := fnv.New64a()
+	h.Write([]byte(listing.FullName))
+	listing.ID = int64(h.Sum64() >> 1)
+
+	// Bare clones carry a description file; ignore git's placeholder text
+	if desc, err := os.ReadFile(filepath.Join(dir, "description")); err == nil && !strings.HasPrefix(string(desc), "Unnamed repository") {
+		listing.Description = strings.TrimSpace(string(desc))
+	}
+
+	if out, err := c.git(ctx, dir, "log", "-1", "--format=%cI", "HEAD"); err == nil {
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(out))); err == nil {
+			listing.UpdatedAt = t
+			listing.PushedAt = t
+		}
+	}
+	return listing, nil
+}
+
+// localLogFormat separates fields with US and records with RS so messages can contain anything
+const localLogFormat = "--format=%H%x1f%an%x1f%ae%x1f%aI%x1f%B%x1e"
+
+func (c *LocalGitClient) GetCommits(ctx context.Context, owner, repo string, limit int) ([]GitHubCommit, error) {
+	dir, err := c.repoDir(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := c.git(ctx, dir, "log", fmt.Sprintf("-n%d", limit), localLogFormat, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch commits: %w", err)
+	}
+	return parseLocalLog(out), nil
+}
+
+func (c *LocalGitClient) ListCommits(ctx context.Context, owner, repo string, q CommitQuery) ([]GitHubCommit, error) {
+	dir, err := c.repoDir(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"log", localLogFormat}
+	if q.Limit > 0 {
+		args = append(args, fmt.Sprintf("-n%d", q.Limit))
+	}
+	if !q.Since.IsZero() {
+		args = append(args, "--since="+q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		args = append(args, "--until="+q.Until.Format(time.RFC3339))
+	}
+	if q.Author != "" {
+		args = append(args, "--author="+q.Author)
+	}
+	rev := "HEAD"
+	if q.Ref != "" {
+		rev = q.Ref
+	}
+	args = append(args, rev)
+	if q.Path != "" {
+		args = append(args, "--", q.Path)
+	}
+
+	out, err := c.git(ctx, dir, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch commits: %w", err)
+	}
+	return parseLocalLog(out), nil
+}
+
+// parseLocalLog decodes `git log` output produced with localLogFormat
+func parseLocalLog(out []byte) []GitHubCommit {
+	commits := make([]GitHubCommit, 0)
+	for _, record := range strings.Split(string(out), "\x1e") {
+		fields := strings.SplitN(strings.TrimLeft(record, "\n"), "\x1f", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		var commit GitHubCommit
+		commit.SHA = fields[0]
+		commit.Commit.Author.Name = fields[1]
+		commit.Commit.Author.Email = fields[2]
+		commit.Commit.Author.Date, _ = time.Parse(time.RFC3339, fields[3])
+		commit.Commit.Message = strings.TrimRight(fields[4], "\n")
+		commits = append(commits, commit)
+	}
+	return commits
+}
+
+func (c *LocalGitClient) GetContributors(ctx context.Context, owner, repo string) ([]GitHubContributor, error) {
+	dir, err := c.repoDir(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := c.git(ctx, dir, "shortlog", "-sn", "--no-merges", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch contributors: %w", err)
+	}
+
+	contributors := make([]GitHubContributor, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		var count int
+		fmt.Sscanf(parts[0], "%d", &count)
+		contributors = append(contributors, GitHubContributor{Login: parts[1], Contributions: count})
+	}
+	return contributors, nil
+}
+
+func (c *LocalGitClient) GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error) {
+	return c.GetFileContentAt(ctx, owner, repo, path, "")
+}
+
+func (c *LocalGitClient) GetFileContentAt(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	dir, err := c.repoDir(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	// Missing paths behave like a GitHub 404: no content, no error
+	if _, err := c.git(ctx, dir, "cat-file", "-e", ref+":"+path); err != nil {
+		return nil, nil
+	}
+	return c.git(ctx, dir, "cat-file", "blob", ref+":"+path)
+}
+
+func (c *LocalGitClient) GetFileTree(ctx context.Context, owner, repo, branch string) (*GitHubTreeResponse, error) {
+	dir, err := c.repoDir(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	sha, err := c.git(ctx, dir, "rev-parse", branch+"^{tree}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tree: %w", err)
+	}
+
+	// Format: <mode> <type> <object> <size>\t<path>
+	out, err := c.git(ctx, dir, "ls-tree", "-r", "-t", "-l", branch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tree: %w", err)
+	}
+
+	tree := &GitHubTreeResponse{SHA: strings.TrimSpace(string(sha)), Tree: make([]GitHubTreeNode, 0)}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		meta, path, found := strings.Cut(scanner.Text(), "\t")
+		fields := strings.Fields(meta)
+		if !found || len(fields) != 4 {
+			continue
+		}
+		node := GitHubTreeNode{Path: path, Mode: fields[0], Type: fields[1], SHA: fields[2]}
+		fmt.Sscanf(fields[3], "%d", &node.Size)
+		tree.Tree = append(tree.Tree, node)
+	}
+	return tree, nil
+}
+
+// GetCommitActivity derives the last 52 weeks of daily commit counts from history
+func (c *LocalGitClient) GetCommitActivity(ctx context.Context, owner, repo string) ([]CommitActivityWeek, error) {
+	dir, err := c.repoDir(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := c.git(ctx, dir, "log", "--since=53.weeks", "--format=%at", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch commit activity: %w", err)
+	}
+
+	var timestamps []time.Time
+	for _, line := range strings.Fields(string(out)) {
+		var unix int64
+		if _, err := fmt.Sscanf(line, "%d", &unix); err == nil {
+			timestamps = append(timestamps, time.Unix(unix, 0))
+		}
+	}
+	return buildCommitActivity(timestamps, time.Now()), nil
+}
+
+// GetCodeFrequency derives weekly additions/deletions from --numstat history
+func (c *LocalGitClient) GetCodeFrequency(ctx context.Context, owner, repo string) ([]CodeFrequencyWeek, error) {
+	dir, err := c.repoDir(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := c.git(ctx, dir, "log", "--no-merges", "--numstat", "--format=@%at", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch code frequency: %w", err)
+	}
+
+	weeks := make(map[int64]*CodeFrequencyWeek)
+	var current *CodeFrequencyWeek
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "@") {
+			var unix int64
+			fmt.Sscanf(line[1:], "%d", &unix)
+			week := weekStart(time.Unix(unix, 0)).Unix()
+			if weeks[week] == nil {
+				weeks[week] = &CodeFrequencyWeek{Week: int(week)}
+			}
+			current = weeks[week]
+			continue
+		}
+		// numstat: <added>\t<deleted>\t<path>, "-" for binary files
+		fields := strings.SplitN(line, "\t", 3)
+		if current == nil || len(fields) != 3 {
+			continue
+		}
+		var added, deleted int
+		fmt.Sscanf(fields[0], "%d", &added)
+		fmt.Sscanf(fields[1], "%d", &deleted)
+		current.Additions += added
+		current.Deletions += deleted
+	}
+
+	result := make([]CodeFrequencyWeek, 0, len(weeks))
+	for _, week := range weeks {
+		result = append(result, *week)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Week < result[j].Week })
+	return result, nil
+}
+
+func (c *LocalGitClient) GetCommitFiles(ctx context.Context, owner, repo, sha string) ([]string, error) {
+	stats, err := c.GetCommitFileStats(ctx, owner, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	return commitFilenames(stats), nil
+}
+
+// GetCommitFileStats diffs against the first parent, like the GitHub commit
+// endpoint does for merges. It combines --name-status (status, rename source)
+// with --numstat (line counts); both list files in the same order.
+func (c *LocalGitClient) GetCommitFileStats(ctx context.Context, owner, repo, sha string) ([]CommitFileStat, error) {
+	dir, err := c.repoDir(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	diffArgs := []string{"diff-tree", "--root", "--no-commit-id", "-r", "-m", "--first-parent", "-M", "-z"}
+	statusOut, err := c.git(ctx, dir, append(diffArgs, "--name-status", sha)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch commit detail: %w", err)
+	}
+	numOut, err := c.git(ctx, dir, append(diffArgs, "--numstat", sha)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch commit detail: %w", err)
+	}
+
+	// --name-status -z: STATUS NUL path NUL, or STATUS NUL old NUL new NUL for renames/copies
+	stats := make([]CommitFileStat, 0)
+	fields := strings.Split(strings.TrimSuffix(string(statusOut), "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		code := fields[i]
+		if code == "" || i+1 >= len(fields) {
+			continue
+		}
+		stat := CommitFileStat{Status: localStatusNames[code[:1]]}
+		if (code[0] == 'R' || code[0] == 'C') && i+2 < len(fields) {
+			stat.PreviousFilename = fields[i+1]
+			stat.Filename = fields[i+2]
+			i += 2
+		} else {
+			stat.Filename = fields[i+1]
+			i++
+		}
+		stats = append(stats, stat)
+	}
+
+	// --numstat -z: ADD TAB DEL TAB path NUL, or ADD TAB DEL TAB NUL old NUL new NUL
+	// Binary files report "-" for both counts and stay at zero
+	n := 0
+	records := strings.Split(strings.TrimSuffix(string(numOut), "\x00"), "\x00")
+	for i := 0; i < len(records) && n < len(stats); i++ {
+		parts := strings.SplitN(records[i], "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		stats[n].Additions, _ = strconv.Atoi(parts[0])
+		stats[n].Deletions, _ = strconv.Atoi(parts[1])
+		stats[n].Changes = stats[n].Additions + stats[n].Deletions
+		if parts[2] == "" {
+			i += 2 // Rename: old and new paths follow as separate records
+		}
+		n++
+	}
+	return stats, nil
+}
+
+var localStatusNames = map[string]string{
+	"A": "added",
+	"M": "modified",
+	"D": "removed",
+	"R": "renamed",
+	"C": "copied",
+	"T": "changed",
+}
+
+// weekStart truncates t to Sunday 00:00 UTC, the week boundary used by GitHub stats
+func weekStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -int(day.Weekday()))
+}
+
+// buildCommitActivity buckets commit timestamps into the 52-week shape of /stats/commit_activity
+func buildCommitActivity(timestamps []time.Time, now time.Time) []CommitActivityWeek {
+	first := weekStart(now).AddDate(0, 0, -7*51)
+	weeks := make([]CommitActivityWeek, 52)
+	for i := range weeks {
+		weeks[i] = CommitActivityWeek{Week: first.AddDate(0, 0, 7*i).Unix(), Days: make([]int, 7)}
+	}
+
+	for _, ts := range timestamps {
+		idx := int(weekStart(ts).Sub(first).Hours() / (24 * 7))
+		if idx < 0 || idx >= len(weeks) {
+			continue
+		}
+		weeks[idx].Days[ts.UTC().Weekday()]++
+		weeks[idx].Total++
+	}
+	return weeks
+}
+
+// connectLocalRepositories populates state from LOCAL_REPOS_DIR at startup
+func connectLocalRepositories(ctx context.Context) error {
+	repos, err := NewLocalGitClient(localRepoRoot).ListRepos(ctx)
+	if err != nil {
+		return err
+	}
+
+	var discovered []DiscoveredRepo
+	for _, r := range repos {
+		discovered = append(discovered, DiscoveredRepo{
+			ID:            r.ID,
+			FullName:      r.FullName,
+			Name:          r.Name,
+			Owner:         r.Owner.Login,
+			Description:   r.Description,
+			DefaultBranch: r.DefaultBranch,
+			Private:       r.Private,
+			UpdatedAt:     r.UpdatedAt,
+			AnalysisState: "none",
+		})
+	}
+
+	conn := &liveConnection{
+		id:       connectionID("local", localRepoRoot, ""),
+		provider: "local",
+		baseURL:  localRepoRoot,
+	}
+	registerConnection(conn)
+
+	stateLock.Lock()
+	addConnectionUnsafe(&GitHubConnection{
+		ID:          conn.id,
+		IsConnected: true,
+		Username:    "local",
+		Name:        localRepoRoot,
+		ConnectedAt: time.Now(),
+		Provider:    "local",
+	}, discovered)
+	stateLock.Unlock()
+
+	log.Printf("[LocalGit] Discovered %d repositories under %s", len(discovered), localRepoRoot)
+	return nil
+}
+
+// ==================== GITLAB API CLIENT ====================
+
+// GitLabClient reads projects from gitlab.com or a self-managed instance via
+// the v4 REST API and maps responses into the GitHub shapes the analyzers use.
+// Projects are addressed as {namespace}/{project}; nested subgroups are not supported.
+type GitLabClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+const defaultGitLabBaseURL = "https://gitlab.com"
+
+func NewGitLabClient(baseURL, token string) *GitLabClient {
+	if baseURL == "" {
+		baseURL = defaultGitLabBaseURL
+	}
+	return &GitLabClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *GitLabClient) request(ctx context.Context, path string) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/v4"+path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+	req.Header.Set("User-Agent", "RepoAnalyst-App")
+
+	log.Printf("[GitLab API] GET %s", path)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+
+	log.Printf("[GitLab API] Response: %d (%d bytes)", resp.StatusCode, len(body))
+	return body, resp.StatusCode, nil
+}
+
+// projectPath returns the URL-encoded project ID GitLab expects in /projects/:id
+func (c *GitLabClient) projectPath(owner, repo string) string {
+	return "/projects/" + url.PathEscape(owner+"/"+repo)
+}
+
+type gitLabUser struct {
+	Username  string `json:"username"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+	Email     string `json:"email"`
+}
+
+type gitLabProject struct {
+	ID                int64     `json:"id"`
+	Path              string    `json:"path"`
+	PathWithNamespace string    `json:"path_with_namespace"`
+	Description       string    `json:"description"`
+	DefaultBranch     string    `json:"default_branch"`
+	StarCount         int       `json:"star_count"`
+	ForksCount        int       `json:"forks_count"`
+	Visibility        string    `json:"visibility"`
+	Archived          bool      `json:"archived"`
+	Topics            []string  `json:"topics"`
+	ForkedFrom        *struct{} `json:"forked_from_project"`
+	LastActivityAt    time.Time `json:"last_activity_at"`
+	Namespace         struct {
+		FullPath string `json:"full_path"`
+	} `json:"namespace"`
+}
+
+// toListing maps a project onto a GitHub listing. Its namespace becomes the
+// owner, so a subgroup project is owned by group/subgroup; see splitFullName.
+func (p gitLabProject) toListing() GitHubRepoListing {
+	listing := GitHubRepoListing{
+		ID:              p.ID,
+		FullName:        p.PathWithNamespace,
+		Name:            p.Path,
+		Description:     p.Description,
+		DefaultBranch:   p.DefaultBranch,
+		StargazersCount: p.StarCount,
+		ForksCount:      p.ForksCount,
+		Private:         p.Visibility != "public",
+		Archived:        p.Archived,
+		Fork:            p.ForkedFrom != nil,
+		Topics:          p.Topics,
+		UpdatedAt:       p.LastActivityAt,
+		PushedAt:        p.LastActivityAt,
+	}
+	listing.Owner.Login = p.Namespace.FullPath
+	return listing
+}
+
+type gitLabCommit struct {
+	ID           string    `json:"id"`
+	Message      string    `json:"message"`
+	AuthorName   string    `json:"author_name"`
+	AuthorEmail  string    `json:"author_email"`
+	AuthoredDate time.Time `json:"authored_date"`
+	Stats        *struct {
+		Additions int `json:"additions"`
+		Deletions int `json:"deletions"`
+	} `json:"stats,omitempty"`
+}
+
+func (gc gitLabCommit) toCommit() GitHubCommit {
+	var commit GitHubCommit
+	commit.SHA = gc.ID
+	commit.Commit.Message = gc.Message
+	commit.Commit.Author.Name = gc.AuthorName
+	commit.Commit.Author.Email = gc.AuthorEmail
+	commit.Commit.Author.Date = gc.AuthoredDate
+	return commit
+}
+
+func (c *GitLabClient) GetAuthenticatedUser(ctx context.Context) (*GitHubUser, error) {
+	body, status, err := c.request(ctx, "/user")
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("authentication failed: %d", status)
+	}
+
+	var user gitLabUser
+	if err := json.Unmarshal(body, &user); err != nil {
+		return nil, err
+	}
+	return &GitHubUser{Login: user.Username, Name: user.Name, AvatarURL: user.AvatarURL, Email: user.Email}, nil
+}
+
+// ListUserRepos lists every project the token's user is a member of
+func (c *GitLabClient) ListUserRepos(ctx context.Context) ([]GitHubRepoListing, error) {
+	return c.listProjects(ctx, "/projects?membership=true")
+}
+
+// ListOrgRepos lists a group's projects, including those of its subgroups.
+// org may itself be a subgroup path such as group/subgroup.
+func (c *GitLabClient) ListOrgRepos(ctx context.Context, org string) ([]GitHubRepoListing, error) {
+	return c.listProjects(ctx, "/groups/"+url.PathEscape(org)+"/projects?include_subgroups=true")
+}
+
+// ListTeamRepos lists the projects of the subgroup org/team: GitLab has no
+// teams, subgroups serve instead
+func (c *GitLabClient) ListTeamRepos(ctx context.Context, org, team string) ([]GitHubRepoListing, error) {
+	return c.ListOrgRepos(ctx, org+"/"+team)
+}
+
+// listProjects pages through a project listing, most recently active first
+func (c *GitLabClient) listProjects(ctx context.Context, listPath string) ([]GitHubRepoListing, error) {
+	var allRepos []GitHubRepoListing
+	page := 1
+
+	for {
+		body, status, err := c.request(ctx, fmt.Sprintf("%s&per_page=100&page=%d&order_by=last_activity_at", listPath, page))
+		if err != nil {
+			return nil, err
+		}
+		if status != 200 {
+			return nil, fmt.Errorf("failed to list projects: %d", status)
+		}
+
+		var projects []gitLabProject
+		if err := json.Unmarshal(body, &projects); err != nil {
+			return nil, err
+		}
+
+		for _, p := range projects {
+			allRepos = append(allRepos, p.toListing())
+		}
+		page++
+
+		if len(projects) < 100 {
+			break
+		}
+	}
+
+	return allRepos, nil
+}
+
+func (c *GitLabClient) GetRepository(ctx context.Context, owner, repo string) (*GitHubRepoListing, error) {
+	body, status, err := c.request(ctx, c.projectPath(owner, repo))
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("repo not found: %d", status)
+	}
+
+	var project gitLabProject
+	if err := json.Unmarshal(body, &project); err != nil {
+		return nil, err
+	}
+	listing := project.toListing()
+	return &listing, nil
+}
+
+// GetCommits returns the latest limit commits. GitLab caps per_page at 100,
+// so larger limits are paged.
+func (c *GitLabClient) GetCommits(ctx context.Context, owner, repo string, limit int) ([]GitHubCommit, error) {
+	return c.ListCommits(ctx, owner, repo, CommitQuery{Limit: limit})
+}
+
+// commitsSince pages through every commit since the given time, with line stats
+func (c *GitLabClient) commitsSince(ctx context.Context, owner, repo string, since time.Time) ([]gitLabCommit, error) {
+	return c.listCommits(ctx, owner, repo, CommitQuery{Since: since}, true)
+}
+
+// listCommits pages through the commits matching q
+func (c *GitLabClient) listCommits(ctx context.Context, owner, repo string, q CommitQuery, withStats bool) ([]gitLabCommit, error) {
+	perPage := 100
+	if q.Limit > 0 && q.Limit < perPage {
+		perPage = q.Limit
+	}
+	params := url.Values{}
+	params.Set("per_page", strconv.Itoa(perPage))
+	if withStats {
+		params.Set("with_stats", "true")
+	}
+	if !q.Since.IsZero() {
+		params.Set("since", q.Since.UTC().Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		params.Set("until", q.Until.UTC().Format(time.RFC3339))
+	}
+	if q.Path != "" {
+		params.Set("path", q.Path)
+	}
+	if q.Author != "" {
+		params.Set("author", q.Author)
+	}
+	if q.Ref != "" {
+		params.Set("ref_name", q.Ref)
+	}
+
+	var all []gitLabCommit
+	page := 1
+
+	for {
+		params.Set("page", strconv.Itoa(page))
+		body, status, err := c.request(ctx, fmt.Sprintf("%s/repository/commits?%s", c.projectPath(owner, repo), params.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		if status != 200 {
+			return nil, fmt.Errorf("failed to fetch commits: %d", status)
+		}
+
+		var commits []gitLabCommit
+		if err := json.Unmarshal(body, &commits); err != nil {
+			return nil, err
+		}
+
+		all = append(all, commits...)
+		page++
+
+		if q.Limit > 0 && len(all) >= q.Limit {
+			all = all[:q.Limit]
+			break
+		}
+		if len(commits) < perPage {
+			break
+		}
+	}
+
+	return all, nil
+}
+
+func (c *GitLabClient) ListCommits(ctx context.Context, owner, repo string, q CommitQuery) ([]GitHubCommit, error) {
+	glCommits, err := c.listCommits(ctx, owner, repo, q, false)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make([]GitHubCommit, len(glCommits))
+	for i, gc := range glCommits {
+		commits[i] = gc.toCommit()
+	}
+	return commits, nil
+}
+
+func (c *GitLabClient) GetContributors(ctx context.Context, owner, repo string) ([]GitHubContributor, error) {
+	body, status, err := c.request(ctx, fmt.Sprintf("%s/repository/contributors?per_page=100&order_by=commits&sort=desc", c.projectPath(owner, repo)))
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("failed to fetch contributors: %d", status)
+	}
+
+	var glContributors []struct {
+		Name    string `json:"name"`
+		Email   string `json:"email"`
+		Commits int    `json:"commits"`
+	}
+	if err := json.Unmarshal(body, &glContributors); err != nil {
+		return nil, err
+	}
+
+	contributors := make([]GitHubContributor, len(glContributors))
+	for i, gc := range glContributors {
+		contributors[i] = GitHubContributor{Login: gc.Name, Contributions: gc.Commits}
+	}
+	return contributors, nil
+}
+
+func (c *GitLabClient) GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error) {
+	return c.GetFileContentAt(ctx, owner, repo, path, "")
+}
+
+func (c *GitLabClient) GetFileContentAt(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	body, status, err := c.request(ctx, fmt.Sprintf("%s/repository/files/%s/raw?ref=%s", c.projectPath(owner, repo), url.PathEscape(path), url.QueryEscape(ref)))
+	if err != nil {
+		return nil, err
+	}
+	if status == 404 {
+		return nil, nil
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("failed to fetch file: %d", status)
+	}
+	return body, nil
+}
+
+func (c *GitLabClient) GetFileTree(ctx context.Context, owner, repo, branch string) (*GitHubTreeResponse, error) {
+	tree := &GitHubTreeResponse{Tree: make([]GitHubTreeNode, 0)}
+	page := 1
+
+	for {
+		body, status, err := c.request(ctx, fmt.Sprintf("%s/repository/tree?recursive=true&per_page=100&page=%d&ref=%s",
+			c.projectPath(owner, repo), page, url.QueryEscape(branch)))
+		if err != nil {
+			return nil, err
+		}
+		if status != 200 {
+			return nil, fmt.Errorf("failed to fetch tree: %d", status)
+		}
+
+		var entries []struct {
+			ID   string `json:"id"`
+			Path string `json:"path"`
+			Type string `json:"type"` // blob | tree | commit, same as GitHub
+			Mode string `json:"mode"`
+		}
+		if err := json.Unmarshal(body, &entries); err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			tree.Tree = append(tree.Tree, GitHubTreeNode{Path: e.Path, Mode: e.Mode, Type: e.Type})
+		}
+		page++
+
+		if len(entries) < 100 {
+			break
+		}
+	}
+
+	return tree, nil
+}
+
+// GetCommitActivity derives the last 52 weeks of daily commit counts from the commit list
+func (c *GitLabClient) GetCommitActivity(ctx context.Context, owner, repo string) ([]CommitActivityWeek, error) {
+	now := time.Now()
+	commits, err := c.commitsSince(ctx, owner, repo, weekStart(now).AddDate(0, 0, -7*51))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch commit activity: %w", err)
+	}
+
+	timestamps := make([]time.Time, len(commits))
+	for i, gc := range commits {
+		timestamps[i] = gc.AuthoredDate
+	}
+	return buildCommitActivity(timestamps, now), nil
+}
+
+// GetCodeFrequency derives weekly additions/deletions from per-commit stats over the last year
+func (c *GitLabClient) GetCodeFrequency(ctx context.Context, owner, repo string) ([]CodeFrequencyWeek, error) {
+	commits, err := c.commitsSince(ctx, owner, repo, weekStart(time.Now()).AddDate(0, 0, -7*51))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch code frequency: %w", err)
+	}
+
+	weeks := make(map[int64]*CodeFrequencyWeek)
+	for _, gc := range commits {
+		if gc.Stats == nil {
+			continue
+		}
+		week := weekStart(gc.AuthoredDate).Unix()
+		if weeks[week] == nil {
+			weeks[week] = &CodeFrequencyWeek{Week: int(week)}
+		}
+		weeks[week].Additions += gc.Stats.Additions
+		weeks[week].Deletions += gc.Stats.Deletions
+	}
+
+	result := make([]CodeFrequencyWeek, 0, len(weeks))
+	for _, week := range weeks {
+		result = append(result, *week)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Week < result[j].Week })
+	return result, nil
+}
+
+func (c *GitLabClient) GetCommitFiles(ctx context.Context, owner, repo, sha string) ([]string, error) {
+	stats, err := c.GetCommitFileStats(ctx, owner, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	return commitFilenames(stats), nil
+}
+
+// GetCommitFileStats counts added/removed lines from each file's unified diff,
+// since GitLab only reports line stats for the commit as a whole. The diff is
+// paged like any other listing, so large commits take several requests.
+// GitLab's diffs start at the first hunk, without ---/+++ file headers, so
+// every +/- line is a changed line.
+func (c *GitLabClient) GetCommitFileStats(ctx context.Context, owner, repo, sha string) ([]CommitFileStat, error) {
+	type fileDiff struct {
+		Diff        string `json:"diff"`
+		NewPath     string `json:"new_path"`
+		OldPath     string `json:"old_path"`
+		NewFile     bool   `json:"new_file"`
+		RenamedFile bool   `json:"renamed_file"`
+		DeletedFile bool   `json:"deleted_file"`
+	}
+	var diffs []fileDiff
+	page := 1
+
+	for {
+		body, status, err := c.request(ctx, fmt.Sprintf("%s/repository/commits/%s/diff?per_page=100&page=%d", c.projectPath(owner, repo), sha, page))
+		if err != nil {
+			return nil, err
+		}
+		if status != 200 {
+			return nil, fmt.Errorf("failed to fetch commit detail: %d", status)
+		}
+
+		var pageDiffs []fileDiff
+		if err := json.Unmarshal(body, &pageDiffs); err != nil {
+			return nil, err
+		}
+
+		diffs = append(diffs, pageDiffs...)
+		page++
+
+		if len(pageDiffs) < 100 {
+			break
+		}
+	}
+
+	stats := make([]CommitFileStat, len(diffs))
+	for i, d := range diffs {
+		stat := CommitFileStat{Filename: d.NewPath, Status: "modified"}
+		switch {
+		case d.NewFile:
+			stat.Status = "added"
+		case d.DeletedFile:
+			stat.Status = "removed"
+		case d.RenamedFile:
+			stat.Status = "renamed"
+			stat.PreviousFilename = d.OldPath
+		}
+		for _, line := range strings.Split(d.Diff, "\n") {
+			if strings.HasPrefix(line, "+") {
+				stat.Additions++
+			} else if strings.HasPrefix(line, "-") {
+				stat.Deletions++
+			}
+		}
+		stat.Changes = stat.Additions + stat.Deletions
+		stats[i] = stat
+	}
+	return stats, nil
+}
+
+// ==================== ANALYSIS ENGINE ====================
+
+func analyzeRepository(ctx context.Context, client RepoDataSource, owner, repo string, target *AnalysisRef, window AnalysisWindow) (*RepoAnalysis, error) {
+	log.Printf("[Analysis] Starting analysis for %s/%s at %s", owner, repo, target.Name)
+
+	repoData, err := client.GetRepository(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := client.GetCommits(ctx, owner, repo, 100)
+	if err != nil {
+		log.Printf("[Analysis] Warning: Failed to fetch commits: %v", err)
+		commits = []GitHubCommit{}
+	}
+
+	// Fetch yearly commit activity (daily stats for 52 weeks) for the heatmap
+	activity, err := client.GetCommitActivity(ctx, owner, repo)
+	if err != nil {
+		log.Printf("[Analysis] Warning: Failed to fetch yearly activity: %v", err)
+	}
+
+	contributors, err := client.GetContributors(ctx, owner, repo)
+	if err != nil {
+		log.Printf("[Analysis] Warning: Failed to fetch contributors: %v", err)
+		contributors = []GitHubContributor{}
+	}
+
+	branch := target.Name
+
+	var fileCount, dirCount int
+	filesByExt := make(map[string]int)
+	dirFileCounts := make(map[string]int)
+
+	tree, err := client.GetFileTree(ctx, owner, repo, branch)
+	if err != nil {
+		log.Printf("[Analysis] Warning: Failed to fetch tree: %v", err)
+	} else {
+		for _, node := range tree.Tree {
+			switch node.Type {
+			case "blob":
+				fileCount++
+				ext := ""
+				if idx := strings.LastIndex(node.Path, "."); idx != -1 {
+					ext = node.Path[idx:]
+				}
+				filesByExt[ext]++
+
+				parts := strings.Split(node.Path, "/")
+				if len(parts) > 1 {
+					dirFileCounts[parts[0]]++
+				}
+			case "tree":
+				dirCount++
+			}
+		}
+	}
+
+	var topDirs []DirectoryInfo
+	for dir, count := range dirFileCounts {
+		topDirs = append(topDirs, DirectoryInfo{Path: dir, FileCount: count})
+	}
+	sort.Slice(topDirs, func(i, j int) bool {
+		return topDirs[i].FileCount > topDirs[j].FileCount
+	})
+	if len(topDirs) > 10 {
+		topDirs = topDirs[:10]
+	}
+
+	var dependencies []DependencyDetail
+	depCount := 0
+
+	if content, err := client.GetFileContent(ctx, owner, repo, "package.json"); err == nil && content != nil {
+		var pkg struct {
+			Dependencies    map[string]string `json:"dependencies"`
+			DevDependencies map[string]string `json:"devDependencies"`
+		}
+		if json.Unmarshal(content, &pkg) == nil {
+			for name, version := range pkg.Dependencies {
+				dependencies = append(dependencies, DependencyDetail{Name: name, Version: version, Type: "production"})
+				depCount++
+			}
+			for name, version := range pkg.DevDependencies {
+				dependencies = append(dependencies, DependencyDetail{Name: name, Version: version, Type: "development"})
+				depCount++
+			}
+		}
+	}
+
+	if content, err := client.GetFileContent(ctx, owner, repo, "requirements.txt"); err == nil && content != nil {
+		lines := strings.Split(string(content), "\n")
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			re := regexp.MustCompile(`^([a-zA-Z0-9_-]+)([><=!]+)?(.*)$`)
+			if matches := re.FindStringSubmatch(line); matches != nil {
+				dependencies = append(dependencies, DependencyDetail{
+					Name:    matches[1],
+					Version: strings.TrimSpace(matches[3]),
+					Type:    "production",
+				})
+				depCount++
+			}
+		}
+	}
+
+	if content, err := client.GetFileContent(ctx, owner, repo, "go.mod"); err == nil && content != nil {
+		lines := strings.Split(string(content), "\n")
+		inRequire := false
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "require (") {
+				inRequire = true
+				continue
+			}
+			if line == ")" {
+				inRequire = false
+				continue
+			}
+			if inRequire || strings.HasPrefix(line, "require ") {
+				parts := strings.Fields(strings.TrimPrefix(line, "require "))
+				if len(parts) >= 2 {
+					dependencies = append(dependencies, DependencyDetail{
+						Name:    parts[0],
+						Version: parts[1],
+						Type:    "production",
+					})
+					depCount++
+				}
+			}
+		}
+	}
+
+	commitTimeline := make(map[string]int)
+	now := time.Now()
+	thirtyDaysAgo := now.AddDate(0, 0, -30)
+	commitsLast30 := 0
+
+	var recentCommits []CommitSummary
+	for i, c := range commits {
+		dateStr := c.Commit.Author.Date.Format("2006-01-02")
+		commitTimeline[dateStr]++
+
+		if c.Commit.Author.Date.After(thirtyDaysAgo) {
+			commitsLast30++
+		}
+
+		if i < 10 {
+			message := c.Commit.Message
+			if len(message) > 80 {
+				message = message[:80] + "..."
+			}
+
+			// Intent classification for recent commits
+			// We try to get files for the most recent to be more accurate
+			files, _ := client.GetCommitFiles(ctx, owner, repo, c.SHA)
+			intent, conf, signal := classifyCommitIntent(c.Commit.Message, files)
+
+			recentCommits = append(recentCommits, CommitSummary{
+				SHA:              c.SHA[:7],
+				Message:          message,
+				Author:           c.Commit.Author.Name,
+				Date:             c.Commit.Author.Date,
+				Intent:           intent,
+				Confidence:       conf,
+				TriggeringSignal: signal,
+			})
+		}
+	}
+
+	var timelineSlice []CommitTimelinePoint
+	for date, count := range commitTimeline {
+		timelineSlice = append(timelineSlice, CommitTimelinePoint{Date: date, Count: count})
+	}
+	sort.Slice(timelineSlice, func(i, j int) bool {
+		return timelineSlice[i].Date < timelineSlice[j].Date
+	})
+
+	repoAge := int(now.Sub(repoData.UpdatedAt).Hours() / 24 / 30)
+	daysSincePush := int(now.Sub(repoData.PushedAt).Hours() / 24)
+
+	activityScore := float64(commitsLast30) / 10.0
+	if activityScore > 10 {
+		activityScore = 10
+	}
+
+	stalenessScore := float64(daysSincePush) / 30.0
+
+	teamRiskScore := 1.0
+	if len(contributors) > 0 {
+		teamRiskScore = 1.0 / float64(len(contributors))
+	}
+
+	trend := "stable"
+	if commitsLast30 > 10 {
+		trend = "active"
+	} else if commitsLast30 < 3 {
+		trend = "declining"
+	}
+
+	analysis := &RepoAnalysis{
+		Ref:               target,
+		FetchedAt:         now,
+		RepoAgeMonths:     repoAge,
+		DaysSinceLastPush: daysSincePush,
+		TotalCommits:      len(commits),
+		CommitsLast30Days: commitsLast30,
+		CommitsTrend:      trend,
+		ContributorCount:  len(contributors),
+		DependencyCount:   depCount,
+		FileCount:         fileCount,
+		DirectoryCount:    dirCount,
+		TopDirectories:    topDirs,
+		Dependencies:      dependencies,
+		RecentCommits:     recentCommits,
+		CommitTimeline:    timelineSlice,
+		CommitActivity:    activity,
+		FilesByExtension:  filesByExt,
+		ActivityScore:     activityScore,
+		StalenessScore:    stalenessScore,
+		TeamRiskScore:     teamRiskScore,
+	}
+
+	// Compute Risk Trajectory from real GitHub stats
+	trajectory := analyzeTrajectory(ctx, client, owner, repo, tree)
+	analysis.Trajectory = trajectory
+
+	// Submodule files only feed the structural analyzers
+	submodules, structureTree := detectSubmodules(ctx, client, owner, repo, tree)
+	analysis.Submodules = submodules
+
+	graph := buildImportGraph(ctx, client, owner, repo, structureTree, submodules)
+	topology := analyzeTopology(structureTree, submodules, graph)
+	impact := analyzeImpact(topology, structureTree)
+	analysis.Impact = impact
+
+	// Compute Change Concentration from commit diffs
+	concentration := analyzeConcentration(ctx, client, owner, repo, window)
+	analysis.Concentration = concentration
+
+	// Compute Real Dependency Graph from import statements
+	deps := analyzeDependencies(ctx, client, owner, repo, tree, concentration)
+	analysis.Deps = deps
+
+	// Compute Temporal Hotspots from commit timestamps and diffs
+	temporal := analyzeTemporal(ctx, client, owner, repo, window)
+	analysis.Temporal = temporal
+
+	// Bus Factor Deepening - Joins authorship with criticality
+	busFactor := analyzeBusFactor(ctx, client, owner, repo, window, deps, concentration)
+	analysis.BusFactor = busFactor
+
+	// Embed into concentration for frontend consumption in Team View
+	if concentration != nil {
+		concentration.OwnershipRisk = busFactor
+	}
+
+	// Documentation Drift Analysis
+	docDrift := analyzeDocDrift(ctx, client, owner, repo, window)
+	analysis.DocDrift = docDrift
+
+	// Commit Intent Classification
+	intentAnalysis := analyzeCommitIntents(ctx, client, owner, repo, commits)
+	analysis.IntentAnalysis = intentAnalysis
+
+	// Structural Depth Analysis
+	structuralDepth := analyzeStructuralDepth(structureTree)
+	analysis.StructuralDepth = structuralDepth
+
+	// Activity Volatility Analysis
+	volatility := analyzeActivityVolatility(commits)
+	analysis.Volatility = volatility
+
+	// Test Surface Ratio Analysis
+	testSurface := analyzeTestSurface(tree, dependencies)
+	analysis.TestSurface = testSurface
+
+	// Privacy & Security Signal Consistency Check
+	securityAnalysis := analyzeSecurityConsistency(ctx, client, owner, repo, treeNodes(tree), dependencies)
+	analysis.SecurityAnalysis = securityAnalysis
+
+	log.Printf("[Analysis] Complete: %d files, %d commits, %d deps", fileCount, len(commits), depCount)
+	return analysis, nil
+}
+
+// ==================== RISK TRAJECTORY ANALYSIS ====================
+
+// analyzeTrajectory computes risk trajectory from real GitHub stats API
+// Returns weekly snapshots of risk scores computed from commit activity and code churn.
+// tree only feeds the structural part of its confidence.
+func analyzeTrajectory(ctx context.Context, client RepoDataSource, owner, repo string, tree *GitHubTreeResponse) *TrajectoryAnalysis {
+	log.Printf("[Trajectory] Starting trajectory analysis for %s/%s", owner, repo)
+
+	// Parallel fetch: commit activity and code frequency
+	var wg sync.WaitGroup
+	var commitActivity []CommitActivityWeek
+	var codeFrequency []CodeFrequencyWeek
+	var errActivity, errFrequency error
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		commitActivity, errActivity = client.GetCommitActivity(ctx, owner, repo)
+	}()
+	go func() {
+		defer wg.Done()
+		codeFrequency, errFrequency = client.GetCodeFrequency(ctx, owner, repo)
+	}()
+	wg.Wait()
+
+	if errActivity != nil {
+		log.Printf("[Trajectory] Warning: Failed to fetch commit activity: %v", errActivity)
+		return &TrajectoryAnalysis{
+			Available: false,
+			Reason:    "Failed to fetch commit activity",
+			Snapshots: make([]TrajectorySnapshot, 0),
+		}
+	}
+
+	if errFrequency != nil {
+		log.Printf("[Trajectory] Warning: Failed to fetch code frequency: %v", errFrequency)
+		// Continue without code frequency data
+		codeFrequency = []CodeFrequencyWeek{}
+	}
+
+	if len(commitActivity) == 0 {
+		return &TrajectoryAnalysis{
+			Available: false,
+			Reason:    "GitHub is computing repository statistics. Please try again in a few moments.",
+			Snapshots: make([]TrajectorySnapshot, 0),
+		}
+	}
+
+	// Create code frequency lookup by week timestamp
+	codeFreqMap := make(map[int64]CodeFrequencyWeek)
+	for _, cf := range codeFrequency {
+		codeFreqMap[int64(cf.Week)] = cf
+	}
+
+	// Calculate baseline metrics
+	totalCommits := 0
+	totalChurn := 0
+	activeWeeks := 0
+	for _, week := range commitActivity {
+		totalCommits += week.Total
+		if week.Total > 0 {
+			activeWeeks++
+		}
+		if cf, ok := codeFreqMap[week.Week]; ok {
+			totalChurn += abs(cf.Additions) + abs(cf.Deletions)
+		}
+	}
+
+	if activeWeeks == 0 {
+		return &TrajectoryAnalysis{
+			Available: false,
+			Reason:    "No active weeks in history",
+			Snapshots: make([]TrajectorySnapshot, 0),
+		}
+	}
+
+	avgCommitsPerWeek := float64(totalCommits) / float64(len(commitActivity))
+	avgChurnPerWeek := float64(totalChurn) / float64(len(commitActivity))
+	if avgChurnPerWeek == 0 {
+		avgChurnPerWeek = 1 // Prevent division by zero
+	}
+
+	// Build trajectory snapshots
+	snapshots := make([]TrajectorySnapshot, 0)
+	var previousRisk float64
+	peakRiskScore := 0.0
+	peakRiskWeek := ""
+
+	for _, week := range commitActivity {
+		weekTime := time.Unix(week.Week, 0)
+		weekStart := weekTime.Format("2006-01-02")
+		_, weekNum := weekTime.ISOWeek()
+		dateLabel := fmt.Sprintf("%d-W%02d", weekTime.Year(), weekNum)
+
+		// Get code frequency for this week
+		additions := 0
+		deletions := 0
+		if cf, ok := codeFreqMap[week.Week]; ok {
+			additions = abs(cf.Additions)
+			deletions = abs(cf.Deletions)
+		}
+
+		churnScore := float64(additions + deletions)
+
+		// Compute risk score:
 		// Risk = BaseRisk + (ChurnFactor * VelocityFactor)
 		// ChurnFactor = churn / avgChurn
 		// VelocityFactor = commits / avgCommits
@@ -1941,341 +6016,2220 @@ func analyzeTrajectory(client *GitHubClient, owner, repo string) *TrajectoryAnal
 		if avgCommitsPerWeek > 0 {
 			velocityFactor = float64(week.Total) / avgCommitsPerWeek
 		}
-		churnFactor := 1.0
-		if avgChurnPerWeek > 0 {
-			churnFactor = churnScore / avgChurnPerWeek
+		churnFactor := 1.0
+		if avgChurnPerWeek > 0 {
+			churnFactor = churnScore / avgChurnPerWeek
+		}
+
+		baseRisk := 25.0 // Baseline risk
+		riskScore := baseRisk + (churnFactor * 15) + (velocityFactor * 10)
+		if riskScore > 100 {
+			riskScore = 100
+		}
+
+		// Calculate delta from previous week
+		riskDelta := riskScore - previousRisk
+		previousRisk = riskScore
+
+		// Track peak risk
+		if riskScore > peakRiskScore {
+			peakRiskScore = riskScore
+			peakRiskWeek = dateLabel
+		}
+
+		snapshots = append(snapshots, TrajectorySnapshot{
+			Date:        dateLabel,
+			WeekStart:   weekStart,
+			CommitCount: week.Total,
+			Additions:   additions,
+			Deletions:   deletions,
+			ChurnScore:  churnScore,
+			RiskScore:   riskScore,
+			RiskDelta:   riskDelta,
+		})
+	}
+
+	// Calculate velocity trend (comparing recent 4 weeks to previous 4 weeks)
+	velocityTrend := "stable"
+	velocityFactor := 1.0
+	if len(snapshots) >= 8 {
+		recent4 := snapshots[len(snapshots)-4:]
+		previous4 := snapshots[len(snapshots)-8 : len(snapshots)-4]
+
+		recentCommits := 0
+		previousCommits := 0
+		for _, s := range recent4 {
+			recentCommits += s.CommitCount
+		}
+		for _, s := range previous4 {
+			previousCommits += s.CommitCount
+		}
+
+		if previousCommits > 0 {
+			velocityFactor = float64(recentCommits) / float64(previousCommits)
+			if velocityFactor > 1.2 {
+				velocityTrend = "accelerating"
+			} else if velocityFactor < 0.8 {
+				velocityTrend = "decelerating"
+			}
+		}
+	}
+
+	// Calculate overall risk trend
+	overallTrend := "stable"
+	if len(snapshots) >= 4 {
+		recent := snapshots[len(snapshots)-4:]
+		avgRecentRisk := 0.0
+		for _, s := range recent {
+			avgRecentRisk += s.RiskScore
+		}
+		avgRecentRisk /= 4
+
+		older := snapshots[:4]
+		avgOlderRisk := 0.0
+		for _, s := range older {
+			avgOlderRisk += s.RiskScore
+		}
+		avgOlderRisk /= 4
+
+		if avgRecentRisk > avgOlderRisk*1.1 {
+			overallTrend = "increasing_risk"
+		} else if avgRecentRisk < avgOlderRisk*0.9 {
+			overallTrend = "decreasing_risk"
+		}
+	}
+
+	// Determine confidence level
+	confidence := "low"
+	if len(snapshots) >= 12 {
+		confidence = "medium"
+	}
+	if len(snapshots) >= 26 && activeWeeks >= 10 {
+		confidence = "high"
+	}
+
+	log.Printf("[Trajectory] Complete: %d weeks, velocity=%.2fx, trend=%s", len(snapshots), velocityFactor, overallTrend)
+	fileCount, hasManifest := treeFileStats(tree)
+
+	return &TrajectoryAnalysis{
+		Available:       true,
+		Snapshots:       snapshots,
+		VelocityTrend:   velocityTrend,
+		VelocityFactor:  velocityFactor,
+		OverallTrend:    overallTrend,
+		ConfidenceLevel: confidence,
+		TotalWeeks:      len(snapshots),
+		PeakRiskWeek:    peakRiskWeek,
+		PeakRiskScore:   peakRiskScore,
+		Confidence:      computeAnalysisConfidence(totalCommits, fileCount, len(snapshots), hasManifest, treeCompleteness(tree)),
+	}
+}
+
+// abs returns absolute value of int
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// ==================== IMPACT & EXPOSURE ANALYSIS ====================
+
+// importCoverageConfidence scales the tree's structural confidence by the
+// share of source files the import graph parsed: fan-in and blast radius only
+// see edges from those files
+func importCoverageConfidence(tree *GitHubTreeResponse, parsed, source int) *AnalysisConfidence {
+	confidence := computeStructuralConfidence(tree)
+	if confidence == nil || source == 0 {
+		return confidence
+	}
+	coverage := float64(parsed) / float64(source)
+	confidence.Overall *= coverage
+	confidence.Explanation += fmt.Sprintf("; dependencies read from %d of %d source files (%.0f%%)", parsed, source, coverage*100)
+	return confidence
+}
+
+// analyzeImpact computes impact propagation from topology data
+// All fragility, blast radius, and exposure values are derived from real structure
+func analyzeImpact(topology *TopologyAnalysis, tree *GitHubTreeResponse) *ImpactAnalysis {
+	log.Printf("[Impact] Starting impact analysis")
+
+	if topology == nil || !topology.Available || len(topology.Modules) == 0 {
+		return &ImpactAnalysis{
+			Available:   false,
+			Reason:      "Topology data unavailable",
+			ImpactUnits: make([]ImpactUnit, 0),
+		}
+	}
+
+	// Build adjacency maps from edges
+	// fanIn: who depends on me (dependents)
+	// fanOut: who I depend on (dependencies)
+	fanIn := make(map[string]int)
+	fanOut := make(map[string]int)
+	dependents := make(map[string][]string)   // module -> list of modules that depend on it
+	dependencies := make(map[string][]string) // module -> list of modules it depends on
+
+	for _, edge := range topology.Edges {
+		fanOut[edge.Source]++
+		fanIn[edge.Target]++
+		dependents[edge.Target] = append(dependents[edge.Target], edge.Source)
+		dependencies[edge.Source] = append(dependencies[edge.Source], edge.Target)
+	}
+
+	// Build file paths map for each module
+	modulePaths := make(map[string][]string)
+	if tree != nil {
+		for _, node := range tree.Tree {
+			if node.Type == "blob" {
+				if sub := submoduleOf(node.Path, topology.Submodules); sub != "" {
+					modulePaths[sub] = append(modulePaths[sub], node.Path)
+					continue
+				}
+				parts := strings.Split(node.Path, "/")
+				if len(parts) > 0 {
+					moduleName := parts[0]
+					// Handle root files
+					if len(parts) == 1 {
+						moduleName = "(root)"
+					}
+					modulePaths[moduleName] = append(modulePaths[moduleName], node.Path)
+				}
+			}
+		}
+	}
+
+	// Calculate max values for normalization
+	maxFanIn := 1
+	maxFanOut := 1
+	maxFiles := 1
+	for _, m := range topology.Modules {
+		if fanIn[m.Name] > maxFanIn {
+			maxFanIn = fanIn[m.Name]
+		}
+		if fanOut[m.Name] > maxFanOut {
+			maxFanOut = fanOut[m.Name]
+		}
+		if m.FileCount > maxFiles {
+			maxFiles = m.FileCount
+		}
+	}
+
+	// Detect cyclic dependencies (simplified: check if A->B and B->A exist)
+	cyclic := make(map[string]bool)
+	for _, edge := range topology.Edges {
+		for _, dep := range dependencies[edge.Target] {
+			if dep == edge.Source {
+				cyclic[edge.Source] = true
+				cyclic[edge.Target] = true
+			}
+		}
+	}
+
+	// Compute blast radius via BFS (transitive dependents)
+	computeBlastRadius := func(moduleName string) int {
+		visited := make(map[string]bool)
+		queue := []string{moduleName}
+		visited[moduleName] = true
+		count := 0
+
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, dep := range dependents[current] {
+				if !visited[dep] {
+					visited[dep] = true
+					queue = append(queue, dep)
+					count++
+				}
+			}
+		}
+		return count
+	}
+
+	// Build impact units
+	impactUnits := make([]ImpactUnit, 0, len(topology.Modules))
+	totalModules := len(topology.Modules)
+
+	var mostFragile string
+	var largestBlast string
+	maxFragility := 0.0
+	maxBlastRadius := 0
+
+	criticalCount := 0
+	highCount := 0
+	mediumCount := 0
+	lowCount := 0
+
+	for _, module := range topology.Modules {
+		fIn := fanIn[module.Name]
+		fOut := fanOut[module.Name]
+		isCyclic := cyclic[module.Name]
+		blastRadius := computeBlastRadius(module.Name)
+		filePaths := modulePaths[module.Name]
+		if filePaths == nil {
+			filePaths = make([]string, 0)
+		}
+
+		// Fragility formula:
+		// (fanIn/maxFanIn * 0.25) + (fanOut/maxFanOut * 0.25) + (cyclic * 0.2) + (fileCount/maxFiles * 0.3)
+		fanInNorm := float64(fIn) / float64(maxFanIn)
+		fanOutNorm := float64(fOut) / float64(maxFanOut)
+		fileNorm := float64(module.FileCount) / float64(maxFiles)
+		cyclicPenalty := 0.0
+		if isCyclic {
+			cyclicPenalty = 0.2
+		}
+
+		fragility := (fanInNorm*0.25 + fanOutNorm*0.25 + cyclicPenalty + fileNorm*0.3) * 100
+		if fragility > 100 {
+			fragility = 100
+		}
+
+		// Exposure scope classification
+		var exposureScope string
+		dependentRatio := float64(fIn) / float64(totalModules)
+		if module.External {
+			exposureScope = "external"
+		} else if dependentRatio > 0.5 {
+			exposureScope = "system-wide"
+		} else if fIn > fOut && fIn > 2 {
+			exposureScope = "transactional"
+		} else if fOut > fIn {
+			exposureScope = "downstream"
+		} else {
+			exposureScope = "external"
+		}
+
+		// Trend based on computed fragility (not historical - would need trajectory data)
+		trend := "stabilizing"
+		if fragility > 70 {
+			trend = "accelerating"
+		} else if fragility < 30 {
+			trend = "improving"
+		}
+
+		unit := ImpactUnit{
+			Name:           module.Name,
+			FilePaths:      filePaths,
+			FileCount:      module.FileCount,
+			FragilityScore: fragility,
+			ExposureScope:  exposureScope,
+			BlastRadius:    blastRadius,
+			Trend:          trend,
+			FanIn:          fIn,
+			FanOut:         fOut,
+			IsCyclic:       isCyclic,
+			External:       module.External,
+		}
+
+		impactUnits = append(impactUnits, unit)
+
+		// Track max fragility
+		if fragility > maxFragility {
+			maxFragility = fragility
+			mostFragile = module.Name
+		}
+
+		// Track max blast radius
+		if blastRadius > maxBlastRadius {
+			maxBlastRadius = blastRadius
+			largestBlast = module.Name
+		}
+
+		// Count by severity
+		if fragility >= 75 {
+			criticalCount++
+		} else if fragility >= 50 {
+			highCount++
+		} else if fragility >= 25 {
+			mediumCount++
+		} else {
+			lowCount++
+		}
+	}
+
+	// Sort by fragility descending
+	sort.Slice(impactUnits, func(i, j int) bool {
+		return impactUnits[i].FragilityScore > impactUnits[j].FragilityScore
+	})
+
+	log.Printf("[Impact] Complete: %d units, critical=%d, high=%d", len(impactUnits), criticalCount, highCount)
+
+	return &ImpactAnalysis{
+		Available:     true,
+		ImpactUnits:   impactUnits,
+		TotalModules:  totalModules,
+		CriticalCount: criticalCount,
+		HighCount:     highCount,
+		MediumCount:   mediumCount,
+		LowCount:      lowCount,
+		MostFragile:   mostFragile,
+		LargestBlast:  largestBlast,
+		EdgeSource:    topology.EdgeSource,
+		Confidence:    importCoverageConfidence(tree, topology.ParsedFiles, topology.SourceFiles),
+	}
+}
+
+// ==================== SOURCE IMPORT GRAPH ====================
+
+// maxImportGraphFiles caps the source files one topology run reads
+const maxImportGraphFiles = 100
+
+var (
+	pyModuleRe      = regexp.MustCompile(`^(?:\.+|\.*[A-Za-z_][A-Za-z0-9_.]*)$`)
+	pyRequirementRe = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\[[^\]]*\])?\s*(?:(?:===|==|~=|>=|<=|!=|>|<)\s*([^\s,;#]+))?`)
+	pyNameSepRe     = regexp.MustCompile(`[-_.]+`)
+	pyQuotedRe      = regexp.MustCompile(`"([^"]*)"|'([^']*)'`)
+
+	// Static imports and re-exports (also multi-line and side-effect only),
+	// then dynamic import() and require()
+	jsImportRe      = regexp.MustCompile(`\b(?:(?:import|export)\s+(?:[^'";()=]*?\s*from\s*)?['"]([^'"\n]+)['"]|(?:import|require)\s*\(\s*['"]([^'"\n]+)['"]\s*\))`)
+	lineCommentRe   = regexp.MustCompile(`(?m)^\s*//.*$`)
+	trailingCommaRe = regexp.MustCompile(`,(\s*[}\]])`)
+
+	jvmPackageRe   = regexp.MustCompile(`(?m)^\s*package\s+([A-Za-z_][\w.]*)`)
+	jvmImportRe    = regexp.MustCompile(`(?m)^\s*import\s+(?:static\s+)?([A-Za-z_][\w.]*(?:\.\*)?)`)
+	rustUseRe      = regexp.MustCompile(`(?m)^\s*(?:pub(?:\([^)]*\))?\s+)?use\s+([^;]+);`)
+	rustModRe      = regexp.MustCompile(`(?m)^\s*(?:pub(?:\([^)]*\))?\s+)?mod\s+([A-Za-z_]\w*)\s*;`)
+	rustExternRe   = regexp.MustCompile(`(?m)^\s*extern\s+crate\s+([A-Za-z_]\w*)`)
+	csUsingRe      = regexp.MustCompile(`(?m)^\s*(?:global\s+)?using\s+(?:static\s+)?(?:[A-Za-z_]\w*\s*=\s*)?([A-Za-z_][\w.]*)\s*;`)
+	csNamespaceRe  = regexp.MustCompile(`(?m)^\s*namespace\s+([A-Za-z_][\w.]*)`)
+	rbRequireRe    = regexp.MustCompile(`(?m)^\s*(require|require_relative)\s*\(?\s*['"]([^'"]+)['"]`)
+	gemRe          = regexp.MustCompile(`(?m)^\s*gem\s+['"]([^'"]+)['"](?:\s*,\s*['"]([^'"]+)['"])?`)
+	phpUseRe       = regexp.MustCompile(`(?m)^\s*use\s+(?:function\s+|const\s+)?([A-Za-z_\\][^;(]*);`)
+	phpNamespaceRe = regexp.MustCompile(`(?m)^\s*namespace\s+([A-Za-z_][\w\\]*)`)
+	phpRequireRe   = regexp.MustCompile(`\b(?:require|require_once|include|include_once)\s*\(?\s*(__DIR__\s*\.\s*)?['"]([^'"]+)['"]`)
+	csRootNsRe     = regexp.MustCompile(`<RootNamespace>\s*([^<\s]+)\s*</RootNamespace>`)
+	csPackageRefRe = regexp.MustCompile(`<PackageReference\b([^>]*)>`)
+	xmlIncludeRe   = regexp.MustCompile(`\bInclude\s*=\s*"([^"]+)"`)
+	xmlVersionRe   = regexp.MustCompile(`\bVersion\s*=\s*"([^"]+)"`)
+)
+
+// nodeBuiltins are the Node.js core modules, imported with or without "node:"
+var nodeBuiltins = map[string]bool{
+	"assert": true, "async_hooks": true, "buffer": true, "child_process": true, "cluster": true,
+	"console": true, "crypto": true, "dgram": true, "dns": true, "events": true, "fs": true,
+	"http": true, "http2": true, "https": true, "inspector": true, "module": true, "net": true,
+	"os": true, "path": true, "perf_hooks": true, "process": true, "querystring": true,
+	"readline": true, "stream": true, "string_decoder": true, "timers": true, "tls": true,
+	"tty": true, "url": true, "util": true, "v8": true, "vm": true, "worker_threads": true, "zlib": true,
+}
+
+// pythonStdlib are the top-level modules of the Python 3 standard library:
+// sys.stdlib_module_names of Python 3.11, which still ships modules later
+// releases removed (distutils, imp, asyncore, ...) that older code imports
+var pythonStdlib = func() map[string]bool {
+	modules := make(map[string]bool)
+	for _, name := range strings.Fields(`__future__ _abc _aix_support _ast _asyncio _bisect _blake2 _bootsubprocess _bz2 _codecs _codecs_cn
+		_codecs_hk _codecs_iso2022 _codecs_jp _codecs_kr _codecs_tw _collections _collections_abc
+		_compat_pickle _compression _contextvars _crypt _csv _ctypes _curses _curses_panel _datetime _dbm
+		_decimal _elementtree _frozen_importlib _frozen_importlib_external _functools _gdbm _hashlib _heapq
+		_imp _io _json _locale _lsprof _lzma _markupbase _md5 _msi _multibytecodec _multiprocessing _opcode
+		_operator _osx_support _overlapped _pickle _posixshmem _posixsubprocess _py_abc _pydecimal _pyio
+		_queue _random _scproxy _sha1 _sha256 _sha3 _sha512 _signal _sitebuiltins _socket _sqlite3 _sre _ssl
+		_stat _statistics _string _strptime _struct _symtable _thread _threading_local _tkinter _tokenize
+		_tracemalloc _typing _uuid _warnings _weakref _weakrefset _winapi _zoneinfo abc aifc antigravity
+		argparse array ast asynchat asyncio asyncore atexit audioop base64 bdb binascii bisect builtins bz2
+		cProfile calendar cgi cgitb chunk cmath cmd code codecs codeop collections colorsys compileall
+		concurrent configparser contextlib contextvars copy copyreg crypt csv ctypes curses dataclasses
+		datetime dbm decimal difflib dis distutils doctest email encodings ensurepip enum errno faulthandler
+		fcntl filecmp fileinput fnmatch fractions ftplib functools gc genericpath getopt getpass gettext
+		glob graphlib grp gzip hashlib heapq hmac html http idlelib imaplib imghdr imp importlib inspect io
+		ipaddress itertools json keyword lib2to3 linecache locale logging lzma mailbox mailcap marshal math
+		mimetypes mmap modulefinder msilib msvcrt multiprocessing netrc nis nntplib nt ntpath nturl2path
+		numbers opcode operator optparse os ossaudiodev pathlib pdb pickle pickletools pipes pkgutil
+		platform plistlib poplib posix posixpath pprint profile pstats pty pwd py_compile pyclbr pydoc
+		pydoc_data pyexpat queue quopri random re readline reprlib resource rlcompleter runpy sched secrets
+		select selectors shelve shlex shutil signal site smtpd smtplib sndhdr socket socketserver spwd
+		sqlite3 sre_compile sre_constants sre_parse ssl stat statistics string stringprep struct subprocess
+		sunau symtable sys sysconfig syslog tabnanny tarfile telnetlib tempfile termios textwrap this
+		threading time timeit tkinter token tokenize tomllib trace traceback tracemalloc tty turtle
+		turtledemo types typing unicodedata unittest urllib uu uuid venv warnings wave weakref webbrowser
+		winreg winsound wsgiref xdrlib xml xmlrpc zipapp zipfile zipimport zlib zoneinfo`) {
+		modules[name] = true
+	}
+	return modules
+}()
+
+// pythonDistributions maps import names to the distribution that installs
+// them, where the two differ
+var pythonDistributions = map[string]string{
+	"attr": "attrs", "bs4": "beautifulsoup4", "Crypto": "pycryptodome", "cv2": "opencv-python",
+	"dateutil": "python-dateutil", "docx": "python-docx", "dotenv": "python-dotenv", "git": "GitPython",
+	"jose": "python-jose", "jwt": "PyJWT", "magic": "python-magic", "MySQLdb": "mysqlclient",
+	"OpenSSL": "pyOpenSSL", "PIL": "Pillow", "serial": "pyserial", "skimage": "scikit-image",
+	"sklearn": "scikit-learn", "yaml": "PyYAML", "zmq": "pyzmq",
+}
+
+// SourceImport is one import statement found in a source file
+type SourceImport struct {
+	File   string // Importing file
+	Spec   string // Imported module as written
+	Line   string // The import statement
+	Target string // Repo path it resolves to (directories end in "/"); empty when outside the repo
+
+	Kind    string // "internal", "external" or "stdlib", once resolved
+	Package string // External package or module the import belongs to
+	Version string // Version of Package declared by the nearest manifest
+
+	Namespace string // Package or namespace the importing file declares (Java, Kotlin, C#, PHP)
+}
+
+// ImportGraph is the imports of the source files that could be read
+type ImportGraph struct {
+	Imports     []SourceImport
+	SourceFiles int // Source files in the tree
+	ParsedFiles int // Source files read and scanned
+}
+
+// isImportSource reports whether imports are extracted from files like filePath
+func isImportSource(filePath string) bool {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".py", ".js", ".ts", ".jsx", ".tsx", ".mjs", ".cjs", ".go",
+		".java", ".kt", ".kts", ".rs", ".cs", ".rb", ".php":
+		return true
+	}
+	return false
+}
+
+// isJSSource reports whether filePath is JavaScript or TypeScript
+func isJSSource(filePath string) bool {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".js", ".ts", ".jsx", ".tsx", ".mjs", ".cjs":
+		return true
+	}
+	return false
+}
+
+// extractImports lists the import statements of a source file, unresolved
+func extractImports(filePath string, content []byte) []SourceImport {
+	var matches [][]string
+	switch ext := strings.ToLower(filepath.Ext(filePath)); {
+	case ext == ".py":
+		return extractPythonImports(filePath, content)
+	case isJSSource(filePath):
+		// Commented-out imports are not dependencies
+		matches = jsImportRe.FindAllStringSubmatch(lineCommentRe.ReplaceAllString(string(content), ""), -1)
+	case ext == ".go":
+		return extractGoImports(filePath, content)
+	case ext == ".java" || ext == ".kt" || ext == ".kts":
+		return extractJVMImports(filePath, content)
+	case ext == ".rs":
+		return extractRustImports(filePath, content)
+	case ext == ".cs":
+		return extractCSharpImports(filePath, content)
+	case ext == ".rb":
+		return extractRubyImports(filePath, content)
+	case ext == ".php":
+		return extractPHPImports(filePath, content)
+	}
+
+	imports := make([]SourceImport, 0, len(matches))
+	for _, match := range matches {
+		spec := ""
+		for i := 1; i < len(match); i++ {
+			if match[i] != "" {
+				spec = match[i]
+				break
+			}
+		}
+		spec = strings.Trim(spec, `"' `)
+		if spec == "" {
+			continue
+		}
+		imports = append(imports, SourceImport{File: filePath, Spec: spec, Line: strings.Join(strings.Fields(match[0]), " ")})
+	}
+	return imports
+}
+
+// extractPythonImports lists the modules a Python file imports, including
+// indented and multi-line statements. "from x import a, b" yields x.a and x.b
+// so that imported submodules resolve to their own files.
+func extractPythonImports(filePath string, content []byte) []SourceImport {
+	var imports []SourceImport
+	lines := strings.Split(string(content), "\n")
+	for i := 0; i < len(lines); i++ {
+		stmt := pyCode(lines[i])
+		if !strings.HasPrefix(stmt, "import ") && !strings.HasPrefix(stmt, "from ") {
+			continue
+		}
+		for (strings.HasSuffix(stmt, "\\") || strings.Count(stmt, "(") > strings.Count(stmt, ")")) && i+1 < len(lines) {
+			i++
+			stmt = strings.TrimSuffix(stmt, "\\") + " " + pyCode(lines[i])
+		}
+		stmt = strings.Join(strings.Fields(stmt), " ")
+
+		var specs []string
+		if rest, ok := strings.CutPrefix(stmt, "import "); ok {
+			for _, name := range strings.Split(rest, ",") {
+				if fields := strings.Fields(name); len(fields) > 0 {
+					specs = append(specs, fields[0])
+				}
+			}
+		} else if module, names, ok := strings.Cut(strings.TrimPrefix(stmt, "from "), " import "); ok {
+			module = strings.TrimSpace(module)
+			for _, name := range strings.Split(strings.Trim(strings.TrimSpace(names), "()"), ",") {
+				fields := strings.Fields(name)
+				switch {
+				case len(fields) == 0:
+				case fields[0] == "*":
+					specs = append(specs, module)
+				case strings.HasSuffix(module, "."):
+					specs = append(specs, module+fields[0])
+				default:
+					specs = append(specs, module+"."+fields[0])
+				}
+			}
+		}
+
+		for _, spec := range specs {
+			if pyModuleRe.MatchString(spec) {
+				imports = append(imports, SourceImport{File: filePath, Spec: spec, Line: stmt})
+			}
+		}
+	}
+	return imports
+}
+
+// extractJVMImports lists the imports of a Java or Kotlin file, tagged with
+// the package it declares
+func extractJVMImports(filePath string, content []byte) []SourceImport {
+	code := lineCommentRe.ReplaceAllString(string(content), "")
+	namespace := ""
+	if match := jvmPackageRe.FindStringSubmatch(code); match != nil {
+		namespace = match[1]
+	}
+	var imports []SourceImport
+	for _, match := range jvmImportRe.FindAllStringSubmatch(code, -1) {
+		imports = append(imports, SourceImport{File: filePath, Spec: match[1], Line: strings.TrimSpace(match[0]), Namespace: namespace})
+	}
+	return imports
+}
+
+// extractRustImports lists the paths a Rust file brings in with use (grouped
+// paths expanded), the files its mod declarations load (as self::name) and
+// its extern crates
+func extractRustImports(filePath string, content []byte) []SourceImport {
+	code := lineCommentRe.ReplaceAllString(string(content), "")
+	var imports []SourceImport
+	for _, match := range rustUseRe.FindAllStringSubmatch(code, -1) {
+		line := strings.Join(strings.Fields(match[0]), " ")
+		for _, tree := range splitTopLevel(match[1]) {
+			for _, spec := range expandUseGroups(tree, "::") {
+				imports = append(imports, SourceImport{File: filePath, Spec: strings.TrimPrefix(spec, "::"), Line: line})
+			}
+		}
+	}
+	for _, match := range rustModRe.FindAllStringSubmatch(code, -1) {
+		imports = append(imports, SourceImport{File: filePath, Spec: "self::" + match[1], Line: strings.TrimSpace(match[0])})
+	}
+	for _, match := range rustExternRe.FindAllStringSubmatch(code, -1) {
+		imports = append(imports, SourceImport{File: filePath, Spec: match[1], Line: strings.TrimSpace(match[0])})
+	}
+	return imports
+}
+
+// extractCSharpImports lists the using directives of a C# file, tagged with
+// the namespace it declares
+func extractCSharpImports(filePath string, content []byte) []SourceImport {
+	code := lineCommentRe.ReplaceAllString(string(content), "")
+	namespace := ""
+	if match := csNamespaceRe.FindStringSubmatch(code); match != nil {
+		namespace = match[1]
+	}
+	var imports []SourceImport
+	for _, match := range csUsingRe.FindAllStringSubmatch(code, -1) {
+		imports = append(imports, SourceImport{File: filePath, Spec: match[1], Line: strings.TrimSpace(match[0]), Namespace: namespace})
+	}
+	return imports
+}
+
+// extractRubyImports lists require and require_relative calls; relative
+// ones get a "./" spec so they resolve against the requiring file
+func extractRubyImports(filePath string, content []byte) []SourceImport {
+	var imports []SourceImport
+	for _, match := range rbRequireRe.FindAllStringSubmatch(string(content), -1) {
+		spec := match[2]
+		if match[1] == "require_relative" && !strings.HasPrefix(spec, ".") {
+			spec = "./" + spec
+		}
+		imports = append(imports, SourceImport{File: filePath, Spec: spec, Line: strings.TrimSpace(match[0])})
+	}
+	return imports
+}
+
+// extractPHPImports lists use declarations (grouped ones expanded) tagged
+// with the file's namespace, and literal require/include paths as "./"
+// relative specs
+func extractPHPImports(filePath string, content []byte) []SourceImport {
+	code := lineCommentRe.ReplaceAllString(string(content), "")
+	namespace := ""
+	if match := phpNamespaceRe.FindStringSubmatch(code); match != nil {
+		namespace = match[1]
+	}
+	var imports []SourceImport
+	for _, match := range phpUseRe.FindAllStringSubmatch(code, -1) {
+		line := strings.Join(strings.Fields(match[0]), " ")
+		for _, tree := range splitTopLevel(match[1]) {
+			for _, spec := range expandUseGroups(tree, "\\") {
+				imports = append(imports, SourceImport{File: filePath, Spec: strings.TrimPrefix(spec, "\\"), Line: line, Namespace: namespace})
+			}
+		}
+	}
+	for _, match := range phpRequireRe.FindAllStringSubmatch(code, -1) {
+		spec := match[2]
+		if !strings.HasPrefix(spec, ".") {
+			spec = "./" + strings.TrimPrefix(spec, "/")
+		}
+		imports = append(imports, SourceImport{File: filePath, Spec: spec, Line: strings.TrimSpace(match[0])})
+	}
+	return imports
+}
+
+// splitTopLevel splits s at commas outside braces
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// expandUseGroups flattens a grouped import such as a::{b, c::{d, e}} (Rust)
+// or A\{B, C} (PHP) into one path per name, dropping aliases
+func expandUseGroups(tree, sep string) []string {
+	tree = strings.TrimSpace(tree)
+	open := strings.Index(tree, "{")
+	if open == -1 {
+		if fields := strings.Fields(tree); len(fields) > 0 {
+			return []string{fields[0]}
+		}
+		return nil
+	}
+	end := strings.LastIndex(tree, "}")
+	if end < open {
+		return nil
+	}
+	prefix := strings.TrimSpace(tree[:open])
+	var paths []string
+	for _, item := range splitTopLevel(tree[open+1 : end]) {
+		switch item = strings.TrimSpace(item); {
+		case item == "":
+		case item == "self" || strings.HasPrefix(item, "self "):
+			paths = append(paths, strings.TrimSuffix(prefix, sep))
+		default:
+			for _, sub := range expandUseGroups(item, sep) {
+				paths = append(paths, prefix+sub)
+			}
 		}
+	}
+	return paths
+}
 
-		baseRisk := 25.0 // Baseline risk
-		riskScore := baseRisk + (churnFactor * 15) + (velocityFactor * 10)
-		if riskScore > 100 {
-			riskScore = 100
+// pyCode is a source line without indentation or comment
+func pyCode(line string) string {
+	if idx := strings.Index(line, "#"); idx != -1 {
+		line = line[:idx]
+	}
+	return strings.TrimSpace(line)
+}
+
+// extractGoImports parses only the import declarations of a Go file, so
+// grouped, aliased and dot imports are all seen. A file with a syntax error
+// still yields the imports parsed before it.
+func extractGoImports(filePath string, content []byte) []SourceImport {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filePath, content, parser.ImportsOnly)
+	if file == nil {
+		log.Printf("[Imports] Could not parse %s: %v", filePath, err)
+		return nil
+	}
+
+	imports := make([]SourceImport, 0, len(file.Imports))
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || importPath == "" {
+			continue
 		}
+		line := "import " + spec.Path.Value
+		if spec.Name != nil {
+			line = "import " + spec.Name.Name + " " + spec.Path.Value
+		}
+		imports = append(imports, SourceImport{File: filePath, Spec: importPath, Line: line})
+	}
+	return imports
+}
 
-		// Calculate delta from previous week
-		riskDelta := riskScore - previousRisk
-		previousRisk = riskScore
+// goModule is a go.mod file of the tree
+type goModule struct {
+	Dir      string            // Directory holding go.mod, "" at the root
+	Path     string            // Declared module path
+	Requires map[string]string // Required module path -> version
+}
 
-		// Track peak risk
-		if riskScore > peakRiskScore {
-			peakRiskScore = riskScore
-			peakRiskWeek = dateLabel
+// parseGoMod reads the module path and require entries of a go.mod file
+func parseGoMod(content []byte) (string, map[string]string) {
+	modulePath := ""
+	requires := make(map[string]string)
+	inRequire := false
+	for _, line := range strings.Split(string(content), "\n") {
+		if idx := strings.Index(line, "//"); idx != -1 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case inRequire && fields[0] == ")":
+			inRequire = false
+		case inRequire && len(fields) >= 2:
+			requires[strings.Trim(fields[0], `"`)] = fields[1]
+		case fields[0] == "module" && len(fields) >= 2:
+			modulePath = strings.Trim(fields[1], `"`)
+		case fields[0] == "require" && len(fields) >= 2 && fields[1] == "(":
+			inRequire = true
+		case fields[0] == "require(":
+			inRequire = true
+		case fields[0] == "require" && len(fields) >= 3:
+			requires[strings.Trim(fields[1], `"`)] = fields[2]
+		}
+	}
+	return modulePath, requires
+}
+
+// importResolver maps import specs to files and directories of a tree, and
+// to the manifests that declare what lies outside it
+type importResolver struct {
+	files      map[string]bool
+	dirs       map[string]bool
+	goModules  []goModule          // Longest module path first
+	jsPackages []jsPackage         // Deepest directory first
+	jsConfigs  []jsConfig          // Deepest directory first
+	workspaces map[string]string   // Workspace package name -> directory
+	pyRoots    []string            // Directories absolute Python imports resolve against
+	pyPackages []pyManifest        // Deepest directory first
+	jvmClasses map[string][]string // Java/Kotlin file name without extension -> paths
+	rustCrates []rustCrate         // Deepest directory first
+	csProjects []csProject         // Longest root namespace first
+	rbRoots    []string            // Directories require resolves against
+	gemfiles   []gemfile           // Deepest directory first
+	composers  []composerPackage   // Deepest directory first
+}
+
+// newImportResolver indexes tree and reads the manifests import resolution
+// depends on
+func newImportResolver(ctx context.Context, client RepoDataSource, owner, repo string, tree *GitHubTreeResponse) *importResolver {
+	r := &importResolver{files: make(map[string]bool), dirs: make(map[string]bool), workspaces: make(map[string]string)}
+	r.jvmClasses = make(map[string][]string)
+	var jsManifests, pyManifests, otherManifests []string
+	for _, node := range treeNodes(tree) {
+		if node.Type != "blob" {
+			continue
+		}
+		r.files[node.Path] = true
+		for dir := path.Dir(node.Path); dir != "." && !r.dirs[dir]; dir = path.Dir(dir) {
+			r.dirs[dir] = true
+		}
+		switch path.Base(node.Path) {
+		case "package.json", "tsconfig.json", "jsconfig.json", "pnpm-workspace.yaml":
+			if !strings.Contains("/"+node.Path, "/node_modules/") {
+				jsManifests = append(jsManifests, node.Path)
+			}
+		case "pyproject.toml":
+			pyManifests = append(pyManifests, node.Path)
+		case "Cargo.toml", "Gemfile":
+			otherManifests = append(otherManifests, node.Path)
+		case "composer.json":
+			if !strings.Contains("/"+node.Path, "/vendor/") {
+				otherManifests = append(otherManifests, node.Path)
+			}
+		case "go.mod":
+			content, err := client.GetFileContent(ctx, owner, repo, node.Path)
+			if err != nil {
+				continue
+			}
+			modulePath, requires := parseGoMod(content)
+			if modulePath == "" {
+				continue
+			}
+			dir := path.Dir(node.Path)
+			if dir == "." {
+				dir = ""
+			}
+			r.goModules = append(r.goModules, goModule{Dir: dir, Path: modulePath, Requires: requires})
+		default:
+			switch ext := path.Ext(node.Path); {
+			case isRequirementsFile(node.Path):
+				pyManifests = append(pyManifests, node.Path)
+			case ext == ".csproj":
+				otherManifests = append(otherManifests, node.Path)
+			case ext == ".java" || ext == ".kt" || ext == ".kts":
+				name := strings.TrimSuffix(path.Base(node.Path), ext)
+				r.jvmClasses[name] = append(r.jvmClasses[name], node.Path)
+			}
 		}
+	}
+	sort.Slice(r.goModules, func(i, j int) bool { return len(r.goModules[i].Path) > len(r.goModules[j].Path) })
+	r.loadJSManifests(ctx, client, owner, repo, jsManifests)
+	r.loadPythonManifests(ctx, client, owner, repo, pyManifests)
+	r.loadOtherManifests(ctx, client, owner, repo, otherManifests)
+	return r
+}
+
+// resolve fills in the target, kind and package of an extracted import
+func (r *importResolver) resolve(imp *SourceImport) {
+	switch strings.ToLower(filepath.Ext(imp.File)) {
+	case ".go":
+		r.resolveGo(imp)
+	case ".py":
+		r.resolvePython(imp)
+	case ".java", ".kt", ".kts":
+		r.resolveJVM(imp)
+	case ".rs":
+		r.resolveRust(imp)
+	case ".cs":
+		r.resolveCSharp(imp)
+	case ".rb":
+		r.resolveRuby(imp)
+	case ".php":
+		r.resolvePHP(imp)
+	default:
+		r.resolveJS(imp)
+	}
+}
 
-		snapshots = append(snapshots, TrajectorySnapshot{
-			Date:        dateLabel,
-			WeekStart:   weekStart,
-			CommitCount: week.Total,
-			Additions:   additions,
-			Deletions:   deletions,
-			ChurnScore:  churnScore,
-			RiskScore:   riskScore,
-			RiskDelta:   riskDelta,
-		})
+// probe returns the first of base+suffix that is a file, then base itself if
+// it is a directory (with a trailing "/")
+func (r *importResolver) probe(base string, dirOK bool, suffixes ...string) string {
+	if base == "" || base == "." || strings.HasPrefix(base, "../") {
+		return ""
+	}
+	for _, suffix := range suffixes {
+		if r.files[base+suffix] {
+			return base + suffix
+		}
+	}
+	if dirOK && r.dirs[base] {
+		return base + "/"
 	}
+	return ""
+}
 
-	// Calculate velocity trend (comparing recent 4 weeks to previous 4 weeks)
-	velocityTrend := "stable"
-	velocityFactor := 1.0
-	if len(snapshots) >= 8 {
-		recent4 := snapshots[len(snapshots)-4:]
-		previous4 := snapshots[len(snapshots)-8 : len(snapshots)-4]
+// resolveGo classifies a Go import path. Paths under a module declared in the
+// tree are internal and map to that module's directory. Other paths whose
+// first element has no dot are the standard library; the rest are external
+// and belong to the longest matching require entry, preferring the go.mod
+// nearest the importing file.
+func (r *importResolver) resolveGo(imp *SourceImport) {
+	spec := imp.Spec
+	for _, mod := range r.goModules {
+		if spec == mod.Path || strings.HasPrefix(spec, mod.Path+"/") {
+			imp.Kind = "internal"
+			imp.Target = r.probe(path.Join(mod.Dir, strings.TrimPrefix(spec[len(mod.Path):], "/")), true)
+			return
+		}
+	}
+
+	parts := strings.Split(spec, "/")
+	if !strings.Contains(parts[0], ".") {
+		// Trees without go.mod may still import their own packages GOPATH-style
+		if imp.Target = r.probe(spec, true); imp.Target != "" {
+			imp.Kind = "internal"
+		} else {
+			imp.Kind = "stdlib"
+		}
+		return
+	}
+
+	imp.Kind = "external"
+	imp.Package = spec
+	if len(r.goModules) == 0 {
+		// Without go.mod, match the longest trailing part that is a directory
+		for i := 0; i < len(parts); i++ {
+			if target := r.probe(strings.Join(parts[i:], "/"), true); target != "" {
+				imp.Kind = "internal"
+				imp.Target = target
+				imp.Package = ""
+				return
+			}
+		}
+		return
+	}
+	for _, mod := range r.goModulesFor(imp.File) {
+		best := ""
+		for required := range mod.Requires {
+			if (spec == required || strings.HasPrefix(spec, required+"/")) && len(required) > len(best) {
+				best = required
+			}
+		}
+		if best != "" {
+			imp.Package = best
+			imp.Version = mod.Requires[best]
+			return
+		}
+	}
+}
+
+// goModulesFor orders the tree's modules by how closely they enclose file,
+// nearest first, with unrelated modules last
+func (r *importResolver) goModulesFor(file string) []goModule {
+	ordered := make([]goModule, 0, len(r.goModules))
+	var unrelated []goModule
+	for _, mod := range r.goModules {
+		if mod.Dir == "" || strings.HasPrefix(file, mod.Dir+"/") {
+			ordered = append(ordered, mod)
+		} else {
+			unrelated = append(unrelated, mod)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return len(ordered[i].Dir) > len(ordered[j].Dir) })
+	return append(ordered, unrelated...)
+}
+
+// jsPackage is a package.json of the tree
+type jsPackage struct {
+	Dir        string            // Directory holding package.json, "" at the root
+	Name       string            // Declared package name
+	Deps       map[string]string // Package -> declared version, all dependency kinds
+	Workspaces []string          // Workspace globs, relative to Dir
+}
+
+// jsConfig is the module resolution part of a tsconfig.json or jsconfig.json
+type jsConfig struct {
+	Dir       string              // Directory the config applies below
+	BaseURL   string              // Repo directory bare specifiers resolve against; empty when unset
+	PathsBase string              // Repo directory paths targets are relative to
+	Paths     map[string][]string // Path alias pattern -> target patterns
+}
+
+// stripJSONComments removes comments and trailing commas, which tsconfig.json
+// allows but encoding/json does not
+func stripJSONComments(content []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if inString {
+			out.WriteByte(c)
+			if c == '\\' && i+1 < len(content) {
+				i++
+				out.WriteByte(content[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		if c == '/' && i+1 < len(content) && content[i+1] == '/' {
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			out.WriteByte('\n')
+			continue
+		}
+		if c == '/' && i+1 < len(content) && content[i+1] == '*' {
+			end := bytes.Index(content[i+2:], []byte("*/"))
+			if end == -1 {
+				break
+			}
+			i += end + 3
+			continue
+		}
+		if c == '"' {
+			inString = true
+		}
+		out.WriteByte(c)
+	}
+	return trailingCommaRe.ReplaceAll(out.Bytes(), []byte("$1"))
+}
+
+// parsePnpmWorkspace reads the package globs of a pnpm-workspace.yaml
+func parsePnpmWorkspace(content []byte) []string {
+	var globs []string
+	inPackages := false
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, "-") {
+			inPackages = strings.HasPrefix(trimmed, "packages:")
+			continue
+		}
+		if inPackages && strings.HasPrefix(trimmed, "-") {
+			globs = append(globs, strings.Trim(strings.TrimSpace(trimmed[1:]), `"'`))
+		}
+	}
+	return globs
+}
+
+// matchesWorkspace reports whether dir matches a workspace glob; a trailing
+// "**" matches any depth
+func matchesWorkspace(glob, dir string) bool {
+	glob = strings.TrimSuffix(strings.TrimPrefix(glob, "./"), "/")
+	if prefix, ok := strings.CutSuffix(glob, "/**"); ok {
+		return dir == prefix || strings.HasPrefix(dir, prefix+"/")
+	}
+	matched, _ := path.Match(glob, dir)
+	return matched
+}
+
+// manifestDir returns the directory of a manifest path, "" at the root
+func manifestDir(manifestPath string) string {
+	if dir := path.Dir(manifestPath); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// loadJSManifests reads package.json files for dependency versions and
+// workspaces, and tsconfig/jsconfig files (following relative "extends") for
+// baseUrl and paths
+func (r *importResolver) loadJSManifests(ctx context.Context, client RepoDataSource, owner, repo string, manifests []string) {
+	var workspaceRoots []jsPackage
+	for _, manifest := range manifests {
+		// tsconfig.json wins over a jsconfig.json in the same directory
+		if path.Base(manifest) == "jsconfig.json" && r.files[path.Join(path.Dir(manifest), "tsconfig.json")] {
+			continue
+		}
+		content, err := client.GetFileContent(ctx, owner, repo, manifest)
+		if err != nil {
+			continue
+		}
+		dir := manifestDir(manifest)
+		switch path.Base(manifest) {
+		case "package.json":
+			var pkg struct {
+				Name       string            `json:"name"`
+				Deps       map[string]string `json:"dependencies"`
+				DevDeps    map[string]string `json:"devDependencies"`
+				PeerDeps   map[string]string `json:"peerDependencies"`
+				Workspaces json.RawMessage   `json:"workspaces"`
+			}
+			if err := json.Unmarshal(content, &pkg); err != nil {
+				continue
+			}
+			entry := jsPackage{Dir: dir, Name: pkg.Name, Deps: make(map[string]string)}
+			for _, deps := range []map[string]string{pkg.PeerDeps, pkg.DevDeps, pkg.Deps} {
+				for name, version := range deps {
+					entry.Deps[name] = version
+				}
+			}
+			// Either a list of globs or {"packages": [...]}
+			if json.Unmarshal(pkg.Workspaces, &entry.Workspaces) != nil {
+				var yarnWorkspaces struct {
+					Packages []string `json:"packages"`
+				}
+				if json.Unmarshal(pkg.Workspaces, &yarnWorkspaces) == nil {
+					entry.Workspaces = yarnWorkspaces.Packages
+				}
+			}
+			r.jsPackages = append(r.jsPackages, entry)
+			if len(entry.Workspaces) > 0 {
+				workspaceRoots = append(workspaceRoots, entry)
+			}
+		case "pnpm-workspace.yaml":
+			workspaceRoots = append(workspaceRoots, jsPackage{Dir: dir, Workspaces: parsePnpmWorkspace(content)})
+		default:
+			if cfg, ok := r.loadJSConfig(ctx, client, owner, repo, manifest, content, 0); ok {
+				cfg.Dir = dir
+				r.jsConfigs = append(r.jsConfigs, cfg)
+			}
+		}
+	}
+
+	for _, root := range workspaceRoots {
+		for _, pkg := range r.jsPackages {
+			if pkg.Name == "" || pkg.Dir == root.Dir {
+				continue
+			}
+			rel := pkg.Dir
+			if root.Dir != "" {
+				if !strings.HasPrefix(pkg.Dir, root.Dir+"/") {
+					continue
+				}
+				rel = pkg.Dir[len(root.Dir)+1:]
+			}
+			for _, glob := range root.Workspaces {
+				if !strings.HasPrefix(glob, "!") && matchesWorkspace(glob, rel) {
+					r.workspaces[pkg.Name] = pkg.Dir
+					break
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(r.jsPackages, func(i, j int) bool { return len(r.jsPackages[i].Dir) > len(r.jsPackages[j].Dir) })
+	sort.SliceStable(r.jsConfigs, func(i, j int) bool { return len(r.jsConfigs[i].Dir) > len(r.jsConfigs[j].Dir) })
+}
+
+// loadJSConfig parses the compilerOptions of a tsconfig/jsconfig file,
+// inheriting what it leaves unset from a relative "extends" within the tree
+func (r *importResolver) loadJSConfig(ctx context.Context, client RepoDataSource, owner, repo, configPath string, content []byte, depth int) (jsConfig, bool) {
+	var raw struct {
+		Extends         string `json:"extends"`
+		CompilerOptions struct {
+			BaseURL *string             `json:"baseUrl"`
+			Paths   map[string][]string `json:"paths"`
+		} `json:"compilerOptions"`
+	}
+	if err := json.Unmarshal(stripJSONComments(content), &raw); err != nil {
+		return jsConfig{}, false
+	}
+	dir := manifestDir(configPath)
+	cfg := jsConfig{PathsBase: dir, Paths: raw.CompilerOptions.Paths}
+	if raw.CompilerOptions.BaseURL != nil {
+		cfg.BaseURL = path.Join(dir, *raw.CompilerOptions.BaseURL)
+		cfg.PathsBase = cfg.BaseURL
+	}
+
+	if strings.HasPrefix(raw.Extends, ".") && depth < 5 {
+		parentPath := path.Join(dir, raw.Extends)
+		if !strings.HasSuffix(parentPath, ".json") && !r.files[parentPath] {
+			parentPath += ".json"
+		}
+		if r.files[parentPath] {
+			if parentContent, err := client.GetFileContent(ctx, owner, repo, parentPath); err == nil {
+				if parent, ok := r.loadJSConfig(ctx, client, owner, repo, parentPath, parentContent, depth+1); ok {
+					if raw.CompilerOptions.BaseURL == nil {
+						cfg.BaseURL = parent.BaseURL
+						if cfg.Paths == nil {
+							cfg.PathsBase = parent.PathsBase
+						} else if parent.BaseURL != "" {
+							cfg.PathsBase = parent.BaseURL
+						}
+					}
+					if cfg.Paths == nil {
+						cfg.Paths = parent.Paths
+					}
+				}
+			}
+		}
+	}
+	return cfg, true
+}
+
+// jsPackageName is the npm package a bare specifier imports from, keeping
+// the scope of scoped packages
+func jsPackageName(spec string) string {
+	parts := strings.SplitN(spec, "/", 3)
+	if strings.HasPrefix(spec, "@") && len(parts) >= 2 {
+		return parts[0] + "/" + parts[1]
+	}
+	return parts[0]
+}
+
+// probeJS resolves a JS/TS module path to a file, trying extensions and index
+// files, and TypeScript sources for ".js" specifiers
+func (r *importResolver) probeJS(base string) string {
+	if target := r.probe(base, false, "", ".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs", ".d.ts"); target != "" {
+		return target
+	}
+	if ext := path.Ext(base); ext == ".js" || ext == ".jsx" || ext == ".mjs" {
+		if target := r.probe(strings.TrimSuffix(base, ext), false, ".ts", ".tsx", ".mts"); target != "" {
+			return target
+		}
+	}
+	return r.probe(base, true, "/index.ts", "/index.tsx", "/index.js", "/index.jsx", "/index.mjs")
+}
+
+// resolveJS classifies a JS/TS specifier: relative paths, tsconfig/jsconfig
+// aliases and workspace packages are internal; Node.js core modules are the
+// standard library; other bare specifiers are external packages, versioned
+// by the nearest package.json that declares them
+func (r *importResolver) resolveJS(imp *SourceImport) {
+	spec := imp.Spec
+	if strings.HasPrefix(spec, ".") {
+		imp.Kind = "internal"
+		imp.Target = r.probeJS(path.Join(path.Dir(imp.File), spec))
+		return
+	}
+
+	if cfg := r.jsConfigFor(imp.File); cfg != nil {
+		if target := r.resolveJSAlias(cfg, spec); target != "" {
+			imp.Kind = "internal"
+			imp.Target = target
+			return
+		}
+	}
+
+	name := jsPackageName(spec)
+	if dir, ok := r.workspaces[name]; ok {
+		imp.Kind = "internal"
+		if subpath := strings.TrimPrefix(spec[len(name):], "/"); subpath != "" {
+			imp.Target = r.probeJS(path.Join(dir, subpath))
+		}
+		if imp.Target == "" {
+			imp.Target = dir + "/"
+		}
+		return
+	}
+
+	if strings.HasPrefix(spec, "node:") || nodeBuiltins[name] {
+		imp.Kind = "stdlib"
+		return
+	}
+
+	imp.Kind = "external"
+	imp.Package = name
+	for _, pkg := range r.jsPackages {
+		if pkg.Dir == "" || strings.HasPrefix(imp.File, pkg.Dir+"/") {
+			if version, ok := pkg.Deps[name]; ok {
+				imp.Version = version
+				return
+			}
+		}
+	}
+}
+
+// jsConfigFor returns the tsconfig/jsconfig nearest above file, if any
+func (r *importResolver) jsConfigFor(file string) *jsConfig {
+	for i := range r.jsConfigs {
+		if r.jsConfigs[i].Dir == "" || strings.HasPrefix(file, r.jsConfigs[i].Dir+"/") {
+			return &r.jsConfigs[i]
+		}
+	}
+	return nil
+}
+
+// resolveJSAlias resolves spec through the longest matching paths pattern,
+// then against baseUrl
+func (r *importResolver) resolveJSAlias(cfg *jsConfig, spec string) string {
+	bestPrefix, wildcard := -1, ""
+	var targets []string
+	for pattern, patternTargets := range cfg.Paths {
+		prefix, suffix, hasStar := strings.Cut(pattern, "*")
+		switch {
+		case !hasStar && spec == pattern:
+			if len(pattern) > bestPrefix {
+				bestPrefix, wildcard, targets = len(pattern), "", patternTargets
+			}
+		case hasStar && len(spec) >= len(prefix)+len(suffix) && strings.HasPrefix(spec, prefix) && strings.HasSuffix(spec, suffix):
+			if len(prefix) > bestPrefix {
+				bestPrefix, wildcard, targets = len(prefix), spec[len(prefix):len(spec)-len(suffix)], patternTargets
+			}
+		}
+	}
+	for _, target := range targets {
+		if resolved := r.probeJS(path.Join(cfg.PathsBase, strings.Replace(target, "*", wildcard, 1))); resolved != "" {
+			return resolved
+		}
+	}
+	if cfg.BaseURL != "" {
+		return r.probeJS(path.Join(cfg.BaseURL, spec))
+	}
+	return ""
+}
+
+// pyManifest is a requirements file or pyproject.toml of the tree
+type pyManifest struct {
+	Dir  string                   // Directory holding the manifest, "" at the root
+	Deps map[string]pyRequirement // Normalized distribution name -> requirement
+}
+
+// pyRequirement is a declared Python distribution
+type pyRequirement struct {
+	Name    string // As written in the manifest
+	Version string // Version in the specifier, if any
+}
+
+// isRequirementsFile reports whether filePath is a pip requirements file:
+// requirements*.txt or a .txt file in a requirements/ directory
+func isRequirementsFile(filePath string) bool {
+	name := strings.ToLower(path.Base(filePath))
+	if !strings.HasSuffix(name, ".txt") {
+		return false
+	}
+	return strings.HasPrefix(name, "requirements") || path.Base(path.Dir(filePath)) == "requirements"
+}
+
+// normalizePyName normalizes a distribution name as pip compares them
+func normalizePyName(name string) string {
+	return strings.ToLower(pyNameSepRe.ReplaceAllString(name, "-"))
+}
+
+// parseRequirement reads a PEP 508 requirement such as "requests[socks]>=2.31"
+func parseRequirement(spec string) (pyRequirement, bool) {
+	match := pyRequirementRe.FindStringSubmatch(strings.TrimSpace(spec))
+	if match == nil {
+		return pyRequirement{}, false
+	}
+	return pyRequirement{Name: match[1], Version: match[2]}, true
+}
+
+// parsePyproject reads the dependencies a pyproject.toml declares (PEP 621 and
+// Poetry) and the directories its build backend finds packages in, relative
+// to the file
+func parsePyproject(content []byte) ([]pyRequirement, []string) {
+	var reqs []pyRequirement
+	var roots []string
+	table, inArray := "", ""
+	for _, line := range strings.Split(string(content), "\n") {
+		line = pyCode(line)
+		if line == "" {
+			continue
+		}
+		if inArray != "" {
+			// Continuation of a multi-line array
+			for _, quoted := range pyQuotedRe.FindAllStringSubmatch(line, -1) {
+				value := quoted[1] + quoted[2]
+				if inArray == "dependencies" {
+					if req, ok := parseRequirement(value); ok {
+						reqs = append(reqs, req)
+					}
+				} else {
+					roots = append(roots, value)
+				}
+			}
+			if strings.Contains(pyQuotedRe.ReplaceAllString(line, ""), "]") {
+				inArray = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			table = strings.Trim(line, "[] ")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.Trim(strings.TrimSpace(key), `"'`), strings.TrimSpace(value)
+
+		switch {
+		case table == "project" && key == "dependencies", table == "project.optional-dependencies",
+			table == "tool.setuptools.packages.find" && key == "where":
+			arrayKind := "dependencies"
+			if key == "where" {
+				arrayKind = "roots"
+			}
+			if !strings.HasPrefix(value, "[") {
+				continue
+			}
+			for _, quoted := range pyQuotedRe.FindAllStringSubmatch(value, -1) {
+				item := quoted[1] + quoted[2]
+				if arrayKind == "roots" {
+					roots = append(roots, item)
+				} else if req, ok := parseRequirement(item); ok {
+					reqs = append(reqs, req)
+				}
+			}
+			if !strings.Contains(pyQuotedRe.ReplaceAllString(value, ""), "]") {
+				inArray = arrayKind
+			}
+		case table == "tool.poetry.dependencies" || table == "tool.poetry.dev-dependencies" ||
+			strings.HasPrefix(table, "tool.poetry.group.") && strings.HasSuffix(table, ".dependencies"):
+			if key == "python" {
+				continue
+			}
+			req := pyRequirement{Name: key}
+			if quoted := pyQuotedRe.FindStringSubmatch(value); quoted != nil && !strings.HasPrefix(value, "{") {
+				req.Version = strings.TrimLeft(quoted[1]+quoted[2], "^~=<>! ")
+			} else if _, version, ok := strings.Cut(value, "version"); ok {
+				if quoted := pyQuotedRe.FindStringSubmatch(version); quoted != nil {
+					req.Version = strings.TrimLeft(quoted[1]+quoted[2], "^~=<>! ")
+				}
+			}
+			reqs = append(reqs, req)
+		case table == "tool.poetry" && key == "packages":
+			// packages = [{ include = "app", from = "src" }]
+			if _, from, ok := strings.Cut(value, "from"); ok {
+				if quoted := pyQuotedRe.FindStringSubmatch(from); quoted != nil {
+					roots = append(roots, quoted[1]+quoted[2])
+				}
+			}
+		case table == "tool.setuptools" && key == "package-dir":
+			// package-dir = {"" = "src"}
+			if quoted := pyQuotedRe.FindAllStringSubmatch(value, -1); len(quoted) == 2 && quoted[0][0] == `""` {
+				roots = append(roots, quoted[1][1]+quoted[1][2])
+			}
+		case table == "tool.hatch.build.targets.wheel" && key == "packages":
+			for _, quoted := range pyQuotedRe.FindAllStringSubmatch(value, -1) {
+				roots = append(roots, path.Dir(quoted[1]+quoted[2]))
+			}
+		}
+	}
+	return reqs, roots
+}
 
-		recentCommits := 0
-		previousCommits := 0
-		for _, s := range recent4 {
-			recentCommits += s.CommitCount
+// loadPythonManifests reads declared distributions from requirements files
+// and pyproject.toml, and sets the package roots: the repo root, src/, the
+// directory above each top-level package (a directory with __init__.py
+// whose parent has none) and the roots pyproject files declare
+func (r *importResolver) loadPythonManifests(ctx context.Context, client RepoDataSource, owner, repo string, manifests []string) {
+	rootSet := map[string]bool{"": true}
+	if r.dirs["src"] {
+		rootSet["src"] = true
+	}
+	for file := range r.files {
+		if path.Base(file) != "__init__.py" {
+			continue
 		}
-		for _, s := range previous4 {
-			previousCommits += s.CommitCount
+		pkg := path.Dir(file)
+		for pkg != "." && r.files[path.Join(path.Dir(pkg), "__init__.py")] {
+			pkg = path.Dir(pkg)
+		}
+		if pkg != "." {
+			rootSet[manifestDir(pkg)] = true
 		}
+	}
 
-		if previousCommits > 0 {
-			velocityFactor = float64(recentCommits) / float64(previousCommits)
-			if velocityFactor > 1.2 {
-				velocityTrend = "accelerating"
-			} else if velocityFactor < 0.8 {
-				velocityTrend = "decelerating"
+	for _, manifest := range manifests {
+		content, err := client.GetFileContent(ctx, owner, repo, manifest)
+		if err != nil {
+			continue
+		}
+		entry := pyManifest{Dir: manifestDir(manifest), Deps: make(map[string]pyRequirement)}
+		var reqs []pyRequirement
+		if path.Base(manifest) == "pyproject.toml" {
+			var roots []string
+			reqs, roots = parsePyproject(content)
+			for _, root := range roots {
+				if root = path.Join(entry.Dir, root); root == "." {
+					root = ""
+				}
+				rootSet[root] = true
+			}
+		} else {
+			for _, line := range strings.Split(string(content), "\n") {
+				line = pyCode(line)
+				if line == "" || strings.HasPrefix(line, "-") || strings.Contains(line, "://") {
+					continue
+				}
+				if req, ok := parseRequirement(line); ok {
+					reqs = append(reqs, req)
+				}
 			}
 		}
+		for _, req := range reqs {
+			entry.Deps[normalizePyName(req.Name)] = req
+		}
+		r.pyPackages = append(r.pyPackages, entry)
 	}
+	sort.SliceStable(r.pyPackages, func(i, j int) bool { return len(r.pyPackages[i].Dir) > len(r.pyPackages[j].Dir) })
 
-	// Calculate overall risk trend
-	overallTrend := "stable"
-	if len(snapshots) >= 4 {
-		recent := snapshots[len(snapshots)-4:]
-		avgRecentRisk := 0.0
-		for _, s := range recent {
-			avgRecentRisk += s.RiskScore
+	for root := range rootSet {
+		r.pyRoots = append(r.pyRoots, root)
+	}
+	sort.Strings(r.pyRoots)
+}
+
+// probePython maps a dotted module path under dir to the file that defines
+// it, falling back to the longest prefix that is a module (for imported
+// names) and then to a namespace package directory
+func (r *importResolver) probePython(dir string, parts []string) string {
+	if len(parts) == 0 {
+		return r.probe(dir, true, "/__init__.py")
+	}
+	for n := len(parts); n > 0; n-- {
+		if target := r.probe(path.Join(dir, strings.Join(parts[:n], "/")), false, ".py", "/__init__.py"); target != "" {
+			return target
 		}
-		avgRecentRisk /= 4
+	}
+	return r.probe(path.Join(dir, strings.Join(parts, "/")), true)
+}
 
-		older := snapshots[:4]
-		avgOlderRisk := 0.0
-		for _, s := range older {
-			avgOlderRisk += s.RiskScore
+// resolvePython resolves relative imports against the importing file's
+// package and absolute ones against the package roots, or the file's own
+// directory when it is a script outside any package. Other imports are the
+// standard library or an external distribution, named as the nearest
+// requirements file or pyproject.toml declares it.
+func (r *importResolver) resolvePython(imp *SourceImport) {
+	spec := imp.Spec
+	dots := len(spec) - len(strings.TrimLeft(spec, "."))
+	var parts []string
+	if spec[dots:] != "" {
+		parts = strings.Split(spec[dots:], ".")
+	}
+	if dots > 0 {
+		dir := path.Dir(imp.File)
+		for i := 1; i < dots; i++ {
+			dir = path.Dir(dir)
 		}
-		avgOlderRisk /= 4
+		if dir == "." {
+			dir = ""
+		}
+		imp.Kind = "internal"
+		imp.Target = r.probePython(dir, parts)
+		return
+	}
 
-		if avgRecentRisk > avgOlderRisk*1.1 {
-			overallTrend = "increasing_risk"
-		} else if avgRecentRisk < avgOlderRisk*0.9 {
-			overallTrend = "decreasing_risk"
+	top := parts[0]
+	if pythonStdlib[top] {
+		imp.Kind = "stdlib"
+		return
+	}
+	roots := r.pyRoots
+	if dir := manifestDir(imp.File); !r.files[path.Join(dir, "__init__.py")] {
+		roots = append([]string{dir}, roots...)
+	}
+	for _, root := range roots {
+		if target := r.probePython(root, parts); target != "" {
+			imp.Kind = "internal"
+			imp.Target = target
+			return
 		}
 	}
 
-	// Determine confidence level
-	confidence := "low"
-	if len(snapshots) >= 12 {
-		confidence = "medium"
+	imp.Kind = "external"
+	imp.Package = top
+	if dist, ok := pythonDistributions[top]; ok {
+		imp.Package = dist
 	}
-	if len(snapshots) >= 26 && activeWeeks >= 10 {
-		confidence = "high"
+	for _, manifest := range r.pyPackages {
+		if manifest.Dir != "" && !strings.HasPrefix(imp.File, manifest.Dir+"/") {
+			continue
+		}
+		for _, name := range []string{imp.Package, top} {
+			if req, ok := manifest.Deps[normalizePyName(name)]; ok {
+				imp.Package = req.Name
+				imp.Version = req.Version
+				return
+			}
+		}
 	}
+}
 
-	log.Printf("[Trajectory] Complete: %d weeks, velocity=%.2fx, trend=%s", len(snapshots), velocityFactor, overallTrend)
+// rustCrate is a Cargo.toml of the tree
+type rustCrate struct {
+	Dir  string            // Directory holding Cargo.toml, "" at the root
+	Name string            // Crate name as used in paths ("-" becomes "_"); empty for a virtual workspace
+	Deps map[string]string // Dependency as written -> version, all dependency tables
+}
 
-	return &TrajectoryAnalysis{
-		Available:       true,
-		Snapshots:       snapshots,
-		VelocityTrend:   velocityTrend,
-		VelocityFactor:  velocityFactor,
-		OverallTrend:    overallTrend,
-		ConfidenceLevel: confidence,
-		TotalWeeks:      len(snapshots),
-		PeakRiskWeek:    peakRiskWeek,
-		PeakRiskScore:   peakRiskScore,
-		Confidence:      computeAnalysisConfidence(totalCommits, 0, len(snapshots), false),
-	}
+// csProject is a .csproj file of the tree
+type csProject struct {
+	Dir       string            // Directory holding the project file
+	Namespace string            // RootNamespace, or the project file name
+	Packages  map[string]string // PackageReference -> version
 }
 
-// abs returns absolute value of int
-func abs(x int) int {
-	if x < 0 {
-		return -x
-	}
-	return x
+// gemfile is a Gemfile of the tree
+type gemfile struct {
+	Dir  string
+	Gems map[string]string // Gem -> version constraint, if any
 }
 
-// ==================== IMPACT & EXPOSURE ANALYSIS ====================
+// composerPackage is a composer.json of the tree
+type composerPackage struct {
+	Dir      string
+	Autoload map[string][]string // PSR-4/PSR-0 namespace prefix -> repo directories
+	Requires map[string]string   // vendor/package -> version constraint
+}
 
-// analyzeImpact computes impact propagation from topology data
-// All fragility, blast radius, and exposure values are derived from real structure
-func analyzeImpact(topology *TopologyAnalysis, tree *GitHubTreeResponse) *ImpactAnalysis {
-	log.Printf("[Impact] Starting impact analysis")
+// rubyStdlib are libraries that ship with Ruby
+var rubyStdlib = func() map[string]bool {
+	libs := make(map[string]bool)
+	for _, name := range strings.Fields(`abbrev base64 benchmark bigdecimal cgi coverage csv date delegate digest
+		English erb etc fiber fileutils find forwardable getoptlong io ipaddr json logger matrix monitor net
+		objspace observer open-uri open3 openssl optparse ostruct pathname pp prettyprint prime pstore psych
+		racc rbconfig readline resolv ripper securerandom set shellwords singleton socket stringio strscan
+		syslog tempfile time timeout tmpdir tsort un uri weakref webrick yaml zlib`) {
+		libs[name] = true
+	}
+	return libs
+}()
 
-	if topology == nil || !topology.Available || len(topology.Modules) == 0 {
-		return &ImpactAnalysis{
-			Available:   false,
-			Reason:      "Topology data unavailable",
-			ImpactUnits: make([]ImpactUnit, 0),
+// rubyGems maps require names to the gem that provides them, where the two
+// differ beyond "_" versus "-"
+var rubyGems = map[string]string{
+	"action_cable": "actioncable", "action_controller": "actionpack", "action_dispatch": "actionpack",
+	"action_mailer": "actionmailer", "action_view": "actionview", "active_job": "activejob",
+	"active_model": "activemodel", "active_record": "activerecord", "active_storage": "activestorage",
+	"active_support": "activesupport",
+}
+
+// parseCargoToml reads the package name and dependencies of a Cargo.toml
+func parseCargoToml(content []byte) (string, map[string]string) {
+	name := ""
+	deps := make(map[string]string)
+	table, tableDep := "", ""
+	isDepTable := func(t string) bool {
+		t = "." + t
+		return strings.HasSuffix(t, ".dependencies") || strings.HasSuffix(t, ".dev-dependencies") || strings.HasSuffix(t, ".build-dependencies")
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = pyCode(line)
+		if strings.HasPrefix(line, "[") {
+			table, tableDep = strings.Trim(line, "[] "), ""
+			// [dependencies.serde] holds one dependency's settings
+			if idx := strings.LastIndex(table, "."); idx != -1 && isDepTable(table[:idx]) {
+				tableDep = strings.Trim(table[idx+1:], `"'`)
+				deps[tableDep] = ""
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.Trim(strings.TrimSpace(key), `"'`), strings.TrimSpace(value)
+		switch {
+		case table == "package" && key == "name":
+			if quoted := pyQuotedRe.FindStringSubmatch(value); quoted != nil {
+				name = strings.ReplaceAll(quoted[1]+quoted[2], "-", "_")
+			}
+		case tableDep != "" && key == "version":
+			if quoted := pyQuotedRe.FindStringSubmatch(value); quoted != nil {
+				deps[tableDep] = quoted[1] + quoted[2]
+			}
+		case tableDep == "" && isDepTable(table):
+			version := ""
+			if !strings.HasPrefix(value, "{") {
+				if quoted := pyQuotedRe.FindStringSubmatch(value); quoted != nil {
+					version = quoted[1] + quoted[2]
+				}
+			} else if _, rest, ok := strings.Cut(value, "version"); ok {
+				if quoted := pyQuotedRe.FindStringSubmatch(rest); quoted != nil {
+					version = quoted[1] + quoted[2]
+				}
+			}
+			deps[key] = version
 		}
 	}
+	return name, deps
+}
 
-	// Build adjacency maps from edges
-	// fanIn: who depends on me (dependents)
-	// fanOut: who I depend on (dependencies)
-	fanIn := make(map[string]int)
-	fanOut := make(map[string]int)
-	dependents := make(map[string][]string)   // module -> list of modules that depend on it
-	dependencies := make(map[string][]string) // module -> list of modules it depends on
-
-	for _, edge := range topology.Edges {
-		fanOut[edge.Source]++
-		fanIn[edge.Target]++
-		dependents[edge.Target] = append(dependents[edge.Target], edge.Source)
-		dependencies[edge.Source] = append(dependencies[edge.Source], edge.Target)
+// stringOrList decodes a JSON string or list of strings
+func stringOrList(raw json.RawMessage) []string {
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		return list
 	}
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return []string{single}
+	}
+	return nil
+}
 
-	// Build file paths map for each module
-	modulePaths := make(map[string][]string)
-	if tree != nil {
-		for _, node := range tree.Tree {
-			if node.Type == "blob" {
-				parts := strings.Split(node.Path, "/")
-				if len(parts) > 0 {
-					moduleName := parts[0]
-					// Handle root files
-					if len(parts) == 1 {
-						moduleName = "(root)"
+// loadOtherManifests reads Cargo.toml, .csproj, Gemfile and composer.json
+// files, and sets the Ruby load path: the repo root and every lib/ directory
+func (r *importResolver) loadOtherManifests(ctx context.Context, client RepoDataSource, owner, repo string, manifests []string) {
+	for _, manifest := range manifests {
+		content, err := client.GetFileContent(ctx, owner, repo, manifest)
+		if err != nil {
+			continue
+		}
+		dir := manifestDir(manifest)
+		switch base := path.Base(manifest); {
+		case base == "Cargo.toml":
+			name, deps := parseCargoToml(content)
+			r.rustCrates = append(r.rustCrates, rustCrate{Dir: dir, Name: name, Deps: deps})
+		case base == "Gemfile":
+			entry := gemfile{Dir: dir, Gems: make(map[string]string)}
+			for _, match := range gemRe.FindAllStringSubmatch(string(content), -1) {
+				entry.Gems[match[1]] = strings.TrimLeft(match[2], "~>=< ")
+			}
+			r.gemfiles = append(r.gemfiles, entry)
+		case base == "composer.json":
+			var composer struct {
+				Require    map[string]string `json:"require"`
+				RequireDev map[string]string `json:"require-dev"`
+				Autoload   struct {
+					PSR4 map[string]json.RawMessage `json:"psr-4"`
+					PSR0 map[string]json.RawMessage `json:"psr-0"`
+				} `json:"autoload"`
+				AutoloadDev struct {
+					PSR4 map[string]json.RawMessage `json:"psr-4"`
+				} `json:"autoload-dev"`
+			}
+			if err := json.Unmarshal(content, &composer); err != nil {
+				continue
+			}
+			entry := composerPackage{Dir: dir, Autoload: make(map[string][]string), Requires: make(map[string]string)}
+			for _, requires := range []map[string]string{composer.RequireDev, composer.Require} {
+				for name, version := range requires {
+					if strings.Contains(name, "/") {
+						entry.Requires[name] = version
 					}
-					modulePaths[moduleName] = append(modulePaths[moduleName], node.Path)
 				}
 			}
+			for _, autoload := range []map[string]json.RawMessage{composer.Autoload.PSR0, composer.Autoload.PSR4, composer.AutoloadDev.PSR4} {
+				for prefix, raw := range autoload {
+					prefix = strings.Trim(prefix, "\\")
+					for _, target := range stringOrList(raw) {
+						entry.Autoload[prefix] = append(entry.Autoload[prefix], path.Join(dir, target))
+					}
+				}
+			}
+			r.composers = append(r.composers, entry)
+		default:
+			project := csProject{Dir: dir, Namespace: strings.TrimSuffix(base, ".csproj"), Packages: make(map[string]string)}
+			if match := csRootNsRe.FindSubmatch(content); match != nil {
+				project.Namespace = string(match[1])
+			}
+			for _, ref := range csPackageRefRe.FindAllSubmatch(content, -1) {
+				if include := xmlIncludeRe.FindSubmatch(ref[1]); include != nil {
+					version := ""
+					if match := xmlVersionRe.FindSubmatch(ref[1]); match != nil {
+						version = string(match[1])
+					}
+					project.Packages[string(include[1])] = version
+				}
+			}
+			r.csProjects = append(r.csProjects, project)
 		}
 	}
+	sort.SliceStable(r.rustCrates, func(i, j int) bool { return len(r.rustCrates[i].Dir) > len(r.rustCrates[j].Dir) })
+	sort.SliceStable(r.gemfiles, func(i, j int) bool { return len(r.gemfiles[i].Dir) > len(r.gemfiles[j].Dir) })
+	sort.SliceStable(r.composers, func(i, j int) bool { return len(r.composers[i].Dir) > len(r.composers[j].Dir) })
+	sort.SliceStable(r.csProjects, func(i, j int) bool { return len(r.csProjects[i].Namespace) > len(r.csProjects[j].Namespace) })
 
-	// Calculate max values for normalization
-	maxFanIn := 1
-	maxFanOut := 1
-	maxFiles := 1
-	for _, m := range topology.Modules {
-		if fanIn[m.Name] > maxFanIn {
-			maxFanIn = fanIn[m.Name]
+	r.rbRoots = []string{""}
+	for dir := range r.dirs {
+		if path.Base(dir) == "lib" {
+			r.rbRoots = append(r.rbRoots, dir)
 		}
-		if fanOut[m.Name] > maxFanOut {
-			maxFanOut = fanOut[m.Name]
-		}
-		if m.FileCount > maxFiles {
-			maxFiles = m.FileCount
+	}
+	sort.Strings(r.rbRoots)
+}
+
+// encloses reports whether file lies under dir ("" is the repo root)
+func encloses(dir, file string) bool {
+	return dir == "" || strings.HasPrefix(file, dir+"/")
+}
+
+// sharesRoot reports whether two dotted or backslashed names start with the
+// same first two segments (or are both single-segment and equal), which
+// marks code of the same organisation or product
+func sharesRoot(a, b, sep string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	pa, pb := strings.Split(a, sep), strings.Split(b, sep)
+	n := 2
+	if len(pa) < n || len(pb) < n {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		if pa[i] != pb[i] {
+			return false
 		}
 	}
+	return true
+}
 
-	// Detect cyclic dependencies (simplified: check if A->B and B->A exist)
-	cyclic := make(map[string]bool)
-	for _, edge := range topology.Edges {
-		for _, dep := range dependencies[edge.Target] {
-			if dep == edge.Source {
-				cyclic[edge.Source] = true
-				cyclic[edge.Target] = true
+// resolveJVM finds the Java/Kotlin file that declares an imported class: one
+// named after the class in a directory ending with its package path. Nested
+// classes and static members are tried as shorter paths, and wildcard
+// imports map to the package directory. Unfound imports sharing the
+// importing file's package root are still internal.
+func (r *importResolver) resolveJVM(imp *SourceImport) {
+	spec := strings.TrimSuffix(imp.Spec, ".*")
+	parts := strings.Split(spec, ".")
+	switch parts[0] {
+	case "java", "javax", "jdk", "kotlin", "sun":
+		imp.Kind = "stdlib"
+		return
+	}
+
+	imp.Kind = "internal"
+	for n := len(parts); n >= 1; n-- {
+		pkgPath := strings.Join(parts[:n-1], "/")
+		for _, candidate := range r.jvmClasses[parts[n-1]] {
+			if dir := manifestDir(candidate); dir == pkgPath || strings.HasSuffix(dir, "/"+pkgPath) {
+				imp.Target = candidate
+				return
+			}
+		}
+	}
+	if strings.HasSuffix(imp.Spec, ".*") {
+		pkgPath := strings.Join(parts, "/")
+		for dir := range r.dirs {
+			if dir == pkgPath || strings.HasSuffix(dir, "/"+pkgPath) {
+				imp.Target = dir + "/"
+				return
 			}
 		}
 	}
+	if sharesRoot(spec, imp.Namespace, ".") {
+		return
+	}
 
-	// Compute blast radius via BFS (transitive dependents)
-	computeBlastRadius := func(moduleName string) int {
-		visited := make(map[string]bool)
-		queue := []string{moduleName}
-		visited[moduleName] = true
-		count := 0
+	// Name an external library by its package root, up to three segments
+	imp.Kind = "external"
+	var pkg []string
+	for _, part := range parts {
+		if len(pkg) == 3 || part == "" || unicode.IsUpper(rune(part[0])) {
+			break
+		}
+		pkg = append(pkg, part)
+	}
+	if len(pkg) == 0 {
+		pkg = parts[:1]
+	}
+	imp.Package = strings.Join(pkg, ".")
+}
 
-		for len(queue) > 0 {
-			current := queue[0]
-			queue = queue[1:]
-			for _, dep := range dependents[current] {
-				if !visited[dep] {
-					visited[dep] = true
-					queue = append(queue, dep)
-					count++
-				}
-			}
+// rustModuleDir is the directory holding the child modules of file
+func rustModuleDir(file string) string {
+	switch path.Base(file) {
+	case "mod.rs", "lib.rs", "main.rs":
+		return manifestDir(file)
+	}
+	return strings.TrimSuffix(file, ".rs")
+}
+
+// probeRust maps a module path under dir to the file that defines it, or the
+// longest prefix that is a module (for imported items)
+func (r *importResolver) probeRust(dir string, parts []string) string {
+	for n := len(parts); n > 0; n-- {
+		if target := r.probe(path.Join(dir, strings.Join(parts[:n], "/")), false, ".rs", "/mod.rs"); target != "" {
+			return target
 		}
-		return count
 	}
+	return ""
+}
 
-	// Build impact units
-	impactUnits := make([]ImpactUnit, 0, len(topology.Modules))
-	totalModules := len(topology.Modules)
+// crateRoot returns the lib.rs or main.rs of a crate
+func (r *importResolver) crateRoot(crate rustCrate) string {
+	return r.probe(path.Join(crate.Dir, "src"), false, "/lib.rs", "/main.rs")
+}
 
-	var mostFragile string
-	var largestBlast string
-	maxFragility := 0.0
-	maxBlastRadius := 0
+// resolveRust resolves crate::, self:: and super:: paths to module files of
+// the importing crate, and other paths to a module in scope, a crate of the
+// same workspace, the standard library or an external crate versioned by
+// the nearest Cargo.toml
+func (r *importResolver) resolveRust(imp *SourceImport) {
+	parts := strings.Split(strings.TrimSuffix(imp.Spec, "::*"), "::")
+	var crate *rustCrate
+	for i := range r.rustCrates {
+		if r.rustCrates[i].Name != "" && encloses(r.rustCrates[i].Dir, imp.File) {
+			crate = &r.rustCrates[i]
+			break
+		}
+	}
 
-	criticalCount := 0
-	highCount := 0
-	mediumCount := 0
-	lowCount := 0
+	switch parts[0] {
+	case "std", "core", "alloc", "proc_macro", "test":
+		imp.Kind = "stdlib"
+		return
+	case "crate":
+		imp.Kind = "internal"
+		if crate != nil {
+			if imp.Target = r.probeRust(path.Join(crate.Dir, "src"), parts[1:]); imp.Target == "" {
+				imp.Target = r.crateRoot(*crate)
+			}
+		}
+		return
+	case "self", "super":
+		dir := rustModuleDir(imp.File)
+		i := 0
+		if parts[0] == "self" {
+			i = 1
+		}
+		for ; i < len(parts) && parts[i] == "super"; i++ {
+			dir = manifestDir(dir)
+		}
+		imp.Kind = "internal"
+		imp.Target = r.probeRust(dir, parts[i:])
+		return
+	}
+
+	// Paths may start at a module in scope
+	if target := r.probeRust(rustModuleDir(imp.File), parts); target != "" {
+		imp.Kind = "internal"
+		imp.Target = target
+		return
+	}
+	for _, other := range r.rustCrates {
+		if other.Name == parts[0] {
+			imp.Kind = "internal"
+			if imp.Target = r.probeRust(path.Join(other.Dir, "src"), parts[1:]); imp.Target == "" {
+				imp.Target = r.crateRoot(other)
+			}
+			return
+		}
+	}
 
-	for _, module := range topology.Modules {
-		fIn := fanIn[module.Name]
-		fOut := fanOut[module.Name]
-		isCyclic := cyclic[module.Name]
-		blastRadius := computeBlastRadius(module.Name)
-		filePaths := modulePaths[module.Name]
-		if filePaths == nil {
-			filePaths = make([]string, 0)
+	imp.Kind = "external"
+	imp.Package = parts[0]
+	for _, manifest := range r.rustCrates {
+		if !encloses(manifest.Dir, imp.File) {
+			continue
+		}
+		for name, version := range manifest.Deps {
+			if strings.ReplaceAll(name, "-", "_") == parts[0] {
+				imp.Package = name
+				imp.Version = version
+				return
+			}
 		}
+	}
+}
 
-		// Fragility formula:
-		// (fanIn/maxFanIn * 0.25) + (fanOut/maxFanOut * 0.25) + (cyclic * 0.2) + (fileCount/maxFiles * 0.3)
-		fanInNorm := float64(fIn) / float64(maxFanIn)
-		fanOutNorm := float64(fOut) / float64(maxFanOut)
-		fileNorm := float64(module.FileCount) / float64(maxFiles)
-		cyclicPenalty := 0.0
-		if isCyclic {
-			cyclicPenalty = 0.2
+// resolveCSharp maps a namespace to the project whose root namespace it
+// falls under, and to the folder matching the rest of it. System namespaces
+// are the base class library; others sharing the importing file's namespace
+// root are internal; the rest belong to the longest matching
+// PackageReference.
+func (r *importResolver) resolveCSharp(imp *SourceImport) {
+	spec := imp.Spec
+	if spec == "System" || strings.HasPrefix(spec, "System.") {
+		imp.Kind = "stdlib"
+		return
+	}
+	for _, project := range r.csProjects {
+		if spec == project.Namespace || strings.HasPrefix(spec, project.Namespace+".") {
+			imp.Kind = "internal"
+			rest := strings.ReplaceAll(strings.TrimPrefix(spec[len(project.Namespace):], "."), ".", "/")
+			if imp.Target = r.probe(path.Join(project.Dir, rest), true, ".cs"); imp.Target == "" && project.Dir != "" {
+				imp.Target = project.Dir + "/"
+			}
+			return
 		}
+	}
+	if sharesRoot(spec, imp.Namespace, ".") {
+		imp.Kind = "internal"
+		return
+	}
 
-		fragility := (fanInNorm*0.25 + fanOutNorm*0.25 + cyclicPenalty + fileNorm*0.3) * 100
-		if fragility > 100 {
-			fragility = 100
+	imp.Kind = "external"
+	imp.Package = spec
+	if parts := strings.SplitN(spec, ".", 3); len(parts) >= 2 {
+		imp.Package = parts[0] + "." + parts[1]
+	}
+	best := ""
+	for _, project := range r.csProjects {
+		for name, version := range project.Packages {
+			if (spec == name || strings.HasPrefix(spec, name+".")) && len(name) > len(best) {
+				best = name
+				imp.Package = name
+				imp.Version = version
+			}
 		}
+	}
+}
 
-		// Exposure scope classification
-		var exposureScope string
-		dependentRatio := float64(fIn) / float64(totalModules)
-		if dependentRatio > 0.5 {
-			exposureScope = "system-wide"
-		} else if fIn > fOut && fIn > 2 {
-			exposureScope = "transactional"
-		} else if fOut > fIn {
-			exposureScope = "downstream"
-		} else {
-			exposureScope = "external"
+// resolveRuby resolves require_relative against the requiring file and
+// require against the repo root and lib/ directories; other requires are the
+// standard library or a gem, versioned by the nearest Gemfile
+func (r *importResolver) resolveRuby(imp *SourceImport) {
+	spec := imp.Spec
+	if strings.HasPrefix(spec, ".") {
+		imp.Kind = "internal"
+		imp.Target = r.probe(path.Join(path.Dir(imp.File), spec), false, "", ".rb")
+		return
+	}
+	for _, root := range r.rbRoots {
+		if target := r.probe(path.Join(root, spec), false, ".rb", ""); target != "" {
+			imp.Kind = "internal"
+			imp.Target = target
+			return
 		}
+	}
 
-		// Trend based on computed fragility (not historical - would need trajectory data)
-		trend := "stabilizing"
-		if fragility > 70 {
-			trend = "accelerating"
-		} else if fragility < 30 {
-			trend = "improving"
+	name := strings.SplitN(spec, "/", 2)[0]
+	if rubyStdlib[name] {
+		imp.Kind = "stdlib"
+		return
+	}
+	imp.Kind = "external"
+	imp.Package = strings.ReplaceAll(name, "_", "-")
+	if gem, ok := rubyGems[name]; ok {
+		imp.Package = gem
+	}
+	for _, manifest := range r.gemfiles {
+		if !encloses(manifest.Dir, imp.File) {
+			continue
+		}
+		for _, candidate := range []string{imp.Package, name} {
+			if version, ok := manifest.Gems[candidate]; ok {
+				imp.Package = candidate
+				imp.Version = version
+				return
+			}
 		}
+	}
+}
 
-		unit := ImpactUnit{
-			Name:           module.Name,
-			FilePaths:      filePaths,
-			FileCount:      module.FileCount,
-			FragilityScore: fragility,
-			ExposureScope:  exposureScope,
-			BlastRadius:    blastRadius,
-			Trend:          trend,
-			FanIn:          fIn,
-			FanOut:         fOut,
-			IsCyclic:       isCyclic,
+// resolvePHP resolves require/include paths against the including file, then
+// the repo root, and use declarations through composer.json autoload
+// prefixes. Global names are built in; other namespaces sharing the file's
+// namespace root are internal, and the rest are matched to a required
+// composer package by vendor and package name.
+func (r *importResolver) resolvePHP(imp *SourceImport) {
+	spec := imp.Spec
+	if strings.HasPrefix(spec, ".") {
+		imp.Kind = "internal"
+		if imp.Target = r.probe(path.Join(path.Dir(imp.File), spec), false, ""); imp.Target == "" {
+			imp.Target = r.probe(path.Clean(spec), false, "")
 		}
+		return
+	}
 
-		impactUnits = append(impactUnits, unit)
+	parts := strings.Split(spec, "\\")
+	if len(parts) == 1 {
+		imp.Kind = "stdlib"
+		return
+	}
+	bestPrefix := ""
+	var bestDirs []string
+	for _, composer := range r.composers {
+		for prefix, dirs := range composer.Autoload {
+			if (spec == prefix || strings.HasPrefix(spec, prefix+"\\")) && len(prefix) >= len(bestPrefix) {
+				bestPrefix, bestDirs = prefix, dirs
+			}
+		}
+	}
+	if bestDirs != nil {
+		imp.Kind = "internal"
+		rest := strings.ReplaceAll(strings.TrimPrefix(spec[len(bestPrefix):], "\\"), "\\", "/")
+		for _, dir := range bestDirs {
+			if imp.Target = r.probe(path.Join(dir, rest), true, ".php"); imp.Target != "" {
+				return
+			}
+		}
+		return
+	}
+	if sharesRoot(spec, imp.Namespace, "\\") {
+		imp.Kind = "internal"
+		return
+	}
 
-		// Track max fragility
-		if fragility > maxFragility {
-			maxFragility = fragility
-			mostFragile = module.Name
+	imp.Kind = "external"
+	imp.Package = strings.ToLower(parts[0] + "/" + parts[1])
+	vendor := strings.ToLower(parts[0]) + "/"
+	var vendorPackages []string
+	for _, composer := range r.composers {
+		for name := range composer.Requires {
+			if strings.HasPrefix(strings.ToLower(name), vendor) {
+				vendorPackages = append(vendorPackages, name)
+			}
+		}
+	}
+	sort.Strings(vendorPackages)
+	for _, name := range vendorPackages {
+		pkg := strings.ReplaceAll(strings.ToLower(name[len(vendor):]), "-", "")
+		for _, part := range parts[1:] {
+			if strings.ToLower(part) == pkg || len(vendorPackages) == 1 {
+				imp.Package = name
+				imp.Version = r.composerVersion(imp.File, name)
+				return
+			}
 		}
+	}
+}
 
-		// Track max blast radius
-		if blastRadius > maxBlastRadius {
-			maxBlastRadius = blastRadius
-			largestBlast = module.Name
+// composerVersion is the constraint the nearest composer.json puts on name
+func (r *importResolver) composerVersion(file, name string) string {
+	for _, composer := range r.composers {
+		if version, ok := composer.Requires[name]; ok && encloses(composer.Dir, file) {
+			return version
 		}
+	}
+	return ""
+}
 
-		// Count by severity
-		if fragility >= 75 {
-			criticalCount++
-		} else if fragility >= 50 {
-			highCount++
-		} else if fragility >= 25 {
-			mediumCount++
-		} else {
-			lowCount++
+// topologyModuleOf names the topology module a repo path belongs to: its
+// submodule, its top-level directory, or "(root)"
+func topologyModuleOf(filePath string, submodules []Submodule) string {
+	if sub := submoduleOf(filePath, submodules); sub != "" {
+		return sub
+	}
+	if idx := strings.Index(filePath, "/"); idx != -1 {
+		return filePath[:idx]
+	}
+	return "(root)"
+}
+
+// buildImportGraph reads up to maxImportGraphFiles source files, spread over
+// the top-level modules so each is represented, and resolves their imports
+// against tree. Files inside submodules belong to other repositories and are
+// not read, but imports into them resolve.
+func buildImportGraph(ctx context.Context, client RepoDataSource, owner, repo string, tree *GitHubTreeResponse, submodules []Submodule) *ImportGraph {
+	graph := &ImportGraph{}
+	byModule := make(map[string][]GitHubTreeNode)
+	for _, node := range treeNodes(tree) {
+		if node.Type != "blob" || !isImportSource(node.Path) || submoduleOf(node.Path, submodules) != "" {
+			continue
 		}
+		graph.SourceFiles++
+		module := topologyModuleOf(node.Path, nil)
+		byModule[module] = append(byModule[module], node)
+	}
+	if graph.SourceFiles == 0 {
+		return graph
 	}
 
-	// Sort by fragility descending
-	sort.Slice(impactUnits, func(i, j int) bool {
-		return impactUnits[i].FragilityScore > impactUnits[j].FragilityScore
-	})
+	// Largest files first within a module, one module at a time in turn
+	moduleNames := make([]string, 0, len(byModule))
+	for module, files := range byModule {
+		moduleNames = append(moduleNames, module)
+		sort.Slice(files, func(i, j int) bool { return files[i].Size > files[j].Size })
+	}
+	sort.Strings(moduleNames)
+	var selected []GitHubTreeNode
+	for round := 0; len(selected) < maxImportGraphFiles && len(selected) < graph.SourceFiles; round++ {
+		for _, module := range moduleNames {
+			if round < len(byModule[module]) && len(selected) < maxImportGraphFiles {
+				selected = append(selected, byModule[module][round])
+			}
+		}
+	}
 
-	log.Printf("[Impact] Complete: %d units, critical=%d, high=%d", len(impactUnits), criticalCount, highCount)
+	type fileResult struct {
+		path    string
+		content []byte
+	}
+	results := make(chan fileResult, len(selected))
+	sem := make(chan struct{}, 5) // 5 concurrent fetches
+	for _, file := range selected {
+		go func(f GitHubTreeNode) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			content, err := client.GetFileContent(ctx, owner, repo, f.Path)
+			if err != nil {
+				content = nil
+			}
+			results <- fileResult{path: f.Path, content: content}
+		}(file)
+	}
 
-	return &ImpactAnalysis{
-		Available:     true,
-		ImpactUnits:   impactUnits,
-		TotalModules:  totalModules,
-		CriticalCount: criticalCount,
-		HighCount:     highCount,
-		MediumCount:   mediumCount,
-		LowCount:      lowCount,
-		MostFragile:   mostFragile,
-		LargestBlast:  largestBlast,
+	resolver := newImportResolver(ctx, client, owner, repo, tree)
+	for range selected {
+		result := <-results
+		if result.content == nil {
+			continue
+		}
+		graph.ParsedFiles++
+		seen := make(map[string]bool)
+		for _, imp := range extractImports(result.path, result.content) {
+			resolver.resolve(&imp)
+			// Names imported from the same module count once
+			key := imp.Target + "\x00" + imp.Package
+			if imp.Target == "" && imp.Package == "" {
+				key = imp.Spec
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			graph.Imports = append(graph.Imports, imp)
+		}
 	}
+
+	log.Printf("[Imports] %s/%s: %d imports from %d of %d source files", owner, repo, len(graph.Imports), graph.ParsedFiles, graph.SourceFiles)
+	return graph
 }
 
 // ==================== REAL DEPENDENCY GRAPH ANALYSIS ====================
 
 // analyzeDependencies extracts REAL import statements and enriches them with risk profiles
-func analyzeDependencies(client *GitHubClient, owner, repo string, tree *GitHubTreeResponse, concentration *ConcentrationAnalysis) *DependencyAnalysis {
+func analyzeDependencies(ctx context.Context, client RepoDataSource, owner, repo string, tree *GitHubTreeResponse, concentration *ConcentrationAnalysis) *DependencyAnalysis {
 	log.Printf("[Deps] Starting enriched dependency risk profile analysis")
 
 	if tree == nil || len(tree.Tree) == 0 {
@@ -2283,7 +8237,7 @@ func analyzeDependencies(client *GitHubClient, owner, repo string, tree *GitHubT
 	}
 
 	// 1. Parse Manifests for versions
-	manifestVersions := parseManifests(client, owner, repo, tree)
+	manifestVersions := parseManifests(ctx, client, owner, repo, tree)
 
 	// 2. Identify Manifest Touches for Volatility (from concentration if available)
 	volatilityMap := make(map[string]float64)
@@ -2293,18 +8247,9 @@ func analyzeDependencies(client *GitHubClient, owner, repo string, tree *GitHubT
 		}
 	}
 
-	// Regex patterns
-	pyImportRe := regexp.MustCompile(`(?m)^(?:from\s+([a-zA-Z0-9_.]+)\s+import|import\s+([a-zA-Z0-9_.]+))`)
-	jsImportRe := regexp.MustCompile(`(?m)(?:import\s+.*?\s+from\s+['"]([^'"]+)['"]|require\s*\(\s*['"]([^'"]+)['"]\s*\))`)
-	goImportRe := regexp.MustCompile(`(?m)import\s+(?:\(\s*)?["']?([^"'\s\)]+)["']?`)
-
 	sourceFiles := make([]GitHubTreeNode, 0)
 	for _, node := range tree.Tree {
-		if node.Type != "blob" {
-			continue
-		}
-		ext := strings.ToLower(filepath.Ext(node.Path))
-		if ext == ".py" || ext == ".js" || ext == ".ts" || ext == ".jsx" || ext == ".tsx" || ext == ".go" {
+		if node.Type == "blob" && isImportSource(node.Path) {
 			sourceFiles = append(sourceFiles, node)
 		}
 	}
@@ -2334,6 +8279,8 @@ func analyzeDependencies(client *GitHubClient, owner, repo string, tree *GitHubT
 		}
 	}
 
+	resolver := newImportResolver(ctx, client, owner, repo, tree)
+
 	// Parallel file content fetching with semaphore
 	type fileResult struct {
 		path    string
@@ -2348,7 +8295,7 @@ func analyzeDependencies(client *GitHubClient, owner, repo string, tree *GitHubT
 		go func(f GitHubTreeNode) {
 			sem <- struct{}{}        // acquire
 			defer func() { <-sem }() // release
-			content, err := client.GetFileContent(owner, repo, f.Path)
+			content, err := client.GetFileContent(ctx, owner, repo, f.Path)
 			if err != nil {
 				resultsChan <- fileResult{path: f.Path, content: nil, ext: strings.ToLower(filepath.Ext(f.Path))}
 				return
@@ -2364,42 +8311,36 @@ func analyzeDependencies(client *GitHubClient, owner, repo string, tree *GitHubT
 			continue
 		}
 
-		contentStr := string(r.content)
-
-		var matches [][]string
-		switch r.ext {
-		case ".py":
-			matches = pyImportRe.FindAllStringSubmatch(contentStr, -1)
-		case ".js", ".jsx", ".ts", ".tsx":
-			matches = jsImportRe.FindAllStringSubmatch(contentStr, -1)
-		case ".go":
-			matches = goImportRe.FindAllStringSubmatch(contentStr, -1)
-		}
-
-		for _, match := range matches {
-			imp := ""
-			for i := 1; i < len(match); i++ {
-				if match[i] != "" {
-					imp = match[i]
-					break
-				}
-			}
-			if imp == "" {
+		seen := make(map[string]bool)
+		for _, found := range extractImports(r.path, r.content) {
+			resolver.resolve(&found)
+			// The standard library carries no version or ownership risk
+			if found.Kind == "stdlib" {
 				continue
 			}
-			imp = strings.Trim(imp, `"' `)
+			imp := found.Spec
 
 			// Simple check for internal vs external
 			category := "external"
 			// Check if it looks like a local path (starts with . or matches a file in tree)
-			if strings.HasPrefix(imp, ".") || fileSet[imp] || fileSet[imp+r.ext] {
+			if found.Kind == "internal" || fileSet[imp] || fileSet[imp+r.ext] {
 				category = "internal"
 			}
 
-			// Skip systemic noise
-			if category == "external" && (strings.HasPrefix(imp, "react") || strings.HasPrefix(imp, "os") || strings.HasPrefix(imp, "sys")) {
+			// Resolved imports are keyed by the repo path they point at, external
+			// ones by the package or module that provides them so its declared
+			// version applies
+			if found.Target != "" {
+				imp = strings.TrimSuffix(found.Target, "/")
+			} else if category == "external" && found.Package != "" {
+				imp = found.Package
+			}
+
+			// One edge per dependency of a file, however many names it imports
+			if seen[imp] {
 				continue
 			}
+			seen[imp] = true
 
 			if _, exists := nodes[r.path]; !exists {
 				nodes[r.path] = &DependencyNode{
@@ -2416,17 +8357,27 @@ func analyzeDependencies(client *GitHubClient, owner, repo string, tree *GitHubT
 					Name:     filepath.Base(imp),
 					Language: "unknown",
 					Category: category,
-					Version:  manifestVersions[imp],
+					Version:  found.Version,
+				}
+				if nodes[imp].Version == "" {
+					nodes[imp].Version = manifestVersions[imp]
 				}
 				if category == "external" {
-					nodes[imp].Language = "package"
+					// Registries are queried by full package name
+					nodes[imp].Name = imp
+					nodes[imp].Language = strings.TrimPrefix(r.ext, ".")
+					if isJSSource(r.path) {
+						nodes[imp].Language = "package"
+					}
+				} else if found.Target != "" && !strings.HasSuffix(found.Target, "/") {
+					nodes[imp].Language = strings.TrimPrefix(path.Ext(imp), ".")
 				}
 			}
 
 			edges = append(edges, DependencyEdge{
 				Source:     r.path,
 				Target:     imp,
-				ImportLine: strings.TrimSpace(match[0]),
+				ImportLine: found.Line,
 			})
 			fanOut[r.path]++
 			fanIn[imp]++
@@ -2452,22 +8403,15 @@ func analyzeDependencies(client *GitHubClient, owner, repo string, tree *GitHubT
 		// Volatility: from manifest or file churn
 		node.Volatility = volatilityMap[id]
 
-		// Version Health: Fetch latest from registry and compare
-		if node.Category == "external" && node.Version != "" {
-			// Determine the language for registry lookup
-			regLang := "npm" // default for package type
-			if node.Language == "py" || node.Language == "python" {
-				regLang = "python"
-			} else if node.Language == "go" {
-				regLang = "go"
-			}
-
-			// Fetch latest version from registry (limited to external packages)
-			latest := fetchLatestVersion(node.Name, regLang)
+		// Version Health: Fetch latest from registry and compare. Internal
+		// modules, and packages of languages without a queried registry
+		// (Java, Kotlin), have no version lag.
+		if node.Category == "external" && node.Version != "" && packageRegistry(node.Language) != "" {
+			latest := fetchLatestVersion(ctx, node.Name, node.Language)
 			node.LatestVersion = latest
 			node.Lag = compareVersions(node.Version, latest)
 		} else {
-			node.Lag = "n/a" // Internal modules don't have version lag
+			node.Lag = "n/a"
 		}
 
 		// Risk Amplification = Centrality(40%) + Volatility(40%) + Lag(20%)
@@ -2499,12 +8443,12 @@ func analyzeDependencies(client *GitHubClient, owner, repo string, tree *GitHubT
 	}
 }
 
-func parseManifests(client *GitHubClient, owner, repo string, tree *GitHubTreeResponse) map[string]string {
+func parseManifests(ctx context.Context, client RepoDataSource, owner, repo string, tree *GitHubTreeResponse) map[string]string {
 	versions := make(map[string]string)
 	for _, node := range tree.Tree {
 		name := strings.ToLower(filepath.Base(node.Path))
 		if name == "requirements.txt" {
-			content, _ := client.GetFileContent(owner, repo, node.Path)
+			content, _ := client.GetFileContent(ctx, owner, repo, node.Path)
 			lines := strings.Split(string(content), "\n")
 			for _, line := range lines {
 				line = strings.TrimSpace(line)
@@ -2521,7 +8465,7 @@ func parseManifests(client *GitHubClient, owner, repo string, tree *GitHubTreeRe
 				}
 			}
 		} else if name == "package.json" {
-			content, _ := client.GetFileContent(owner, repo, node.Path)
+			content, _ := client.GetFileContent(ctx, owner, repo, node.Path)
 			var pkg struct {
 				Deps    map[string]string `json:"dependencies"`
 				DevDeps map[string]string `json:"devDependencies"`
@@ -2535,7 +8479,7 @@ func parseManifests(client *GitHubClient, owner, repo string, tree *GitHubTreeRe
 				}
 			}
 		} else if name == "go.mod" {
-			content, _ := client.GetFileContent(owner, repo, node.Path)
+			content, _ := client.GetFileContent(ctx, owner, repo, node.Path)
 			lines := strings.Split(string(content), "\n")
 			inRequire := false
 			for _, line := range lines {
@@ -2578,14 +8522,14 @@ func parseManifests(client *GitHubClient, owner, repo string, tree *GitHubTreeRe
 }
 
 // parseManifestsFull returns structured manifest dependencies with version health
-func parseManifestsFull(client *GitHubClient, owner, repo string, tree *GitHubTreeResponse) []ManifestDependency {
+func parseManifestsFull(ctx context.Context, client RepoDataSource, owner, repo string, tree *GitHubTreeResponse) []ManifestDependency {
 	var deps []ManifestDependency
 
-	for _, node := range tree.Tree {
+	for _, node := range treeNodes(tree) {
 		name := strings.ToLower(filepath.Base(node.Path))
 
 		if name == "package.json" {
-			content, err := client.GetFileContent(owner, repo, node.Path)
+			content, err := client.GetFileContent(ctx, owner, repo, node.Path)
 			if err != nil || content == nil {
 				continue
 			}
@@ -2595,7 +8539,7 @@ func parseManifestsFull(client *GitHubClient, owner, repo string, tree *GitHubTr
 			}
 			if err := json.Unmarshal(content, &pkg); err == nil {
 				for k, v := range pkg.Deps {
-					latest := fetchLatestVersion(k, "npm")
+					latest := fetchLatestVersion(ctx, k, "npm")
 					deps = append(deps, ManifestDependency{
 						Name:          k,
 						DeclaredVer:   v,
@@ -2607,7 +8551,7 @@ func parseManifestsFull(client *GitHubClient, owner, repo string, tree *GitHubTr
 					})
 				}
 				for k, v := range pkg.DevDeps {
-					latest := fetchLatestVersion(k, "npm")
+					latest := fetchLatestVersion(ctx, k, "npm")
 					deps = append(deps, ManifestDependency{
 						Name:          k,
 						DeclaredVer:   v,
@@ -2620,7 +8564,7 @@ func parseManifestsFull(client *GitHubClient, owner, repo string, tree *GitHubTr
 				}
 			}
 		} else if name == "go.mod" {
-			content, err := client.GetFileContent(owner, repo, node.Path)
+			content, err := client.GetFileContent(ctx, owner, repo, node.Path)
 			if err != nil || content == nil {
 				continue
 			}
@@ -2641,7 +8585,7 @@ func parseManifestsFull(client *GitHubClient, owner, repo string, tree *GitHubTr
 					if len(parts) >= 2 {
 						mod := parts[0]
 						ver := parts[1]
-						latest := fetchLatestVersion(mod, "go")
+						latest := fetchLatestVersion(ctx, mod, "go")
 						deps = append(deps, ManifestDependency{
 							Name:          mod,
 							DeclaredVer:   ver,
@@ -2655,7 +8599,7 @@ func parseManifestsFull(client *GitHubClient, owner, repo string, tree *GitHubTr
 				}
 			}
 		} else if name == "requirements.txt" {
-			content, err := client.GetFileContent(owner, repo, node.Path)
+			content, err := client.GetFileContent(ctx, owner, repo, node.Path)
 			if err != nil || content == nil {
 				continue
 			}
@@ -2673,7 +8617,7 @@ func parseManifestsFull(client *GitHubClient, owner, repo string, tree *GitHubTr
 					if len(matches) >= 4 {
 						ver = strings.TrimSpace(matches[3])
 					}
-					latest := fetchLatestVersion(pkgName, "python")
+					latest := fetchLatestVersion(ctx, pkgName, "python")
 					deps = append(deps, ManifestDependency{
 						Name:          pkgName,
 						DeclaredVer:   ver,
@@ -2691,39 +8635,90 @@ func parseManifestsFull(client *GitHubClient, owner, repo string, tree *GitHubTr
 	return deps
 }
 
+// registryLookups is off during fixture replay, which must not reach the network
+var registryLookups = true
+
+// registryClient makes the registry requests; tests replace its transport to
+// answer them from recorded fixtures
+var registryClient = &http.Client{Timeout: 3 * time.Second}
+
+// packageRegistry names the registry that versions a dependency of language,
+// or "" when none is queried
+func packageRegistry(language string) string {
+	switch language {
+	case "npm", "package", "javascript", "typescript", "js", "ts", "jsx", "tsx":
+		return "npm"
+	case "python", "py":
+		return "pypi"
+	case "go":
+		return "go"
+	case "rust", "rs":
+		return "crates"
+	case "ruby", "rb":
+		return "rubygems"
+	case "php":
+		return "packagist"
+	case "csharp", "cs":
+		return "nuget"
+	}
+	return ""
+}
+
 // fetchLatestVersion queries package registries for the latest available version
 // Returns the latest version string or empty if unavailable
-func fetchLatestVersion(pkgName, language string) string {
-	client := &http.Client{Timeout: 3 * time.Second}
+func fetchLatestVersion(ctx context.Context, pkgName, language string) string {
+	if !registryLookups {
+		return ""
+	}
 	var url string
 
-	switch language {
-	case "npm", "javascript", "typescript", "js", "ts", "jsx", "tsx":
+	registry := packageRegistry(language)
+	switch registry {
+	case "npm":
 		// npm registry
 		url = fmt.Sprintf("https://registry.npmjs.org/%s", pkgName)
-	case "python", "py":
+	case "pypi":
 		// PyPI registry
 		url = fmt.Sprintf("https://pypi.org/pypi/%s/json", pkgName)
 	case "go":
 		// Go proxy (returns plain text for @latest)
 		url = fmt.Sprintf("https://proxy.golang.org/%s/@latest", pkgName)
+	case "crates":
+		url = fmt.Sprintf("https://crates.io/api/v1/crates/%s", pkgName)
+	case "rubygems":
+		url = fmt.Sprintf("https://rubygems.org/api/v1/versions/%s/latest.json", pkgName)
+	case "packagist":
+		// Composer v2 metadata: tagged releases, newest first
+		url = fmt.Sprintf("https://repo.packagist.org/p2/%s.json", strings.ToLower(pkgName))
+	case "nuget":
+		// Flat container index: every version, oldest first
+		url = fmt.Sprintf("https://api.nuget.org/v3-flatcontainer/%s/index.json", strings.ToLower(pkgName))
 	default:
 		return ""
 	}
 
-	resp, err := client.Get(url)
-	if err != nil || resp.StatusCode != http.StatusOK {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return ""
+	}
+	// crates.io rejects requests without a User-Agent
+	req.Header.Set("User-Agent", "RepoAnalyst-App")
+	resp, err := registryClient.Do(req)
+	if err != nil {
 		return ""
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return ""
 	}
 
-	switch language {
-	case "npm", "javascript", "typescript", "js", "ts", "jsx", "tsx":
+	switch registry {
+	case "npm":
 		var npmResp struct {
 			DistTags struct {
 				Latest string `json:"latest"`
@@ -2732,7 +8727,7 @@ func fetchLatestVersion(pkgName, language string) string {
 		if err := json.Unmarshal(body, &npmResp); err == nil {
 			return npmResp.DistTags.Latest
 		}
-	case "python", "py":
+	case "pypi":
 		var pypiResp struct {
 			Info struct {
 				Version string `json:"version"`
@@ -2748,6 +8743,44 @@ func fetchLatestVersion(pkgName, language string) string {
 		if err := json.Unmarshal(body, &goResp); err == nil {
 			return goResp.Version
 		}
+	case "crates":
+		var cratesResp struct {
+			Crate struct {
+				MaxStableVersion string `json:"max_stable_version"`
+			} `json:"crate"`
+		}
+		if err := json.Unmarshal(body, &cratesResp); err == nil {
+			return cratesResp.Crate.MaxStableVersion
+		}
+	case "rubygems":
+		var gemResp struct {
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(body, &gemResp); err == nil && gemResp.Version != "unknown" {
+			return gemResp.Version
+		}
+	case "packagist":
+		var packagistResp struct {
+			Packages map[string][]struct {
+				Version string `json:"version"`
+			} `json:"packages"`
+		}
+		if err := json.Unmarshal(body, &packagistResp); err == nil {
+			if releases := packagistResp.Packages[strings.ToLower(pkgName)]; len(releases) > 0 {
+				return releases[0].Version
+			}
+		}
+	case "nuget":
+		var nugetResp struct {
+			Versions []string `json:"versions"`
+		}
+		if err := json.Unmarshal(body, &nugetResp); err == nil {
+			for i := len(nugetResp.Versions) - 1; i >= 0; i-- {
+				if !strings.Contains(nugetResp.Versions[i], "-") {
+					return nugetResp.Versions[i]
+				}
+			}
+		}
 	}
 
 	return ""
@@ -2759,10 +8792,12 @@ func compareVersions(declared, latest string) string {
 		return "unknown"
 	}
 
-	// Clean version strings
-	declared = strings.TrimPrefix(declared, "^")
-	declared = strings.TrimPrefix(declared, "~")
-	declared = strings.TrimPrefix(declared, "v")
+	// Clean version strings: keep the lower bound of constraints such as
+	// ^1.2, ~> 7.1 (Gemfile), >=2.0,<3 and [1.0,2.0) (NuGet)
+	declared = strings.TrimLeft(declared, "^~>=<![( v")
+	if i := strings.IndexAny(declared, ", "); i >= 0 {
+		declared = declared[:i]
+	}
 	latest = strings.TrimPrefix(latest, "v")
 
 	if declared == latest {
@@ -2802,124 +8837,144 @@ func compareVersions(declared, latest string) string {
 // ==================== CHANGE CONCENTRATION ANALYSIS ====================
 
 // analyzeConcentration extracts REAL commit diffs to identify high-churn hotspots
-func analyzeConcentration(client *GitHubClient, owner, repo string) *ConcentrationAnalysis {
-	log.Printf("[Concentration] Starting churn extraction for %s/%s", owner, repo)
+func analyzeConcentration(ctx context.Context, client RepoDataSource, owner, repo string, window AnalysisWindow) *ConcentrationAnalysis {
+	log.Printf("[Concentration] Starting churn extraction for %s/%s (%s)", owner, repo, window.Label())
 
-	// Fetch last 50 commits to avoid extreme rate limiting
-	commits, err := client.GetCommits(owner, repo, 50)
+	commits, err := client.ListCommits(ctx, owner, repo, window.Query())
 	if err != nil {
-		return &ConcentrationAnalysis{Available: false, Reason: fmt.Sprintf("Failed to fetch commits: %v", err)}
+		return &ConcentrationAnalysis{Available: false, Reason: fmt.Sprintf("Failed to fetch commits: %v", err), Window: window.Label()}
 	}
 
 	if len(commits) == 0 {
-		return &ConcentrationAnalysis{Available: false, Reason: "No commits found"}
+		return &ConcentrationAnalysis{Available: false, Reason: "No commits found", Window: window.Label()}
 	}
 
 	churnMap := make(map[string]int)
+	lineChurnMap := make(map[string]int)
 	totalCommitsAnalyzed := 0
 
-	// Fetch files for each commit - limit strictly to stay within aggressive rate limits
-	limit := len(commits)
-	if limit > 20 {
-		limit = 20
+	fileSets := fetchCommitFileStats(ctx, client, owner, repo, commits)
+	renames := buildRenameGraph(fileSets)
+	for i, files := range fileSets {
+		if files == nil {
+			continue
+		}
+		for _, file := range files {
+			path := renames.Canonical(i, file.Filename)
+			churnMap[path]++
+			lineChurnMap[path] += file.Additions + file.Deletions
+		}
+		totalCommitsAnalyzed++
 	}
 
-	// Parallel commit file fetching with semaphore
-	type commitFilesResult struct {
-		files []string
-		err   error
+	if len(churnMap) == 0 {
+		return &ConcentrationAnalysis{Available: false, Reason: "No file changes discovered in analyzed window", Window: window.Label()}
 	}
 
-	resultsChan := make(chan commitFilesResult, limit)
-	sem := make(chan struct{}, 5) // 5 concurrent fetches
-
-	for i := 0; i < limit; i++ {
-		go func(sha string) {
-			sem <- struct{}{}        // acquire
-			defer func() { <-sem }() // release
-			files, err := client.GetCommitFiles(owner, repo, sha)
-			resultsChan <- commitFilesResult{files: files, err: err}
-		}(commits[i].SHA)
+	// Convert to slice for sorting
+	type fileChurn struct {
+		path  string
+		count int
+		lines int
+	}
+	churnList := make([]fileChurn, 0, len(churnMap))
+	totalFileChanges := 0
+	totalLinesChanged := 0
+	for path, count := range churnMap {
+		churnList = append(churnList, fileChurn{path, count, lineChurnMap[path]})
+		totalFileChanges += count
+		totalLinesChanged += lineChurnMap[path]
 	}
 
-	// Collect results
-	for i := 0; i < limit; i++ {
-		r := <-resultsChan
-		if r.err != nil {
-			continue
+	defects := buildDefectIndex(ctx, client, owner, repo, window, commits, fileSets, renames)
+
+	toChurnFile := func(fc fileChurn) ChurnFile {
+		cf := ChurnFile{
+			Path:         fc.path,
+			CommitCount:  fc.count,
+			Percent:      (float64(fc.count) / float64(totalFileChanges)) * 100,
+			LinesChanged: fc.lines,
+			FileDefects:  defects.For(fc.path, fc.count),
 		}
-		for _, file := range r.files {
-			churnMap[file]++
+		if totalLinesChanged > 0 {
+			cf.LinePercent = (float64(fc.lines) / float64(totalLinesChanged)) * 100
 		}
-		totalCommitsAnalyzed++
+		return cf
 	}
 
-	if len(churnMap) == 0 {
-		return &ConcentrationAnalysis{Available: false, Reason: "No file changes discovered in analyzed window"}
+	// Identify hotspots (Top files)
+	topCount := 10
+	if topCount > len(churnList) {
+		topCount = len(churnList)
+	}
+
+	// Concentration Index = percentage of changes in the top 10% (or top 3 if codebase is small)
+	calcLimit := len(churnList) / 10
+	if calcLimit < 1 {
+		calcLimit = 1
+	}
+
+	// Line-weighted ranking first, so a rewrite outranks a string of typo fixes
+	sort.Slice(churnList, func(i, j int) bool {
+		if churnList[i].lines != churnList[j].lines {
+			return churnList[i].lines > churnList[j].lines
+		}
+		return churnList[i].path < churnList[j].path
+	})
+
+	lineHotspots := make([]ChurnFile, 0, topCount)
+	for i := 0; i < topCount; i++ {
+		lineHotspots = append(lineHotspots, toChurnFile(churnList[i]))
 	}
 
-	// Convert to slice for sorting
-	type fileChurn struct {
-		path  string
-		count int
-	}
-	churnList := make([]fileChurn, 0, len(churnMap))
-	totalFileChanges := 0
-	for path, count := range churnMap {
-		churnList = append(churnList, fileChurn{path, count})
-		totalFileChanges += count
+	lineConcentrationIndex := 0.0
+	if totalLinesChanged > 0 {
+		lineSum := 0
+		for i := 0; i < calcLimit && i < len(churnList); i++ {
+			lineSum += churnList[i].lines
+		}
+		lineConcentrationIndex = (float64(lineSum) / float64(totalLinesChanged)) * 100
 	}
 
 	// Sort by count descending
 	sort.Slice(churnList, func(i, j int) bool {
-		return churnList[i].count > churnList[j].count
+		if churnList[i].count != churnList[j].count {
+			return churnList[i].count > churnList[j].count
+		}
+		return churnList[i].path < churnList[j].path
 	})
 
-	// Identify hotspots (Top files)
-	topCount := 10
-	if topCount > len(churnList) {
-		topCount = len(churnList)
-	}
-
-	topCommitsSum := 0
 	hotspots := make([]ChurnFile, 0, topCount)
 	for i := 0; i < topCount; i++ {
-		percent := (float64(churnList[i].count) / float64(totalFileChanges)) * 100
-		hotspots = append(hotspots, ChurnFile{
-			Path:        churnList[i].path,
-			CommitCount: churnList[i].count,
-			Percent:     percent,
-		})
-		topCommitsSum += churnList[i].count
+		hotspots = append(hotspots, toChurnFile(churnList[i]))
 	}
 
-	// Concentration Index = percentage of changes in the top 10% (or top 3 if codebase is small)
-	calcLimit := len(churnList) / 10
-	if calcLimit < 1 {
-		calcLimit = 1
-	}
 	calcSum := 0
 	for i := 0; i < calcLimit && i < len(churnList); i++ {
 		calcSum += churnList[i].count
 	}
 	concentrationIndex := (float64(calcSum) / float64(totalFileChanges)) * 100
 
-	log.Printf("[Concentration] Complete: Index=%.2f%%, Hotspots=%d", concentrationIndex, len(hotspots))
+	log.Printf("[Concentration] Complete: Index=%.2f%%, LineIndex=%.2f%%, Hotspots=%d", concentrationIndex, lineConcentrationIndex, len(hotspots))
 
 	return &ConcentrationAnalysis{
-		Available:            true,
-		Window:               "Last 20 Commits",
-		TotalCommitsAnalyzed: totalCommitsAnalyzed,
-		TotalFilesTouched:    len(churnList),
-		ConcentrationIndex:   concentrationIndex,
-		Hotspots:             hotspots,
+		Available:              true,
+		Window:                 window.Label(),
+		TotalCommitsAnalyzed:   totalCommitsAnalyzed,
+		TotalFilesTouched:      len(churnList),
+		TotalLinesChanged:      totalLinesChanged,
+		ConcentrationIndex:     concentrationIndex,
+		LineConcentrationIndex: lineConcentrationIndex,
+		Hotspots:               hotspots,
+		LineHotspots:           lineHotspots,
+		Defects:                defects.Summary,
 	}
 }
 
 // ==================== PREDICTIVE ANALYTICS ENGINE ====================
 
 // analyzePredictions computes forward-looking metrics from real repository data
-func analyzePredictions(client *GitHubClient, owner, repo string, trajectory *TrajectoryAnalysis, concentration *ConcentrationAnalysis, deps *DependencyAnalysis) *PredictiveAnalysis {
+func analyzePredictions(ctx context.Context, client RepoDataSource, owner, repo string, trajectory *TrajectoryAnalysis, concentration *ConcentrationAnalysis, deps *DependencyAnalysis, reviews *ReviewAnalysis) *PredictiveAnalysis {
 	log.Printf("[Predictions] Computing predictive analytics for %s/%s", owner, repo)
 
 	predictions := &PredictiveAnalysis{
@@ -2944,7 +8999,7 @@ func analyzePredictions(client *GitHubClient, owner, repo string, trajectory *Tr
 	}
 
 	// 4. Generate Actionable Recommendations
-	predictions.Recommendations = generateActionableRecommendations(predictions, concentration, deps)
+	predictions.Recommendations = generateActionableRecommendations(predictions, concentration, deps, reviews)
 
 	log.Printf("[Predictions] Generated %d bus factor warnings, %d dep recommendations, %d actions",
 		len(predictions.BusFactorWarnings),
@@ -3111,7 +9166,7 @@ func computePriorityScore(m RecommendationMetrics) float64 {
 }
 
 // generateActionableRecommendations creates prioritized, data-driven recommendations
-func generateActionableRecommendations(predictions *PredictiveAnalysis, concentration *ConcentrationAnalysis, deps *DependencyAnalysis) []ActionableRecommendation {
+func generateActionableRecommendations(predictions *PredictiveAnalysis, concentration *ConcentrationAnalysis, deps *DependencyAnalysis, reviews *ReviewAnalysis) []ActionableRecommendation {
 	recommendations := make([]ActionableRecommendation, 0)
 
 	// Track data availability for confidence scoring
@@ -3291,6 +9346,41 @@ func generateActionableRecommendations(predictions *PredictiveAnalysis, concentr
 		})
 	}
 
+	// 5. Review Load Recommendation (one person reviews most PRs)
+	if reviews != nil && reviews.Available && reviews.ReviewedCount >= 5 && len(reviews.Reviewers) > 0 && reviews.TopReviewerShare > 50 {
+		top := reviews.Reviewers[0]
+		metrics := RecommendationMetrics{
+			ImpactSeverity:       math.Min(reviews.TopReviewerShare, 100) * 0.7,
+			Likelihood:           65, // Review bottlenecks recur every sprint
+			PropagationPotential: 40,
+			HumanRiskFactor:      math.Min(reviews.TopReviewerShare, 100),
+			DataConfidence:       math.Min(float64(reviews.ReviewedCount)/30, 1) * 0.9,
+		}
+		severity := "medium"
+		if reviews.TopReviewerShare > 80 {
+			severity = "critical"
+		} else if reviews.TopReviewerShare > 65 {
+			severity = "high"
+		}
+		recommendations = append(recommendations, ActionableRecommendation{
+			Type:          "redistribute",
+			Target:        "code-review",
+			TargetName:    "Review Load: " + top.Login,
+			Reason:        fmt.Sprintf("Because %s reviewed %.1f%% of %d reviewed pull requests, review throughput depends on one person", top.Login, reviews.TopReviewerShare, reviews.ReviewedCount),
+			Severity:      severity,
+			Impact:        "Add reviewers to CODEOWNERS and rotate review duty so merges do not wait on one person",
+			PriorityScore: computePriorityScore(metrics),
+			Metrics:       metrics,
+			Evidence: EvidenceChain{
+				TriggeringMetric: "reviews.topReviewerShare",
+				ThresholdValue:   50.0,
+				ActualValue:      reviews.TopReviewerShare,
+				AffectedScope:    "pull requests",
+				ProjectKey:       "",
+			},
+		})
+	}
+
 	// Sort by descending priority score
 	sort.Slice(recommendations, func(i, j int) bool {
 		return recommendations[i].PriorityScore > recommendations[j].PriorityScore
@@ -3306,8 +9396,9 @@ func generateActionableRecommendations(predictions *PredictiveAnalysis, concentr
 
 // ==================== ANALYSIS CONFIDENCE COMPUTATION ====================
 
-// computeAnalysisConfidence calculates confidence scores based on data quality
-func computeAnalysisConfidence(commitCount int, fileCount int, weeksCovered int, hasManifest bool) *AnalysisConfidence {
+// computeAnalysisConfidence calculates confidence scores based on data quality.
+// treeCompleteness (0-1) scales the structural score when the file tree is partial.
+func computeAnalysisConfidence(commitCount int, fileCount int, weeksCovered int, hasManifest bool, treeCompleteness float64) *AnalysisConfidence {
 	// Sample score: logarithmic scaling for commit count
 	sampleScore := math.Min(100, math.Log10(float64(commitCount+1))*40)
 	if commitCount < 10 {
@@ -3317,11 +9408,7 @@ func computeAnalysisConfidence(commitCount int, fileCount int, weeksCovered int,
 	// Temporal score: weeks covered (10 points per week, max 100)
 	temporalScore := math.Min(100, float64(weeksCovered)*12.5)
 
-	// Structural score: file count and manifest presence
-	structuralScore := math.Min(100, float64(fileCount)*0.5)
-	if hasManifest {
-		structuralScore = math.Min(100, structuralScore+30)
-	}
+	structuralScore := computeStructuralScore(fileCount, hasManifest, treeCompleteness)
 
 	// Overall: weighted average (0-1 scale)
 	overall := (sampleScore*0.4 + temporalScore*0.35 + structuralScore*0.25) / 100
@@ -3337,6 +9424,7 @@ func computeAnalysisConfidence(commitCount int, fileCount int, weeksCovered int,
 	} else {
 		explanation = "Low confidence: insufficient data for reliable analysis"
 	}
+	explanation += partialTreeNote(treeCompleteness)
 
 	return &AnalysisConfidence{
 		SampleScore:     sampleScore,
@@ -3347,6 +9435,61 @@ func computeAnalysisConfidence(commitCount int, fileCount int, weeksCovered int,
 	}
 }
 
+// computeStructuralScore scores file count and manifest presence (0-100),
+// scaled down by the fraction of the tree that was actually retrieved
+func computeStructuralScore(fileCount int, hasManifest bool, treeCompleteness float64) float64 {
+	score := math.Min(100, float64(fileCount)*0.5)
+	if hasManifest {
+		score = math.Min(100, score+30)
+	}
+	return score * treeCompleteness
+}
+
+func partialTreeNote(treeCompleteness float64) string {
+	if treeCompleteness >= 1 {
+		return ""
+	}
+	return fmt.Sprintf(" (file tree only %.0f%% complete)", treeCompleteness*100)
+}
+
+// treeFileStats counts the files of tree and reports whether any of them is a
+// dependency manifest
+func treeFileStats(tree *GitHubTreeResponse) (fileCount int, hasManifest bool) {
+	for _, node := range treeNodes(tree) {
+		if node.Type != "blob" {
+			continue
+		}
+		fileCount++
+		switch filepath.Base(node.Path) {
+		case "package.json", "go.mod", "requirements.txt", "pyproject.toml", "Cargo.toml", "pom.xml":
+			hasManifest = true
+		}
+	}
+	return fileCount, hasManifest
+}
+
+// computeStructuralConfidence scores tree-derived analyses (topology, impact),
+// which depend on tree coverage rather than commit history
+func computeStructuralConfidence(tree *GitHubTreeResponse) *AnalysisConfidence {
+	if tree == nil {
+		return nil
+	}
+
+	fileCount, hasManifest := treeFileStats(tree)
+	completeness := treeCompleteness(tree)
+	structuralScore := computeStructuralScore(fileCount, hasManifest, completeness)
+
+	explanation := "Complete file tree"
+	if completeness < 1 {
+		explanation = "Partial file tree: structure-derived results may miss modules"
+	}
+	return &AnalysisConfidence{
+		StructuralScore: structuralScore,
+		Overall:         structuralScore / 100,
+		Explanation:     explanation + partialTreeNote(completeness),
+	}
+}
+
 // ==================== PROJECT STATE MANAGEMENT ====================
 
 // getProjectState retrieves cached project state or nil if not found
@@ -3730,54 +9873,51 @@ func simulateFailureScenarios(deps *DependencyAnalysis, concentration *Concentra
 
 // ==================== TEMPORAL HOTSPOT ANALYSIS ====================
 
-func analyzeTemporal(client *GitHubClient, owner, repo string) *TemporalAnalysis {
-	log.Printf("[Temporal] Analyzing commit series for %s/%s", owner, repo)
+func analyzeTemporal(ctx context.Context, client RepoDataSource, owner, repo string, window AnalysisWindow) *TemporalAnalysis {
+	log.Printf("[Temporal] Analyzing commit series for %s/%s (%s)", owner, repo, window.Label())
 
-	// Fetch last 50 commits
-	commits, err := client.GetCommits(owner, repo, 50)
+	commits, err := client.ListCommits(ctx, owner, repo, window.Query())
 	if err != nil {
-		return &TemporalAnalysis{Available: false, Reason: fmt.Sprintf("Failed to fetch commits: %v", err)}
+		return &TemporalAnalysis{Available: false, Reason: fmt.Sprintf("Failed to fetch commits: %v", err), Window: window.Label()}
 	}
 
 	if len(commits) == 0 {
-		return &TemporalAnalysis{Available: false, Reason: "No commits found"}
+		return &TemporalAnalysis{Available: false, Reason: "No commits found", Window: window.Label()}
 	}
 
 	fileTimestamps := make(map[string][]time.Time)
+	fileLines := make(map[string]int)
 
-	// Fetch files for each commit - limit strictly to stay within aggressive rate limits
-	limit := len(commits)
-	if limit > 20 {
-		limit = 20
-	}
-
-	for i := 0; i < limit; i++ {
-		sha := commits[i].SHA
+	fileSets := fetchCommitFileStats(ctx, client, owner, repo, commits)
+	renames := buildRenameGraph(fileSets)
+	for i, files := range fileSets {
 		timestamp := commits[i].Commit.Author.Date
-		files, err := client.GetCommitFiles(owner, repo, sha)
-		if err != nil {
-			continue
-		}
-
 		for _, file := range files {
-			fileTimestamps[file] = append(fileTimestamps[file], timestamp)
+			path := renames.Canonical(i, file.Filename)
+			fileTimestamps[path] = append(fileTimestamps[path], timestamp)
+			fileLines[path] += file.Additions + file.Deletions
 		}
 	}
 
 	if len(fileTimestamps) == 0 {
-		return &TemporalAnalysis{Available: false, Reason: "Insufficient diff data"}
+		return &TemporalAnalysis{Available: false, Reason: "Insufficient diff data", Window: window.Label()}
 	}
 
 	var hotspots []TemporalHotspot
 	totalFiles := 0
 	totalCommitsInWindow := 0
 
-	for _, ts := range fileTimestamps {
+	totalLines := 0
+
+	for path, ts := range fileTimestamps {
 		totalFiles++
 		totalCommitsInWindow += len(ts)
+		totalLines += fileLines[path]
 	}
 
 	medianFrequency := float64(totalCommitsInWindow) / float64(totalFiles)
+	meanLinesPerTouch := float64(totalLines) / float64(totalCommitsInWindow)
+	defects := buildDefectIndex(ctx, client, owner, repo, window, commits, fileSets, renames)
 
 	for path, ts := range fileTimestamps {
 		if len(ts) < 2 {
@@ -3804,6 +9944,13 @@ func analyzeTemporal(client *GitHubClient, owner, repo string) *TemporalAnalysis
 		// Severity = frequency * density
 		severity := (float64(len(ts)) / medianFrequency) * (100.0 / (meanInterval + 1.0))
 
+		// Line-weighted severity scales by how large this file's changes are
+		// compared to the average change, so typo fixes count for little
+		lineSeverity := 0.0
+		if meanLinesPerTouch > 0 {
+			lineSeverity = severity * (float64(fileLines[path]) / float64(len(ts))) / meanLinesPerTouch
+		}
+
 		classification := "drift"
 		if shortestInterval < 4.0 && len(ts) >= 3 {
 			classification = "burst"
@@ -3812,15 +9959,27 @@ func analyzeTemporal(client *GitHubClient, owner, repo string) *TemporalAnalysis
 		hotspots = append(hotspots, TemporalHotspot{
 			Path:               path,
 			CommitCount:        len(ts),
+			LinesChanged:       fileLines[path],
 			FrequencyBaseline:  medianFrequency,
 			ShortestIntervalHr: shortestInterval,
 			MeanIntervalHr:     meanInterval,
 			SeverityScore:      severity,
+			LineSeverityScore:  lineSeverity,
 			Classification:     classification,
 			Timestamps:         ts,
+			FileDefects:        defects.For(path, len(ts)),
 		})
 	}
 
+	lineHotspots := make([]TemporalHotspot, len(hotspots))
+	copy(lineHotspots, hotspots)
+	sort.Slice(lineHotspots, func(i, j int) bool {
+		return lineHotspots[i].LineSeverityScore > lineHotspots[j].LineSeverityScore
+	})
+	if len(lineHotspots) > 10 {
+		lineHotspots = lineHotspots[:10]
+	}
+
 	// Sort hotspots by severity
 	sort.Slice(hotspots, func(i, j int) bool {
 		return hotspots[i].SeverityScore > hotspots[j].SeverityScore
@@ -3836,23 +9995,26 @@ func analyzeTemporal(client *GitHubClient, owner, repo string) *TemporalAnalysis
 		BaselineFound:    true,
 		MedianFrequency:  medianFrequency,
 		TemporalHotspots: hotspots,
-		WindowDays:       30,
+		LineHotspots:     lineHotspots,
+		Window:           window.Label(),
+		WindowDays:       window.spanDays(commits),
+		Defects:          defects.Summary,
 	}
 }
 
 // ==================== BUS FACTOR ANALYSIS ====================
 
-func analyzeBusFactor(client *GitHubClient, owner, repo string, deps *DependencyAnalysis, concentration *ConcentrationAnalysis) *BusFactorAnalysis {
-	log.Printf("[BusFactor] Deepening ownership analysis for %s/%s", owner, repo)
+func analyzeBusFactor(ctx context.Context, client RepoDataSource, owner, repo string, window AnalysisWindow, deps *DependencyAnalysis, concentration *ConcentrationAnalysis) *BusFactorAnalysis {
+	log.Printf("[BusFactor] Deepening ownership analysis for %s/%s (%s)", owner, repo, window.Label())
 
 	// Fetch commits with details for authorship
-	// We want a decent window to establish ownership
-	commits, err := client.GetCommits(owner, repo, 50)
+	commits, err := client.ListCommits(ctx, owner, repo, window.Query())
 	if err != nil || len(commits) == 0 {
 		return &BusFactorAnalysis{
 			Available:   false,
 			Reason:      "No commit history available",
 			DataQuality: "insufficient",
+			Window:      window.Label(),
 		}
 	}
 
@@ -3866,6 +10028,7 @@ func analyzeBusFactor(client *GitHubClient, owner, repo string, deps *Dependency
 			DataQuality: "insufficient",
 			Confidence:  0.1,
 			BusFactor:   0,
+			Window:      window.Label(),
 		}
 	}
 
@@ -3892,9 +10055,6 @@ func analyzeBusFactor(client *GitHubClient, owner, repo string, deps *Dependency
 	}
 
 	limit := len(commits)
-	if limit > 25 {
-		limit = 25 // Stay safe with rate limits
-	}
 
 	// ============================================================
 	// IDENTITY RESOLUTION: Correlate username + email + name
@@ -3951,8 +10111,9 @@ func analyzeBusFactor(client *GitHubClient, owner, repo string, deps *Dependency
 	}
 
 	// Second pass: Collect file authorship with resolved identities
+	fileSets := fetchCommitFileStats(ctx, client, owner, repo, commits)
+	renames := buildRenameGraph(fileSets)
 	for i := 0; i < limit; i++ {
-		sha := commits[i].SHA
 		email := strings.ToLower(strings.TrimSpace(commits[i].Commit.Author.Email))
 		var login string
 		if commits[i].Author != nil && commits[i].Author.Login != "" {
@@ -3973,12 +10134,8 @@ func analyzeBusFactor(client *GitHubClient, owner, repo string, deps *Dependency
 			continue
 		}
 
-		files, err := client.GetCommitFiles(owner, repo, sha)
-		if err != nil {
-			continue
-		}
-
-		for _, file := range files {
+		for _, stat := range fileSets[i] {
+			file := renames.Canonical(i, stat.Filename)
 			if _, exists := fileAuthorCounts[file]; !exists {
 				fileAuthorCounts[file] = make(map[string]int)
 			}
@@ -3996,6 +10153,7 @@ func analyzeBusFactor(client *GitHubClient, owner, repo string, deps *Dependency
 			DataQuality: "insufficient",
 			Confidence:  0.1,
 			BusFactor:   0,
+			Window:      window.Label(),
 		}
 	}
 
@@ -4115,98 +10273,489 @@ func analyzeBusFactor(client *GitHubClient, owner, repo string, deps *Dependency
 		sharedThreshold = 40.0
 	}
 
-	// Count critical metrics
-	criticalSiloCount := 0
-	distributedCount := 0
-	for _, os := range ownerships {
-		if os.OwnershipPercentage >= siloThreshold {
-			criticalSiloCount++
-		} else if os.OwnershipPercentage < sharedThreshold {
-			distributedCount++
+	// Count critical metrics
+	criticalSiloCount := 0
+	distributedCount := 0
+	for _, os := range ownerships {
+		if os.OwnershipPercentage >= siloThreshold {
+			criticalSiloCount++
+		} else if os.OwnershipPercentage < sharedThreshold {
+			distributedCount++
+		}
+	}
+
+	// Find dominant contributor
+	var dominantContributor string
+	var dominantOwnership float64
+	for _, s := range surfaces {
+		if s.OwnedRiskArea > dominantOwnership {
+			dominantOwnership = s.OwnedRiskArea
+			dominantContributor = s.Name
+		}
+	}
+
+	// Calculate data confidence (0-1)
+	commitConfidence := math.Min(float64(len(commits))/50.0, 1.0)
+	fileConfidence := math.Min(float64(totalAnalyzedFiles)/20.0, 1.0)
+	dataConfidence := (commitConfidence + fileConfidence) / 2.0
+
+	// Determine data quality
+	dataQuality := "sufficient"
+	if len(commits) < 10 || totalAnalyzedFiles < 5 {
+		dataQuality = "limited"
+	}
+
+	// Dynamic risk classification with explainability
+	siloRatio := float64(criticalSiloCount) / float64(max(totalAnalyzedFiles, 1))
+	distributionScore := float64(distributedCount) / float64(max(totalAnalyzedFiles, 1))
+
+	riskLevel := "Undetermined"
+	explanation := ""
+	busFactor := len(contributorStats)
+
+	if dataQuality == "limited" && len(contributorStats) <= 1 {
+		riskLevel = "Undetermined"
+		explanation = fmt.Sprintf("Insufficient data: analyzed %d commits across %d files with %d contributor(s). Cannot reliably assess bus factor.",
+			len(commits), totalAnalyzedFiles, len(contributorStats))
+		busFactor = 0
+	} else if dominantOwnership > 70 {
+		riskLevel = "High"
+		busFactor = 1
+		explanation = fmt.Sprintf("Critical: %s controls %.1f%% of analyzed risk surface. %d files have single-owner concentration above %.0f%%.",
+			dominantContributor, dominantOwnership, criticalSiloCount, siloThreshold)
+	} else if siloRatio > 0.5 || len(contributorStats) <= 2 {
+		riskLevel = "Moderate"
+		if busFactor > 2 {
+			busFactor = 2
+		}
+		explanation = fmt.Sprintf("Elevated risk: %.0f%% of files have concentrated ownership. %d unique contributors identified.",
+			siloRatio*100, len(contributorStats))
+	} else if distributionScore > 0.6 && len(contributorStats) >= 3 {
+		riskLevel = "Low"
+		explanation = fmt.Sprintf("Healthy distribution: %.0f%% of files have shared ownership across %d contributors.",
+			distributionScore*100, len(contributorStats))
+	} else {
+		riskLevel = "Moderate"
+		explanation = fmt.Sprintf("Mixed signals: %d files analyzed, %d contributors. Ownership is neither highly concentrated nor well-distributed.",
+			totalAnalyzedFiles, len(contributorStats))
+	}
+
+	return &BusFactorAnalysis{
+		Available:            true,
+		RiskLevel:            riskLevel,
+		Explanation:          explanation,
+		Confidence:           dataConfidence,
+		DataQuality:          dataQuality,
+		FileOwnerships:       ownerships,
+		ContributorSurfaces:  surfaces,
+		TotalContributors:    len(contributorStats),
+		BusFactor:            busFactor,
+		CriticalSiloCount:    criticalSiloCount,
+		DistributedFileCount: distributedCount,
+		DominantContributor:  dominantContributor,
+		DominantOwnership:    dominantOwnership,
+		Window:               window.Label(),
+	}
+}
+
+// ==================== REVIEW FLOW ANALYSIS ====================
+
+// maxReviewPRs caps the PRs one review analysis reads; each costs three requests
+const maxReviewPRs = 100
+
+// prSizeBuckets are upper bounds on lines changed (additions+deletions)
+var prSizeBuckets = []PRSizeBucket{
+	{Label: "XS", MaxLines: 10},
+	{Label: "S", MaxLines: 50},
+	{Label: "M", MaxLines: 250},
+	{Label: "L", MaxLines: 1000},
+	{Label: "XL"},
+}
+
+type prReviewData struct {
+	pr       GitHubPullRequest
+	detailed bool // pr came from the single-PR endpoint and carries size and merged_by
+	reviews  []GitHubReview
+	comments []GitHubReviewComment
+}
+
+// analyzeReviews measures review flow over recent pull requests targeting base
+// (any branch when empty): review latency, merge time, PR size, reviewer load
+// and how often authors merge their own PRs without anyone reviewing them
+func analyzeReviews(ctx context.Context, client RepoDataSource, owner, repo, base string, window AnalysisWindow) *ReviewAnalysis {
+	limit := maxReviewPRs
+	if window.MaxCommits > 0 && window.MaxCommits < limit {
+		limit = window.MaxCommits
+	}
+	label := fmt.Sprintf("Last %d PRs", limit)
+	if window.Days > 0 {
+		label = fmt.Sprintf("Last %d Days (up to %d PRs)", window.Days, limit)
+	}
+	log.Printf("[Reviews] Analyzing pull requests for %s/%s (%s)", owner, repo, label)
+
+	// PRs are not tied to one commit, so a ref-pinned source filters by base instead
+	source, ok := unpinned(client).(PullRequestSource)
+	if !ok {
+		return &ReviewAnalysis{Available: false, Reason: "Pull request data requires a GitHub connection", Base: base, Window: label}
+	}
+
+	var since time.Time
+	if window.Days > 0 {
+		since = time.Now().AddDate(0, 0, -window.Days)
+	}
+	listed, err := source.ListPullRequests(ctx, owner, repo, base, since, limit)
+	if err != nil {
+		return &ReviewAnalysis{Available: false, Reason: fmt.Sprintf("Failed to fetch pull requests: %v", err), Base: base, Window: label}
+	}
+
+	var prs []GitHubPullRequest
+	for _, pr := range listed {
+		if !pr.Draft {
+			prs = append(prs, pr)
+		}
+	}
+	if len(prs) == 0 {
+		return &ReviewAnalysis{Available: false, Reason: "No pull requests found", Base: base, Window: label}
+	}
+
+	data := make([]prReviewData, len(prs))
+	sem := make(chan struct{}, 5) // 5 concurrent PRs
+	var wg sync.WaitGroup
+	for i := range prs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}        // acquire
+			defer func() { <-sem }() // release
+
+			d := prReviewData{pr: prs[i]}
+			if detail, err := source.GetPullRequest(ctx, owner, repo, prs[i].Number); err == nil {
+				d.pr, d.detailed = *detail, true
+			}
+			d.reviews, _ = source.GetPullRequestReviews(ctx, owner, repo, prs[i].Number)
+			d.comments, _ = source.GetPullRequestReviewComments(ctx, owner, repo, prs[i].Number)
+			data[i] = d
+		}(i)
+	}
+	wg.Wait()
+
+	analysis := &ReviewAnalysis{Available: true, PRsAnalyzed: len(prs), Base: base, Window: label}
+	sizes := make([]PRSizeBucket, len(prSizeBuckets))
+	copy(sizes, prSizeBuckets)
+
+	var firstReviewHours, mergeHours, sizeLines []float64
+	reviewers := make(map[string]*ReviewerLoad)
+
+	for _, d := range data {
+		author := ""
+		if d.pr.User != nil {
+			author = d.pr.User.Login
+		}
+
+		merged := d.pr.MergedAt != nil
+		if merged {
+			analysis.MergedCount++
+			mergeHours = append(mergeHours, d.pr.MergedAt.Sub(d.pr.CreatedAt).Hours())
+		} else if d.pr.State == "open" {
+			analysis.OpenCount++
+		}
+
+		if d.detailed {
+			lines := d.pr.Additions + d.pr.Deletions
+			sizeLines = append(sizeLines, float64(lines))
+			for i := range sizes {
+				if sizes[i].MaxLines == 0 || lines <= sizes[i].MaxLines {
+					sizes[i].Count++
+					break
+				}
+			}
+		}
+
+		// Reviews and review comments from anyone but the author count as review
+		var firstReview time.Time
+		seen := make(map[string]bool)
+		note := func(user *GitHubUser, at time.Time) *ReviewerLoad {
+			if user == nil || user.Login == "" || user.Login == author {
+				return nil
+			}
+			if firstReview.IsZero() || at.Before(firstReview) {
+				firstReview = at
+			}
+			load := reviewers[user.Login]
+			if load == nil {
+				load = &ReviewerLoad{Login: user.Login}
+				reviewers[user.Login] = load
+			}
+			if !seen[user.Login] {
+				seen[user.Login] = true
+				load.PRsReviewed++
+			}
+			return load
+		}
+		for _, review := range d.reviews {
+			if review.State == "PENDING" {
+				continue
+			}
+			if load := note(review.User, review.SubmittedAt); load != nil {
+				load.Reviews++
+			}
+		}
+		for _, comment := range d.comments {
+			if load := note(comment.User, comment.CreatedAt); load != nil {
+				load.Comments++
+			}
+		}
+
+		if !firstReview.IsZero() {
+			analysis.ReviewedCount++
+			firstReviewHours = append(firstReviewHours, firstReview.Sub(d.pr.CreatedAt).Hours())
+		} else if merged && d.pr.MergedBy != nil && d.pr.MergedBy.Login == author {
+			analysis.SelfMergedUnreviewed++
+		}
+	}
+
+	analysis.MedianHoursToFirstReview = roundTenth(percentile(firstReviewHours, 0.5))
+	analysis.P90HoursToFirstReview = roundTenth(percentile(firstReviewHours, 0.9))
+	analysis.MedianHoursToMerge = roundTenth(percentile(mergeHours, 0.5))
+	analysis.P90HoursToMerge = roundTenth(percentile(mergeHours, 0.9))
+	analysis.MedianPRSize = int(percentile(sizeLines, 0.5))
+
+	for i := range sizes {
+		if len(sizeLines) > 0 {
+			sizes[i].Percent = float64(sizes[i].Count) / float64(len(sizeLines)) * 100
+		}
+	}
+	analysis.SizeDistribution = sizes
+
+	analysis.Reviewers = make([]ReviewerLoad, 0, len(reviewers))
+	for _, load := range reviewers {
+		load.Share = float64(load.PRsReviewed) / float64(analysis.ReviewedCount) * 100
+		analysis.Reviewers = append(analysis.Reviewers, *load)
+	}
+	sort.Slice(analysis.Reviewers, func(i, j int) bool {
+		if analysis.Reviewers[i].PRsReviewed != analysis.Reviewers[j].PRsReviewed {
+			return analysis.Reviewers[i].PRsReviewed > analysis.Reviewers[j].PRsReviewed
+		}
+		return analysis.Reviewers[i].Login < analysis.Reviewers[j].Login
+	})
+	if len(analysis.Reviewers) > 0 {
+		analysis.TopReviewerShare = analysis.Reviewers[0].Share
+	}
+	if len(analysis.Reviewers) > 10 {
+		analysis.Reviewers = analysis.Reviewers[:10]
+	}
+
+	if analysis.MergedCount > 0 {
+		analysis.SelfMergedUnreviewedRate = float64(analysis.SelfMergedUnreviewed) / float64(analysis.MergedCount) * 100
+	}
+
+	log.Printf("[Reviews] %d PRs: %d merged, %d reviewed, top reviewer share %.1f%%",
+		analysis.PRsAnalyzed, analysis.MergedCount, analysis.ReviewedCount, analysis.TopReviewerShare)
+	return analysis
+}
+
+// percentile returns the nearest-rank p-th percentile (0-1) of values
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+func roundTenth(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// ==================== DEFECT LINKAGE ====================
+
+// fixRefRe matches the closing keywords GitHub recognizes, e.g. "fixes #123" or "Closes: #7"
+var fixRefRe = regexp.MustCompile(`(?i)\b(?:fix(?:e[sd])?|close[sd]?|resolve[sd]?):?\s+#(\d+)\b`)
+
+// bugLabelRe marks an issue as a defect report: "bug", "type: bug", "kind/regression"
+var bugLabelRe = regexp.MustCompile(`(?i)\b(?:bug|defect|regression|crash)\b`)
+
+const (
+	maxDefectIssues = 1000 // Issues listed per analysis
+	maxIssueLookups = 50   // Single-issue fetches for references outside the listing
+)
+
+// fixReferences returns the issue numbers a commit message closes
+func fixReferences(message string) []int {
+	var numbers []int
+	for _, m := range fixRefRe.FindAllStringSubmatch(message, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			numbers = append(numbers, n)
 		}
 	}
+	return numbers
+}
 
-	// Find dominant contributor
-	var dominantContributor string
-	var dominantOwnership float64
-	for _, s := range surfaces {
-		if s.OwnedRiskArea > dominantOwnership {
-			dominantOwnership = s.OwnedRiskArea
-			dominantContributor = s.Name
+func isBugIssue(issue *GitHubIssue) bool {
+	for _, label := range issue.Labels {
+		if bugLabelRe.MatchString(label.Name) {
+			return true
 		}
 	}
+	return false
+}
 
-	// Calculate data confidence (0-1)
-	commitConfidence := math.Min(float64(len(commits))/50.0, 1.0)
-	fileConfidence := math.Min(float64(totalAnalyzedFiles)/20.0, 1.0)
-	dataConfidence := (commitConfidence + fileConfidence) / 2.0
+// DefectIndex maps canonical file paths to the bug issues fixed in them
+type DefectIndex struct {
+	Summary *DefectSummary
+	issues  map[string]map[int]bool
+	hours   map[int]float64 // Time to fix per bug issue
+}
 
-	// Determine data quality
-	dataQuality := "sufficient"
-	if len(commits) < 10 || totalAnalyzedFiles < 5 {
-		dataQuality = "limited"
+// buildDefectIndex resolves closing references in commits against the issue
+// tracker and attributes each bug issue to the files its fixing commits touched.
+// fileSets is index-aligned with commits, as from fetchCommitFileStats. A run
+// snapshot builds the index once and shares it between analyzers.
+func buildDefectIndex(ctx context.Context, client RepoDataSource, owner, repo string, window AnalysisWindow, commits []GitHubCommit, fileSets [][]CommitFileStat, renames *RenameGraph) *DefectIndex {
+	snapshot, ok := client.(*runSnapshot)
+	if !ok {
+		index, _ := indexDefects(ctx, client, owner, repo, window, commits, fileSets, renames)
+		return index
 	}
 
-	// Dynamic risk classification with explainability
-	siloRatio := float64(criticalSiloCount) / float64(max(totalAnalyzedFiles, 1))
-	distributionScore := float64(distributedCount) / float64(max(totalAnalyzedFiles, 1))
+	v, err := snapshot.load(ctx, "defects:"+commitQueryKey(window.Query()), func() (interface{}, error) {
+		return indexDefects(ctx, client, owner, repo, window, commits, fileSets, renames)
+	})
+	if index, ok := v.(*DefectIndex); ok {
+		return index
+	}
+	// The request gave up waiting for another analyzer's build
+	index := newDefectIndex()
+	index.Summary.Reason = fmt.Sprintf("Failed to fetch issues: %v", err)
+	return index
+}
 
-	riskLevel := "Undetermined"
-	explanation := ""
-	busFactor := len(contributorStats)
+func newDefectIndex() *DefectIndex {
+	return &DefectIndex{
+		Summary: &DefectSummary{},
+		issues:  make(map[string]map[int]bool),
+		hours:   make(map[int]float64),
+	}
+}
 
-	if dataQuality == "limited" && len(contributorStats) <= 1 {
-		riskLevel = "Undetermined"
-		explanation = fmt.Sprintf("Insufficient data: analyzed %d commits across %d files with %d contributor(s). Cannot reliably assess bus factor.",
-			len(commits), totalAnalyzedFiles, len(contributorStats))
-		busFactor = 0
-	} else if dominantOwnership > 70 {
-		riskLevel = "High"
-		busFactor = 1
-		explanation = fmt.Sprintf("Critical: %s controls %.1f%% of analyzed risk surface. %d files have single-owner concentration above %.0f%%.",
-			dominantContributor, dominantOwnership, criticalSiloCount, siloThreshold)
-	} else if siloRatio > 0.5 || len(contributorStats) <= 2 {
-		riskLevel = "Moderate"
-		if busFactor > 2 {
-			busFactor = 2
+// indexDefects builds a DefectIndex. The error reports a failed issue listing,
+// which the index also records as its Reason.
+func indexDefects(ctx context.Context, client RepoDataSource, owner, repo string, window AnalysisWindow, commits []GitHubCommit, fileSets [][]CommitFileStat, renames *RenameGraph) (*DefectIndex, error) {
+	index := newDefectIndex()
+
+	source, ok := unpinned(client).(IssueSource)
+	if !ok {
+		index.Summary.Reason = "Issue data requires a GitHub connection"
+		return index, nil
+	}
+
+	var since time.Time
+	if window.Days > 0 {
+		since = time.Now().AddDate(0, 0, -window.Days)
+	}
+	listed, err := source.ListIssues(ctx, owner, repo, since, maxDefectIssues)
+	if err != nil {
+		index.Summary.Reason = fmt.Sprintf("Failed to fetch issues: %v", err)
+		return index, err
+	}
+
+	issues := make(map[int]*GitHubIssue, len(listed))
+	for i := range listed {
+		issues[listed[i].Number] = &listed[i]
+	}
+
+	failed := make(map[int]bool) // Lookups that errored, kept apart from issues that do not exist
+	lookups := 0
+	totalHours := 0.0
+	for i, commit := range commits {
+		refs := fixReferences(commit.Commit.Message)
+		if len(refs) == 0 || fileSets[i] == nil {
+			continue
+		}
+
+		fixesBug := false
+		for _, number := range refs {
+			issue, known := issues[number]
+			if !known && !failed[number] && lookups < maxIssueLookups {
+				lookups++
+				var err error
+				if issue, err = source.GetIssue(ctx, owner, repo, number); err != nil {
+					log.Printf("[Defects] Failed to fetch issue #%d of %s/%s: %v", number, owner, repo, err)
+					failed[number] = true
+					continue
+				}
+				issues[number] = issue // nil records an issue that does not exist
+			}
+			if issue == nil || len(issue.PullRequest) > 0 || !isBugIssue(issue) {
+				continue
+			}
+			fixesBug = true
+
+			if _, seen := index.hours[number]; !seen {
+				fixedAt := commit.Commit.Author.Date
+				if issue.ClosedAt != nil {
+					fixedAt = *issue.ClosedAt
+				}
+				index.hours[number] = math.Max(fixedAt.Sub(issue.CreatedAt).Hours(), 0)
+				totalHours += index.hours[number]
+			}
+			for _, file := range fileSets[i] {
+				path := renames.Canonical(i, file.Filename)
+				if index.issues[path] == nil {
+					index.issues[path] = make(map[int]bool)
+				}
+				index.issues[path][number] = true
+			}
+		}
+		if fixesBug {
+			index.Summary.FixCommits++
 		}
-		explanation = fmt.Sprintf("Elevated risk: %.0f%% of files have concentrated ownership. %d unique contributors identified.",
-			siloRatio*100, len(contributorStats))
-	} else if distributionScore > 0.6 && len(contributorStats) >= 3 {
-		riskLevel = "Low"
-		explanation = fmt.Sprintf("Healthy distribution: %.0f%% of files have shared ownership across %d contributors.",
-			distributionScore*100, len(contributorStats))
-	} else {
-		riskLevel = "Moderate"
-		explanation = fmt.Sprintf("Mixed signals: %d files analyzed, %d contributors. Ownership is neither highly concentrated nor well-distributed.",
-			totalAnalyzedFiles, len(contributorStats))
 	}
 
-	return &BusFactorAnalysis{
-		Available:            true,
-		RiskLevel:            riskLevel,
-		Explanation:          explanation,
-		Confidence:           dataConfidence,
-		DataQuality:          dataQuality,
-		FileOwnerships:       ownerships,
-		ContributorSurfaces:  surfaces,
-		TotalContributors:    len(contributorStats),
-		BusFactor:            busFactor,
-		CriticalSiloCount:    criticalSiloCount,
-		DistributedFileCount: distributedCount,
-		DominantContributor:  dominantContributor,
-		DominantOwnership:    dominantOwnership,
+	index.Summary.Available = true
+	index.Summary.IssuesIngested = len(listed)
+	index.Summary.BugIssuesLinked = len(index.hours)
+	index.Summary.LookupFailures = len(failed)
+	if len(index.hours) > 0 {
+		index.Summary.MeanHoursToFix = roundTenth(totalHours / float64(len(index.hours)))
+	}
+	log.Printf("[Defects] %s/%s: %d issues ingested, %d bug issues linked via %d fix commits, %d lookups failed",
+		owner, repo, index.Summary.IssuesIngested, index.Summary.BugIssuesLinked, index.Summary.FixCommits, index.Summary.LookupFailures)
+	return index, nil
+}
+
+// For returns the defect figures of a file touched by commitCount commits
+func (d *DefectIndex) For(path string, commitCount int) FileDefects {
+	numbers := d.issues[path]
+	if len(numbers) == 0 {
+		return FileDefects{}
+	}
+
+	fd := FileDefects{DefectCount: len(numbers)}
+	if commitCount > 0 {
+		fd.DefectDensity = float64(len(numbers)) / float64(commitCount)
+	}
+	total := 0.0
+	for number := range numbers {
+		total += d.hours[number]
 	}
+	fd.MeanHoursToFix = roundTenth(total / float64(len(numbers)))
+	return fd
 }
 
 // ==================== DOCUMENTATION DRIFT ANALYSIS ====================
 
-func analyzeDocDrift(client *GitHubClient, owner, repo string) *DocDriftAnalysis {
-	log.Printf("[DocDrift] Analyzing documentation evolution for %s/%s", owner, repo)
+func analyzeDocDrift(ctx context.Context, client RepoDataSource, owner, repo string, window AnalysisWindow) *DocDriftAnalysis {
+	log.Printf("[DocDrift] Analyzing documentation evolution for %s/%s (%s)", owner, repo, window.Label())
 
-	commits, err := client.GetCommits(owner, repo, 50)
+	commits, err := client.ListCommits(ctx, owner, repo, window.Query())
 	if err != nil || len(commits) == 0 {
-		return &DocDriftAnalysis{Available: false, Reason: "Insufficient commit history"}
+		return &DocDriftAnalysis{Available: false, Reason: "Insufficient commit history", Window: window.Label()}
 	}
 
 	docCommitCount := 0
@@ -4218,18 +10767,12 @@ func analyzeDocDrift(client *GitHubClient, owner, repo string) *DocDriftAnalysis
 	var docTimestamps []time.Time
 	var codeTimestamps []time.Time
 
-	limit := len(commits)
-	if limit > 30 {
-		limit = 30
-	}
-
-	for i := 0; i < limit; i++ {
-		sha := commits[i].SHA
-		timestamp := commits[i].Commit.Author.Date
-		files, err := client.GetCommitFiles(owner, repo, sha)
-		if err != nil {
+	for i, stats := range fetchCommitFileStats(ctx, client, owner, repo, commits) {
+		if stats == nil {
 			continue
 		}
+		files := commitFilenames(stats)
+		timestamp := commits[i].Commit.Author.Date
 
 		hasDoc := false
 		hasCode := false
@@ -4268,7 +10811,7 @@ func analyzeDocDrift(client *GitHubClient, owner, repo string) *DocDriftAnalysis
 
 	totalAnalyzed := docCommitCount + codeCommitCount + mixedCommitCount
 	if totalAnalyzed == 0 {
-		return &DocDriftAnalysis{Available: false, Reason: "No documentation or code changes detected in recent window"}
+		return &DocDriftAnalysis{Available: false, Reason: "No documentation or code changes detected in recent window", Window: window.Label()}
 	}
 
 	driftRatio := float64(docCommitCount+mixedCommitCount) / float64(totalAnalyzed)
@@ -4326,14 +10869,281 @@ func analyzeDocDrift(client *GitHubClient, owner, repo string) *DocDriftAnalysis
 		TemporalOffsetDays: offsetDays,
 		Classification:     classification,
 		Interpretation:     interpretation,
+		Window:             window.Label(),
+	}
+}
+
+// ==================== SUBMODULES ====================
+
+// maxSubmoduleRecursion caps how many submodule trees one run reads
+const maxSubmoduleRecursion = 20
+
+// recurseSubmodules (RECURSE_SUBMODULES) reads the trees of submodules the
+// project's connection can access, so their files count toward the project's
+// structure
+var recurseSubmodules bool
+
+// Submodule is a gitlink in the tree: another repository pinned at a commit
+type Submodule struct {
+	Path      string `json:"path"`
+	SHA       string `json:"sha"`                // Pinned commit
+	URL       string `json:"url,omitempty"`      // From .gitmodules
+	Branch    string `json:"branch,omitempty"`   // From .gitmodules
+	FullName  string `json:"fullName,omitempty"` // owner/repo derived from URL
+	Linked    bool   `json:"linked"`             // FullName is itself a discovered project
+	Recursed  bool   `json:"recursed"`           // Its tree was read through the project's connection
+	FileCount int    `json:"fileCount"`          // Files at the pinned commit, when recursed
+}
+
+type gitModule struct {
+	url    string
+	branch string
+}
+
+// parseGitModules reads a .gitmodules file into path -> module
+func parseGitModules(content []byte) map[string]gitModule {
+	modules := make(map[string]gitModule)
+	var current gitModule
+	currentPath := ""
+	inSubmodule := false
+	flush := func() {
+		if currentPath != "" {
+			modules[currentPath] = current
+		}
+		current, currentPath = gitModule{}, ""
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			flush()
+			inSubmodule = strings.HasPrefix(line, "[submodule")
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !inSubmodule || !found {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "path":
+			currentPath = strings.TrimSuffix(value, "/")
+		case "url":
+			current.url = value
+		case "branch":
+			current.branch = value
+		}
+	}
+	flush()
+	return modules
+}
+
+// submoduleRepoName derives the full owner/repo path from a submodule URL,
+// keeping every namespace segment (GitLab's group/sub/project). Relative URLs
+// ("../lib.git") resolve against the superproject's own path.
+func submoduleRepoName(rawURL, superproject string) string {
+	name := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(rawURL), "/"), ".git")
+	switch {
+	case strings.HasPrefix(name, "../") || strings.HasPrefix(name, "./"):
+		name = path.Join(superproject, name)
+		if strings.HasPrefix(name, "..") {
+			return ""
+		}
+	case strings.Contains(name, "://"):
+		parsed, err := url.Parse(name)
+		if err != nil {
+			return ""
+		}
+		name = parsed.Path
+	case strings.Contains(name, ":"):
+		// scp-like: git@host:owner/repo
+		name = name[strings.Index(name, ":")+1:]
+	}
+
+	name = strings.Trim(name, "/")
+	if _, _, ok := splitFullName(name); !ok || strings.Contains(name, "//") {
+		return ""
+	}
+	return name
+}
+
+// submoduleHost returns the lowercase host of a submodule URL, or "" for a
+// relative URL, which lives on the superproject's host
+func submoduleHost(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	switch {
+	case strings.HasPrefix(rawURL, "../"):
+		return ""
+	case strings.Contains(rawURL, "://"):
+		parsed, err := url.Parse(rawURL)
+		if err != nil {
+			return ""
+		}
+		return strings.ToLower(parsed.Hostname())
+	case strings.Contains(rawURL, ":"):
+		// scp-like: git@host:owner/repo
+		host := rawURL[:strings.Index(rawURL, ":")]
+		return strings.ToLower(host[strings.LastIndex(host, "@")+1:])
+	}
+	return ""
+}
+
+// sourceHost returns the lowercase web host a data source reads from, as it
+// appears in clone URLs, or "" for local clones
+func sourceHost(client RepoDataSource) string {
+	var base string
+	switch c := unpinned(client).(type) {
+	case *GitHubClient:
+		base = githubWebURL(c.baseURL)
+	case *GitLabClient:
+		base = c.baseURL
+	default:
+		return ""
+	}
+	parsed, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// discoveredHost returns the lowercase web host repo was discovered on, as
+// it appears in clone URLs like sourceHost, or "" for local clones
+func discoveredHost(repo *DiscoveredRepo) string {
+	provider, host, ok := strings.Cut(connectionHost(repo.ConnectionID), ":")
+	if !ok {
+		return ""
+	}
+	base := "https://" + host
+	if provider == "github" {
+		base = githubWebURL(base)
+	}
+	parsed, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// detectSubmodules lists the tree's gitlinks, described by .gitmodules. With
+// recurseSubmodules set it also reads each accessible submodule's tree at the
+// pinned commit and returns tree extended with those files under the
+// submodule's path; otherwise the returned tree is tree itself. Only
+// submodules on the connection's own host are read: the same owner/repo on
+// another host is a different repository. The extended
+// tree is for structural analyzers only: its submodule files cannot be read
+// through the project's client.
+func detectSubmodules(ctx context.Context, client RepoDataSource, owner, repo string, tree *GitHubTreeResponse) ([]Submodule, *GitHubTreeResponse) {
+	var submodules []Submodule
+	hasGitModules := false
+	for _, node := range treeNodes(tree) {
+		switch {
+		case node.Type == "commit":
+			submodules = append(submodules, Submodule{Path: node.Path, SHA: node.SHA})
+		case node.Type == "blob" && node.Path == ".gitmodules":
+			hasGitModules = true
+		}
+	}
+	if len(submodules) == 0 {
+		return nil, tree
+	}
+
+	var modules map[string]gitModule
+	if hasGitModules {
+		if content, err := client.GetFileContent(ctx, owner, repo, ".gitmodules"); err == nil {
+			modules = parseGitModules(content)
+		}
+	}
+
+	// A submodule is linked when a connection lists the same path on the
+	// same host; relative URLs live on the superproject's host
+	host := sourceHost(client)
+	stateLock.RLock()
+	discovered := make(map[string]bool, len(state.DiscoveredRepos))
+	for i := range state.DiscoveredRepos {
+		r := &state.DiscoveredRepos[i]
+		discovered[discoveredHost(r)+"/"+strings.ToLower(r.FullName)] = true
+	}
+	stateLock.RUnlock()
+
+	for i := range submodules {
+		sub := &submodules[i]
+		if module, ok := modules[sub.Path]; ok {
+			sub.URL = module.url
+			sub.Branch = module.branch
+			sub.FullName = submoduleRepoName(module.url, owner+"/"+repo)
+		}
+		subHost := submoduleHost(sub.URL)
+		if subHost == "" {
+			subHost = host
+		}
+		sub.Linked = sub.FullName != "" && discovered[subHost+"/"+strings.ToLower(sub.FullName)]
+	}
+
+	if !recurseSubmodules {
+		return submodules, tree
+	}
+
+	// Submodule trees come from other repositories, so read them past the
+	// run's snapshot and ref pin, which only describe this project
+	source := unpinned(client)
+	extended := *tree
+	extended.Tree = append([]GitHubTreeNode(nil), tree.Tree...)
+	reads := 0
+	for i := range submodules {
+		sub := &submodules[i]
+		if sub.FullName == "" || sub.SHA == "" {
+			continue
+		}
+		if subHost := submoduleHost(sub.URL); subHost != "" && subHost != host {
+			log.Printf("[Submodules] %s (%s) is on %s, not this connection's host, skipping", sub.Path, sub.FullName, subHost)
+			continue
+		}
+		if reads >= maxSubmoduleRecursion {
+			log.Printf("[Submodules] Read %d submodule trees, skipping the rest", reads)
+			break
+		}
+		reads++
+		subOwner, subName, _ := splitFullName(sub.FullName)
+		subtree, err := source.GetFileTree(ctx, subOwner, subName, sub.SHA)
+		if err != nil {
+			log.Printf("[Submodules] %s (%s) not readable: %v", sub.Path, sub.FullName, err)
+			continue
+		}
+		sub.Recursed = true
+		for _, node := range subtree.Tree {
+			node.Path = sub.Path + "/" + node.Path
+			extended.Tree = append(extended.Tree, node)
+			if node.Type == "blob" {
+				sub.FileCount++
+			}
+		}
+	}
+
+	log.Printf("[Submodules] %s/%s: %d submodules", owner, repo, len(submodules))
+	return submodules, &extended
+}
+
+// submoduleOf returns the path of the submodule containing filePath, or ""
+func submoduleOf(filePath string, submodules []Submodule) string {
+	for _, sub := range submodules {
+		if strings.HasPrefix(filePath, sub.Path+"/") {
+			return sub.Path
+		}
 	}
+	return ""
 }
 
 // ==================== TOPOLOGY ANALYSIS ENGINE ====================
 
 // analyzeTopology computes topology from real directory structure
 // No mock data - derives modules, clusters, and metrics from file tree
-func analyzeTopology(tree *GitHubTreeResponse) *TopologyAnalysis {
+// Submodules become external modules of their own, holding any recursed files
+// Edges aggregate the resolved imports of graph per module pair
+func analyzeTopology(tree *GitHubTreeResponse, submodules []Submodule, graph *ImportGraph) *TopologyAnalysis {
 	if tree == nil || len(tree.Tree) == 0 {
 		return &TopologyAnalysis{
 			Available: false,
@@ -4354,11 +11164,27 @@ func analyzeTopology(tree *GitHubTreeResponse) *TopologyAnalysis {
 	rootFiles := []string{}
 	rootExts := make(map[string]int)
 
+	external := make(map[string]bool, len(submodules))
+	for _, sub := range submodules {
+		external[sub.Path] = true
+		dirFiles[sub.Path] = []string{}
+		dirExts[sub.Path] = make(map[string]int)
+	}
+
 	for _, node := range tree.Tree {
 		if node.Type != "blob" {
 			continue
 		}
 
+		// Submodule files belong to their submodule, even under ignored paths like vendor/
+		if sub := submoduleOf(node.Path, submodules); sub != "" {
+			dirFiles[sub] = append(dirFiles[sub], node.Path)
+			if idx := strings.LastIndex(node.Path, "."); idx != -1 {
+				dirExts[sub][node.Path[idx:]]++
+			}
+			continue
+		}
+
 		// Check ignore patterns
 		skip := false
 		for _, pattern := range ignorePatterns {
@@ -4465,6 +11291,7 @@ func analyzeTopology(tree *GitHubTreeResponse) *TopologyAnalysis {
 			Language:   lang,
 			DependsOn:  []string{},
 			DependedBy: []string{},
+			External:   external[dir],
 		})
 	}
 
@@ -4473,28 +11300,57 @@ func analyzeTopology(tree *GitHubTreeResponse) *TopologyAnalysis {
 		return modules[i].FileCount > modules[j].FileCount
 	})
 
-	// Step 3: Infer dependencies from naming conventions and structure
-	// Simple heuristic: common prefixes/suffixes suggest relationships
+	// Step 3: Module dependencies from resolved source imports, weighted by
+	// how many imports cross from one module into the other
 	edges := make([]TopologyEdge, 0)
-	for i := range modules {
-		for j := range modules {
-			if i == j {
+	edgeSource := "imports"
+	if graph != nil && graph.ParsedFiles > 0 {
+		index := make(map[string]int, len(modules))
+		for i := range modules {
+			index[modules[i].ID] = i
+		}
+		weights := make(map[[2]string]int)
+		for _, imp := range graph.Imports {
+			if imp.Target == "" {
 				continue
 			}
-			// Dependency heuristics
-			// 1. "test" or "tests" depends on main module
-			if strings.Contains(modules[i].Name, "test") && !strings.Contains(modules[j].Name, "test") {
-				edges = append(edges, TopologyEdge{
-					Source: modules[i].ID,
-					Target: modules[j].ID,
-					Weight: 1,
-				})
-				modules[i].DependsOn = append(modules[i].DependsOn, modules[j].ID)
-				modules[j].DependedBy = append(modules[j].DependedBy, modules[i].ID)
+			source, target := topologyModuleOf(imp.File, submodules), topologyModuleOf(imp.Target, submodules)
+			_, knownSource := index[source]
+			_, knownTarget := index[target]
+			if source != target && knownSource && knownTarget {
+				weights[[2]string{source, target}]++
+			}
+		}
+		pairs := make([][2]string, 0, len(weights))
+		for pair := range weights {
+			pairs = append(pairs, pair)
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			if pairs[i][0] != pairs[j][0] {
+				return pairs[i][0] < pairs[j][0]
 			}
-			// 2. "utils", "lib", "common" are depended upon
-			if strings.Contains(modules[j].Name, "lib") || strings.Contains(modules[j].Name, "util") || strings.Contains(modules[j].Name, "common") {
-				if !strings.Contains(modules[i].Name, "lib") && !strings.Contains(modules[i].Name, "util") && !strings.Contains(modules[i].Name, "common") {
+			return pairs[i][1] < pairs[j][1]
+		})
+		for _, pair := range pairs {
+			edges = append(edges, TopologyEdge{Source: pair[0], Target: pair[1], Weight: weights[pair]})
+			modules[index[pair[0]]].DependsOn = append(modules[index[pair[0]]].DependsOn, pair[1])
+			modules[index[pair[1]]].DependedBy = append(modules[index[pair[1]]].DependedBy, pair[0])
+		}
+	}
+
+	// Without any readable source, infer dependencies from naming conventions
+	// Simple heuristic: common prefixes/suffixes suggest relationships
+	if graph == nil || graph.ParsedFiles == 0 {
+		edgeSource = "naming-heuristic"
+		for i := range modules {
+			for j := range modules {
+				// Naming heuristics say nothing about another repository's code
+				if i == j || modules[i].External || modules[j].External {
+					continue
+				}
+				// Dependency heuristics
+				// 1. "test" or "tests" depends on main module
+				if strings.Contains(modules[i].Name, "test") && !strings.Contains(modules[j].Name, "test") {
 					edges = append(edges, TopologyEdge{
 						Source: modules[i].ID,
 						Target: modules[j].ID,
@@ -4503,6 +11359,18 @@ func analyzeTopology(tree *GitHubTreeResponse) *TopologyAnalysis {
 					modules[i].DependsOn = append(modules[i].DependsOn, modules[j].ID)
 					modules[j].DependedBy = append(modules[j].DependedBy, modules[i].ID)
 				}
+				// 2. "utils", "lib", "common" are depended upon
+				if strings.Contains(modules[j].Name, "lib") || strings.Contains(modules[j].Name, "util") || strings.Contains(modules[j].Name, "common") {
+					if !strings.Contains(modules[i].Name, "lib") && !strings.Contains(modules[i].Name, "util") && !strings.Contains(modules[i].Name, "common") {
+						edges = append(edges, TopologyEdge{
+							Source: modules[i].ID,
+							Target: modules[j].ID,
+							Weight: 1,
+						})
+						modules[i].DependsOn = append(modules[i].DependsOn, modules[j].ID)
+						modules[j].DependedBy = append(modules[j].DependedBy, modules[i].ID)
+					}
+				}
 			}
 		}
 	}
@@ -4521,6 +11389,9 @@ func analyzeTopology(tree *GitHubTreeResponse) *TopologyAnalysis {
 		if clusterKey == "Unknown" {
 			clusterKey = "Other"
 		}
+		if mod.External {
+			clusterKey = "Submodules"
+		}
 		clusterMap[clusterKey] = append(clusterMap[clusterKey], mod.ID)
 	}
 
@@ -4605,7 +11476,7 @@ func analyzeTopology(tree *GitHubTreeResponse) *TopologyAnalysis {
 		cascadingDebt = "Active"
 	}
 
-	return &TopologyAnalysis{
+	result := &TopologyAnalysis{
 		Available: true,
 		Modules:   modules,
 		Clusters:  clusters,
@@ -4618,21 +11489,101 @@ func analyzeTopology(tree *GitHubTreeResponse) *TopologyAnalysis {
 			TotalModules:        len(modules),
 			TotalEdges:          len(edges),
 		},
+		EdgeSource: edgeSource,
+		Submodules: submodules,
+		Confidence: computeStructuralConfidence(tree),
+	}
+	if graph != nil {
+		result.SourceFiles = graph.SourceFiles
+		result.ParsedFiles = graph.ParsedFiles
 	}
+	return result
 }
 
 // ==================== STATE PERSISTENCE ====================
 
+// loadState restores what saveStateUnsafe wrote, so discovered repos and their
+// analyses survive a restart. Credentials are never written: restored repos
+// are read again once their account reconnects, or through GITHUB_TOKEN when
+// they live on its host (see connectionFor). Without a readable file the
+// state starts clean.
 func loadState() {
 	stateLock.Lock()
 	defer stateLock.Unlock()
 
-	// Always start with fresh state for production deployments
-	// Each user session should be independent
 	state = AppState{
 		Analyses: make(map[string]*RepoAnalysis),
 	}
-	log.Printf("[Startup] Initialized with clean state")
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		log.Printf("[Startup] Initialized with clean state")
+		return
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("[Startup] Ignoring unreadable %s: %v", stateFile, err)
+		state = AppState{
+			Analyses: make(map[string]*RepoAnalysis),
+		}
+		return
+	}
+	if state.Analyses == nil {
+		state.Analyses = make(map[string]*RepoAnalysis)
+	}
+	migrateStateUnsafe()
+	log.Printf("[Startup] Restored %d repos and %d analyses from %s", len(state.DiscoveredRepos), len(state.Analyses), stateFile)
+}
+
+// migrateStateUnsafe upgrades state written before repos carried their
+// connection. The recorded account gets its connection ID and its repos,
+// or, with no account recorded, the repos go to the GITHUB_TOKEN host.
+// Their analyses and the selection are then rekeyed by repoKey. Callers
+// hold stateLock.
+func migrateStateUnsafe() {
+	legacyID := connectionID("github", envGitHubAPIURL, "")
+	if conn := state.Connection; conn != nil {
+		if conn.ID == "" {
+			provider, baseURL := conn.Provider, conn.BaseURL
+			if provider == "" {
+				provider = "github"
+			}
+			if baseURL == "" {
+				baseURL = envGitHubAPIURL
+			}
+			conn.ID = connectionID(provider, baseURL, conn.Username)
+		}
+		legacyID = conn.ID
+		if len(state.Connections) == 0 {
+			state.Connections = []*GitHubConnection{conn}
+		}
+	}
+
+	migrated := 0
+	for i := range state.DiscoveredRepos {
+		repo := &state.DiscoveredRepos[i]
+		if repo.ConnectionID != "" {
+			continue
+		}
+		repo.ConnectionID = legacyID
+		key := repoKey(repo)
+
+		var names []string
+		for name := range state.Analyses {
+			if name == repo.FullName || strings.HasPrefix(name, repo.FullName+"@") {
+				names = append(names, name)
+			}
+		}
+		for _, name := range names {
+			state.Analyses[key+strings.TrimPrefix(name, repo.FullName)] = state.Analyses[name]
+			delete(state.Analyses, name)
+		}
+		if state.SelectedProject == repo.FullName {
+			state.SelectedProject = key
+		}
+		migrated++
+	}
+	if migrated > 0 {
+		log.Printf("[Startup] Assigned %d repos from an older state file to %s", migrated, legacyID)
+	}
 }
 
 func saveStateUnsafe() {
@@ -4646,8 +11597,34 @@ func saveState() {
 	saveStateUnsafe()
 }
 
-// ==================== SECURITY MIDDLEWARE ====================
-
+// ==================== SECURITY MIDDLEWARE ====================
+
+// connectSrcExtraOrigin returns the origins of configured GHES/GitLab hosts
+// (each with a leading space) so the CSP connect-src allows them
+func connectSrcExtraOrigin() string {
+	baseURLs := []string{envGitHubAPIURL}
+	for _, conn := range liveConnections() {
+		if conn.provider != "local" {
+			baseURLs = append(baseURLs, conn.baseURL)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var origins strings.Builder
+	for _, baseURL := range baseURLs {
+		parsed, err := url.Parse(baseURL)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Host == "api.github.com" {
+			continue
+		}
+		origin := parsed.Scheme + "://" + parsed.Host
+		if !seen[origin] {
+			seen[origin] = true
+			origins.WriteString(" " + origin)
+		}
+	}
+	return origins.String()
+}
+
 // Allowed origins for CORS (production + development)
 var allowedOrigins = map[string]bool{
 	"http://localhost:5173":           true,
@@ -4775,7 +11752,7 @@ func securityMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
 		w.Header().Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
 		// CSP allows inline styles (needed for React) but restricts other resources
-		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline' 'unsafe-eval'; style-src 'self' 'unsafe-inline'; img-src 'self' data: https:; font-src 'self' https:; connect-src 'self' https://api.github.com https://*.vercel.app;")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline' 'unsafe-eval'; style-src 'self' 'unsafe-inline'; img-src 'self' data: https:; font-src 'self' https:; connect-src 'self' https://api.github.com"+connectSrcExtraOrigin()+" https://*.vercel.app;")
 
 		// === 4. Handle preflight ===
 		if r.Method == "OPTIONS" {
@@ -4840,92 +11817,187 @@ func githubConnect(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Token        string `json:"token"`
 		Organization string `json:"organization"`
+		Provider     string `json:"provider"`   // "github" (default) or "gitlab"
+		BaseURL      string `json:"baseUrl"`    // GHES API root or GitLab instance URL; empty for the public hosts
+		AppID        int64  `json:"appId"`      // GitHub App ID, used with privateKey instead of a token
+		PrivateKey   string `json:"privateKey"` // GitHub App private key (PEM)
+
+		Discovery DiscoveryScope `json:"discovery"` // Organization falls back to the top-level field
 	}
 	body, _ := io.ReadAll(r.Body)
 	json.Unmarshal(body, &input)
 
-	if input.Token == "" {
+	if input.Discovery.Organization == "" {
+		input.Discovery.Organization = input.Organization
+	}
+	if err := validateDiscoveryScope(input.Discovery); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	isApp := input.AppID != 0 && input.PrivateKey != ""
+	if input.Token == "" && !isApp {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(400)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Token required"})
 		return
 	}
 
-	client := NewGitHubClient(input.Token)
+	var client connectionClient
+	var app *GitHubAppAuth
+	switch input.Provider {
+	case "", "github":
+		input.Provider = "github"
+		if input.BaseURL == "" {
+			input.BaseURL = envGitHubAPIURL
+		}
+		if input.BaseURL != "" {
+			input.BaseURL = normalizeGitHubAPIURL(input.BaseURL)
+		}
+		if !isApp {
+			client = NewGitHubClient(input.BaseURL, input.Token)
+			break
+		}
+		var err error
+		if app, err = NewGitHubAppAuth(input.BaseURL, input.AppID, []byte(input.PrivateKey)); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid app credentials: " + err.Error()})
+			return
+		}
+		client = NewGitHubAppClient(app)
+	case "gitlab":
+		if input.BaseURL == "" {
+			input.BaseURL = defaultGitLabBaseURL
+		}
+		client = NewGitLabClient(input.BaseURL, input.Token)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unsupported provider: " + input.Provider})
+		return
+	}
+
+	connectAccount(w, r, client, connectionCredentials{token: input.Token, app: app}, input.Provider, input.BaseURL, input.Discovery)
+}
 
-	// Validate token
-	user, err := client.GetAuthenticatedUser()
+// connectionClient is the discovery surface every provider exposes
+type connectionClient interface {
+	GetAuthenticatedUser(ctx context.Context) (*GitHubUser, error)
+	ListUserRepos(ctx context.Context) ([]GitHubRepoListing, error)
+	ListOrgRepos(ctx context.Context, org string) ([]GitHubRepoListing, error)
+	ListTeamRepos(ctx context.Context, org, team string) ([]GitHubRepoListing, error)
+}
+
+// connectionCredentials is what a connection authenticates with
+type connectionCredentials struct {
+	token string              // Personal or GitLab access token
+	app   *GitHubAppAuth      // GitHub App installation tokens
+	oauth *GitHubOAuthSession // User token from the OAuth device flow
+}
+
+// connectAccount validates client's credentials, registers them as a
+// connection alongside any existing ones and discovers the account's
+// repositories, answering the request with the new connection
+func connectAccount(w http.ResponseWriter, r *http.Request, client connectionClient, creds connectionCredentials, provider, baseURL string, scope DiscoveryScope) {
+	info, status, err := registerAccount(r.Context(), client, creds, provider, baseURL, scope)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(401)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid token: " + err.Error()})
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
-	// Store token in memory
-	githubToken = input.Token
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"connection": info,
+		"repoCount":  info.RepoCount,
+	})
+}
+
+// registerAccount validates client's credentials, discovers the repos scope
+// picks and registers the connection with them. On failure it also returns
+// the HTTP status describing it: 401 for rejected credentials, 500 otherwise.
+func registerAccount(ctx context.Context, client connectionClient, creds connectionCredentials, provider, baseURL string, scope DiscoveryScope) (*GitHubConnection, int, error) {
+	// Validate token
+	user, err := client.GetAuthenticatedUser(ctx)
+	if err != nil {
+		return nil, 401, fmt.Errorf("Invalid token: %w", err)
+	}
 
 	// Discover repos
-	repos, err := client.ListUserRepos()
+	discovered, err := discoverRepos(ctx, client, scope)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(500)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to list repos: " + err.Error()})
-		return
+		return nil, 500, fmt.Errorf("Failed to list repos: %w", err)
 	}
 
-	// Convert to our type
-	var discovered []DiscoveredRepo
-	for _, r := range repos {
-		discovered = append(discovered, DiscoveredRepo{
-			ID:            r.ID,
-			FullName:      r.FullName,
-			Name:          r.Name,
-			Owner:         r.Owner.Login,
-			Description:   r.Description,
-			DefaultBranch: r.DefaultBranch,
-			Language:      r.Language,
-			Stars:         r.StargazersCount,
-			Forks:         r.ForksCount,
-			Private:       r.Private,
-			UpdatedAt:     r.UpdatedAt,
-			AnalysisState: "none",
-		})
+	// Store credentials in memory, next to the other connections
+	conn := &liveConnection{
+		id:       connectionID(provider, baseURL, user.Login),
+		provider: provider,
+		baseURL:  baseURL,
+		creds:    creds,
 	}
+	registerConnection(conn)
 
-	// Update state
-	stateLock.Lock()
-	state.Connection = &GitHubConnection{
+	info := &GitHubConnection{
+		ID:           conn.id,
 		IsConnected:  true,
 		Username:     user.Login,
 		AvatarURL:    user.AvatarURL,
 		Name:         user.Name,
-		Organization: input.Organization,
+		Organization: scope.Organization,
 		ConnectedAt:  time.Now(),
-		RepoCount:    len(discovered),
+		Provider:     provider,
+		BaseURL:      baseURL,
+		Discovery:    scope,
 	}
-	state.DiscoveredRepos = discovered
-	state.Analyses = make(map[string]*RepoAnalysis)
+
+	// Update state
+	stateLock.Lock()
+	addConnectionUnsafe(info, discovered)
 	saveStateUnsafe()
 	stateLock.Unlock()
 
-	log.Printf("[GitHub] Connected as %s, discovered %d repos", user.Login, len(discovered))
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":    true,
-		"connection": state.Connection,
-		"repoCount":  len(discovered),
-	})
+	log.Printf("[%s] Connected as %s (%s), discovered %d repos", provider, user.Login, conn.id, len(discovered))
+	return info, 0, nil
 }
 
+// githubDisconnect removes the connection named by {"connectionId": ...}, or
+// every connection when the body names none
 func githubDisconnect(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
 
-	githubToken = ""
+	var input struct {
+		ConnectionID string `json:"connectionId"`
+	}
+	json.NewDecoder(r.Body).Decode(&input)
+
+	resetAnalysisStates()
+
+	if input.ConnectionID != "" {
+		stateLock.Lock()
+		removeConnectionUnsafe(input.ConnectionID)
+		saveStateUnsafe()
+		stateLock.Unlock()
+
+		log.Printf("[Connections] Disconnected %s", input.ConnectionID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+		return
+	}
+
+	connectionsLock.Lock()
+	connections = make(map[string]*liveConnection)
+	envConnection = nil
+	connectionsLock.Unlock()
+	resetRateBudgets()
 
 	stateLock.Lock()
 	state = AppState{
@@ -4938,32 +12010,191 @@ func githubDisconnect(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
 
+// githubRediscover lists a connection's repos again without disconnecting it.
+// Body: {"connectionId": ..., "discovery": {...}}; a given discovery scope
+// replaces the stored one, and the connection ID defaults to the most recent.
+func githubRediscover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var input struct {
+		ConnectionID string          `json:"connectionId"`
+		Discovery    *DiscoveryScope `json:"discovery"`
+	}
+	json.NewDecoder(r.Body).Decode(&input)
+
+	stateLock.RLock()
+	var info GitHubConnection
+	found := false
+	for _, conn := range state.Connections {
+		if conn.ID == input.ConnectionID || (input.ConnectionID == "" && conn == state.Connection) {
+			info, found = *conn, true
+			break
+		}
+	}
+	stateLock.RUnlock()
+
+	connectionsLock.RLock()
+	live := connections[info.ID]
+	connectionsLock.RUnlock()
+
+	if !found || live == nil {
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unknown connection"})
+		return
+	}
+
+	if live.provider == "local" {
+		if err := connectLocalRepositories(r.Context()); err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to list repos: " + err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+		return
+	}
+
+	if input.Discovery != nil {
+		info.Discovery = *input.Discovery
+		info.Organization = input.Discovery.Organization
+	}
+	if err := validateDiscoveryScope(info.Discovery); err != nil {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	client, ok := live.dataSource().(connectionClient)
+	if !ok {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Connection does not support discovery"})
+		return
+	}
+	discovered, err := discoverRepos(r.Context(), client, info.Discovery)
+	if err != nil {
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to list repos: " + err.Error()})
+		return
+	}
+
+	stateLock.Lock()
+	addConnectionUnsafe(&info, discovered)
+	saveStateUnsafe()
+	stateLock.Unlock()
+
+	log.Printf("[Discovery] Rediscovered %s: %d repos", info.ID, info.RepoCount)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"connection": &info,
+		"repoCount":  info.RepoCount,
+	})
+}
+
+// githubStatus describes the most recent connection at the top level, as
+// before multiple connections, and lists all of them under "connections"
+// githubStatus reports the accounts with live credentials. Accounts restored
+// from state.json stay listed in the state until they reconnect, but are not
+// connected.
 func githubStatus(w http.ResponseWriter, r *http.Request) {
 	stateLock.RLock()
-	conn := state.Connection
+	var conn *GitHubConnection
+	all := make([]*GitHubConnection, 0, len(state.Connections))
+	for _, c := range state.Connections {
+		if !isLiveConnection(c.ID) {
+			continue
+		}
+		all = append(all, c)
+		if state.Connection != nil && c.ID == state.Connection.ID {
+			conn = c
+		}
+	}
 	stateLock.RUnlock()
+	if conn == nil && len(all) > 0 {
+		conn = all[len(all)-1]
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if conn == nil || !conn.IsConnected {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"isConnected": false,
+			"connections": []*GitHubConnection{},
 		})
 		return
 	}
 
-	json.NewEncoder(w).Encode(conn)
+	json.NewEncoder(w).Encode(struct {
+		*GitHubConnection
+		Connections []*GitHubConnection `json:"connections"`
+	}{conn, all})
+}
+
+// githubRateLimit reports the remaining API budget so the UI can warn before
+// starting a deep analysis
+func githubRateLimit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	hasGitHub := false
+	for _, conn := range liveConnections() {
+		if conn.provider != "github" {
+			continue
+		}
+		hasGitHub = true
+		if conn.creds.app != nil {
+			continue
+		}
+		if client, ok := conn.dataSource().(*GitHubClient); ok {
+			if err := client.RefreshRateLimit(r.Context()); err != nil {
+				log.Printf("[GitHub API] Rate limit refresh for %s failed: %v", conn.id, err)
+			}
+		}
+	}
+	if !hasGitHub {
+		json.NewEncoder(w).Encode(map[string]interface{}{"available": false, "reason": "Rate limits only apply to the GitHub API"})
+		return
+	}
+
+	budgets := snapshotRateBudgets()
+	if len(budgets) == 0 || !budgets[0].Known {
+		json.NewEncoder(w).Encode(map[string]interface{}{"available": false, "reason": "No rate limit information yet", "budgets": budgets})
+		return
+	}
+
+	lowest := budgets[0]
+	cost := deepAnalysisCost(currentAnalysisWindow())
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"available":                 true,
+		"remaining":                 lowest.Remaining,
+		"limit":                     lowest.Limit,
+		"resetAt":                   lowest.ResetAt,
+		"deepAnalysisCost":          cost,
+		"sufficientForDeepAnalysis": lowest.Remaining >= cost,
+		"budgets":                   budgets,
+	})
 }
 
 // Projects
+
+// listProjects returns the repos of every connection, each tagged with its
+// connectionId; ?connection= narrows the list to one connection
 func listProjects(w http.ResponseWriter, r *http.Request) {
+	connection := r.URL.Query().Get("connection")
+
 	stateLock.RLock()
-	repos := state.DiscoveredRepos
+	repos := make([]DiscoveredRepo, 0, len(state.DiscoveredRepos))
+	for _, repo := range state.DiscoveredRepos {
+		if connection == "" || repo.ConnectionID == connection {
+			repos = append(repos, repo)
+		}
+	}
 	analyses := state.Analyses
 	stateLock.RUnlock()
 
 	// Update analysis states
 	for i := range repos {
-		if _, ok := analyses[repos[i].FullName]; ok {
+		if _, ok := analyses[repoKey(&repos[i])]; ok {
 			repos[i].AnalysisState = "ready"
 		}
 	}
@@ -4981,45 +12212,37 @@ func analyzeProject(w http.ResponseWriter, r *http.Request) {
 	// Parse path: /api/projects/{owner}/{repo}/analyze
 	path := strings.TrimPrefix(r.URL.Path, "/api/projects/")
 	path = strings.TrimSuffix(path, "/analyze")
-	parts := strings.Split(path, "/")
-	if len(parts) != 2 {
+	owner, repo, ok := splitFullName(path)
+	if !ok {
 		http.Error(w, "Invalid path", 400)
 		return
 	}
-	owner, repo := parts[0], parts[1]
-	fullName := owner + "/" + repo
-
-	if githubToken == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(401)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Not connected to GitHub"})
-		return
-	}
 
-	// Find repo in discovered
+	// Find repo in discovered; ?connection= picks one of several listings
 	stateLock.RLock()
-	var foundRepo *DiscoveredRepo
-	for i := range state.DiscoveredRepos {
-		if state.DiscoveredRepos[i].FullName == fullName {
-			foundRepo = &state.DiscoveredRepos[i]
-			break
-		}
-	}
+	foundRepo, err := findRepoUnsafe(projectKeyParam(r, owner+"/"+repo))
 	stateLock.RUnlock()
 
 	if foundRepo == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(404)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Project not found"})
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
 	// LIGHTWEIGHT INITIAL LOAD: Only set selection and fetch basic metadata
 	// Deep analyses are loaded on-demand per page navigation
-	client := NewGitHubClient(githubToken)
+	ctx := r.Context()
+	client, err := newRepoDataSource(foundRepo)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(401)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
 
 	// Fetch only shallow metadata (fast)
-	repoData, err := client.GetRepository(owner, repo)
+	repoData, err := client.GetRepository(ctx, owner, repo)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(500)
@@ -5032,7 +12255,7 @@ func analyzeProject(w http.ResponseWriter, r *http.Request) {
 	if branch == "" {
 		branch = "main"
 	}
-	tree, _ := client.GetFileTree(owner, repo, branch)
+	tree, _ := client.GetFileTree(ctx, owner, repo, branch)
 	fileCount := 0
 	dirCount := 0
 	if tree != nil {
@@ -5058,9 +12281,9 @@ func analyzeProject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	stateLock.Lock()
-	state.SelectedProject = fullName
+	state.SelectedProject = repoKey(foundRepo)
 	for i := range state.DiscoveredRepos {
-		if state.DiscoveredRepos[i].FullName == fullName {
+		if repoKey(&state.DiscoveredRepos[i]) == state.SelectedProject {
 			state.DiscoveredRepos[i].AnalysisState = "selected"
 			break
 		}
@@ -5076,99 +12299,136 @@ func analyzeProject(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func refreshAnalysis(w http.ResponseWriter, r *http.Request) {
+// analysisWindowSetting reads (GET) or replaces (POST) the commit window used by
+// the history-based analyzers. Changing it invalidates every cached analysis.
+func analysisWindowSetting(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w)
 	if r.Method == "OPTIONS" {
 		return
 	}
-	if r.Method != "POST" {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var input AnalysisWindow
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Days < 0 || input.MaxCommits < 0 {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Expected {\"days\": N, \"maxCommits\": N} with non-negative values"})
+			return
+		}
+		if input.MaxCommits > maxWindowCommits {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("maxCommits can be at most %d", maxWindowCommits)})
+			return
+		}
+
+		stateLock.Lock()
+		state.AnalysisWindow = &input
+		saveStateUnsafe()
+		stateLock.Unlock()
+
+		analysisCache.InvalidateAll()
+		log.Printf("[Analysis] Window set to %s", input.Label())
+	default:
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
 
-	stateLock.RLock()
-	selected := state.SelectedProject
-	stateLock.RUnlock()
+	window := currentAnalysisWindow()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window":  window,
+		"label":   window.Label(),
+		"default": defaultAnalysisWindow,
+	})
+}
 
-	if selected == "" {
-		http.Error(w, "No project selected", 400)
+func refreshAnalysis(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", 405)
 		return
 	}
 
-	parts := strings.Split(selected, "/")
-	owner, repo := parts[0], parts[1]
-
-	// Find the repo to get the default branch
-	stateLock.RLock()
-	var foundRepo *DiscoveredRepo
-	for i := range state.DiscoveredRepos {
-		if state.DiscoveredRepos[i].FullName == selected {
-			foundRepo = &state.DiscoveredRepos[i]
-			break
-		}
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
 	}
-	stateLock.RUnlock()
+	selected := foundRepo.FullName
 
-	defaultBranch := "main"
-	if foundRepo != nil && foundRepo.DefaultBranch != "" {
-		defaultBranch = foundRepo.DefaultBranch
+	ctx, cancel := sectionContext(r, "refresh")
+	defer cancel()
+	client, target, err := resolveRepoRef(ctx, foundRepo, owner, repo, branch)
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
 	}
+	projectKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
+	snapshot := analysisRunSnapshot(projectKey, client, target, true)
+	client = snapshot
 
 	// Re-run analysis
-	client := NewGitHubClient(githubToken)
-	log.Printf("[Refresh] Refreshing analysis for %s", selected)
-	analysis, err := analyzeRepository(client, owner, repo, defaultBranch)
+	log.Printf("[Refresh] Refreshing analysis for %s at %s", selected, target.Name)
+	start := time.Now()
+	analysis, err := analyzeRepository(ctx, client, owner, repo, target, snapshot.window)
 	if err != nil {
 		http.Error(w, "Analysis failed: "+err.Error(), 500)
 		return
 	}
 
-	stateLock.Lock()
-	state.Analyses[selected] = analysis
-	// Find project and set it to ready
-	for i := range state.DiscoveredRepos {
-		if state.DiscoveredRepos[i].FullName == selected {
-			state.DiscoveredRepos[i].AnalysisState = "ready"
-			break
-		}
-	}
-	saveState()
-	stateLock.Unlock()
-
 	// Return the same format as getSelectedProject expects
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	response := map[string]interface{}{
 		"selected": true,
 		"project":  map[string]interface{}{"fullName": selected}, // Minimal for now to match frontend mapping
 		"analysis": analysis,
-	})
+	}
+	if !finishSection(ctx, r, "refresh", projectKey, response, false) {
+		return
+	}
+
+	// A timed-out run is returned but not stored over a complete analysis
+	if response["partial"] == nil {
+		stateLock.Lock()
+		state.Analyses[projectKey] = analysis
+		// Find project and set it to ready
+		for i := range state.DiscoveredRepos {
+			if repoKey(&state.DiscoveredRepos[i]) == repoKey(foundRepo) {
+				state.DiscoveredRepos[i].AnalysisState = "ready"
+				break
+			}
+		}
+		saveStateUnsafe()
+		stateLock.Unlock()
+
+		completeAnalysisRun(projectKey, snapshot, analysis, time.Since(start))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 func getProject(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/projects/")
-	parts := strings.Split(path, "/")
-	if len(parts) != 2 {
+	owner, repo, ok := splitFullName(path)
+	if !ok {
 		http.Error(w, "Invalid path", 400)
 		return
 	}
-	owner, repo := parts[0], parts[1]
-	fullName := owner + "/" + repo
 
 	stateLock.RLock()
-	var foundRepo *DiscoveredRepo
-	for i := range state.DiscoveredRepos {
-		if state.DiscoveredRepos[i].FullName == fullName {
-			foundRepo = &state.DiscoveredRepos[i]
-			break
-		}
-	}
-	analysis := state.Analyses[fullName]
+	foundRepo, err := findRepoUnsafe(projectKeyParam(r, owner+"/"+repo))
+	analysis := storedAnalysisUnsafe(foundRepo, "")
 	stateLock.RUnlock()
 
 	if foundRepo == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(404)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Project not found"})
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
@@ -5186,13 +12446,27 @@ func selectProject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input struct {
-		FullName string `json:"fullName"`
+		FullName     string `json:"fullName"`
+		ConnectionID string `json:"connectionId"` // Needed when several connections list FullName
 	}
 	body, _ := io.ReadAll(r.Body)
 	json.Unmarshal(body, &input)
 
+	key := input.FullName
+	if input.ConnectionID != "" {
+		key = input.ConnectionID + "/" + input.FullName
+	}
+
 	stateLock.Lock()
-	state.SelectedProject = input.FullName
+	repo, err := findRepoUnsafe(key)
+	if err != nil {
+		stateLock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	state.SelectedProject = repoKey(repo)
 	saveStateUnsafe()
 	stateLock.Unlock()
 
@@ -5200,17 +12474,10 @@ func selectProject(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
 
-func getSelectedProject(w http.ResponseWriter, _ *http.Request) {
+func getSelectedProject(w http.ResponseWriter, r *http.Request) {
 	stateLock.RLock()
-	selected := state.SelectedProject
-	var foundRepo *DiscoveredRepo
-	for i := range state.DiscoveredRepos {
-		if state.DiscoveredRepos[i].FullName == selected {
-			foundRepo = &state.DiscoveredRepos[i]
-			break
-		}
-	}
-	analysis := state.Analyses[selected]
+	foundRepo, _ := findRepoUnsafe(state.SelectedProject)
+	analysis := storedAnalysisUnsafe(foundRepo, r.URL.Query().Get("ref"))
 	stateLock.RUnlock()
 
 	if foundRepo == nil {
@@ -5237,28 +12504,95 @@ func getSelectedProject(w http.ResponseWriter, _ *http.Request) {
 // These endpoints compute analysis on-demand for each page navigation
 // Per the Page-Scoped Data Loading mandate, each page fetches only what it needs
 
-func getSelectedProjectContext() (string, string, string, *DiscoveredRepo, error) {
-	stateLock.RLock()
-	selected := state.SelectedProject
-	var foundRepo *DiscoveredRepo
-	for i := range state.DiscoveredRepos {
-		if state.DiscoveredRepos[i].FullName == selected {
-			foundRepo = &state.DiscoveredRepos[i]
-			break
-		}
+// getSelectedProjectContext returns the selected project and the ref to analyze:
+// the request's ?ref= when given, otherwise the default branch
+func getSelectedProjectContext(r *http.Request) (string, string, string, *DiscoveredRepo, error) {
+	ref, err := requestedRef(r)
+	if err != nil {
+		return "", "", "", nil, err
 	}
+
+	stateLock.RLock()
+	foundRepo, _ := findRepoUnsafe(state.SelectedProject)
 	stateLock.RUnlock()
 
-	if selected == "" || foundRepo == nil {
+	if foundRepo == nil {
 		return "", "", "", nil, fmt.Errorf("no project selected")
 	}
+	if !isDataSourceConfigured(foundRepo) {
+		return "", "", "", nil, fmt.Errorf("not connected: reconnect %s to read %s", foundRepo.ConnectionID, foundRepo.FullName)
+	}
 
-	parts := strings.Split(selected, "/")
-	if len(parts) != 2 {
+	owner, name, ok := splitFullName(foundRepo.FullName)
+	if !ok {
 		return "", "", "", nil, fmt.Errorf("invalid project name")
 	}
 
-	return parts[0], parts[1], foundRepo.DefaultBranch, foundRepo, nil
+	if ref == "" {
+		ref = foundRepo.DefaultBranch
+	}
+	return owner, name, ref, foundRepo, nil
+}
+
+// sectionDeadlines bounds how long each analysis section may spend fetching.
+// When a deadline fires, in-flight requests are cancelled and the section
+// answers with whatever its analyzers computed so far.
+var sectionDeadlines = map[string]time.Duration{
+	"dashboard":     60 * time.Second,
+	"trajectory":    45 * time.Second,
+	"dependencies":  60 * time.Second,
+	"concentration": 90 * time.Second,
+	"temporal":      60 * time.Second,
+	"reviews":       90 * time.Second,
+	"impact":        30 * time.Second,
+	"predictions":   2 * time.Minute,
+	"busFactor":     90 * time.Second,
+	"tree":          30 * time.Second,
+	"topology":      30 * time.Second,
+	"refresh":       5 * time.Minute,
+}
+
+const defaultSectionDeadline = 60 * time.Second
+
+func sectionDeadline(section string) time.Duration {
+	if deadline, ok := sectionDeadlines[section]; ok {
+		return deadline
+	}
+	return defaultSectionDeadline
+}
+
+// sectionContext derives the context a section runs under: it ends when the
+// client disconnects or the section's deadline passes
+func sectionContext(r *http.Request, section string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), sectionDeadline(section))
+}
+
+// PartialResult marks a section response cut short by its deadline
+type PartialResult struct {
+	Reason   string `json:"reason"` // "timed_out"
+	Section  string `json:"section"`
+	Deadline string `json:"deadline"` // e.g. "1m30s"
+}
+
+// finishSection inspects ctx once a section's analyzers have returned. If the
+// deadline fired, response is marked partial and not cached; a complete
+// response is cached when cache is set. It returns false when the client has
+// gone away and nothing should be written.
+func finishSection(ctx context.Context, r *http.Request, section, projectKey string, response map[string]interface{}, cache bool) bool {
+	if r.Context().Err() != nil {
+		log.Printf("[Analysis] Client went away, abandoning %s for %s", section, projectKey)
+		return false
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		deadline := sectionDeadline(section)
+		log.Printf("[Analysis] %s for %s timed out after %v, returning partial results", section, projectKey, deadline)
+		response["partial"] = &PartialResult{Reason: "timed_out", Section: section, Deadline: deadline.String()}
+		return true
+	}
+	if cache {
+		analysisCache.Set(section, projectKey, response, CacheTTL)
+	}
+	return true
 }
 
 func analysisDashboard(w http.ResponseWriter, r *http.Request) {
@@ -5267,7 +12601,7 @@ func analysisDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	owner, repo, branch, foundRepo, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(400)
@@ -5275,7 +12609,7 @@ func analysisDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectKey := owner + "/" + repo
+	projectKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Check for If-Modified-Since header for polling support
 	ifModifiedSince := r.Header.Get("If-Modified-Since")
@@ -5299,14 +12633,26 @@ func analysisDashboard(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("[Dashboard] Cache MISS - Computing dashboard analysis for %s", projectKey)
-	client := NewGitHubClient(githubToken)
+	ctx, cancel := sectionContext(r, "dashboard")
+	defer cancel()
+	client, target, err := resolveRepoRef(ctx, foundRepo, owner, repo, branch)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	snapshot := analysisRunSnapshot(projectKey, client, target, false)
+	client = snapshot
+	branch = target.Name
+	window := snapshot.window
 
 	// Dashboard needs: repo metadata, commits, activity heatmap, basic file stats
-	repoData, _ := client.GetRepository(owner, repo)
-	commits, _ := client.GetCommits(owner, repo, 100)
-	activity, _ := client.GetCommitActivity(owner, repo)
-	tree, _ := client.GetFileTree(owner, repo, branch)
-	contributors, _ := client.GetContributors(owner, repo)
+	repoData, _ := client.GetRepository(ctx, owner, repo)
+	commits, _ := client.GetCommits(ctx, owner, repo, 100)
+	activity, _ := client.GetCommitActivity(ctx, owner, repo)
+	tree, _ := client.GetFileTree(ctx, owner, repo, branch)
+	contributors, _ := client.GetContributors(ctx, owner, repo)
 
 	// Basic file stats
 	fileCount := 0
@@ -5371,13 +12717,15 @@ func analysisDashboard(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Additional dashboard analyses (light versions)
-	docDrift := analyzeDocDrift(client, owner, repo)
-	structuralDepth := analyzeStructuralDepth(tree.Tree)
-	testSurface := analyzeTestSurface(tree.Tree, nil)
+	docDrift := analyzeDocDrift(ctx, client, owner, repo, window)
+	_, structureTree := detectSubmodules(ctx, client, owner, repo, tree)
+	structuralDepth := analyzeStructuralDepth(structureTree)
+	testSurface := analyzeTestSurface(tree, nil)
 	volatility := analyzeActivityVolatility(commits)
-	securityAnalysis := analyzeSecurityConsistency(client, owner, repo, tree.Tree, nil)
+	securityAnalysis := analyzeSecurityConsistency(ctx, client, owner, repo, treeNodes(tree), nil)
 
 	analysis := &RepoAnalysis{
+		Ref:               target,
 		FetchedAt:         now,
 		TotalCommits:      len(commits),
 		CommitsLast30Days: commitsLast30,
@@ -5403,11 +12751,14 @@ func analysisDashboard(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"selected": true,
 		"project":  foundRepo,
+		"ref":      target,
 		"analysis": analysis,
 	}
 
-	// Cache the response
-	analysisCache.Set("dashboard", projectKey, response, CacheTTL)
+	// Cache the response unless the deadline cut it short
+	if !finishSection(ctx, r, "dashboard", projectKey, response, true) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -5419,7 +12770,7 @@ func analysisTrajectory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	owner, repo, _, foundRepo, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(400)
@@ -5427,7 +12778,7 @@ func analysisTrajectory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectKey := owner + "/" + repo
+	projectKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Check cache first
 	if cached, ok := analysisCache.Get("trajectory", projectKey); ok {
@@ -5438,18 +12789,32 @@ func analysisTrajectory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("[Trajectory] Cache MISS - Computing trajectory analysis for %s", projectKey)
-	client := NewGitHubClient(githubToken)
-	trajectory := analyzeTrajectory(client, owner, repo)
+	ctx, cancel := sectionContext(r, "trajectory")
+	defer cancel()
+	client, target, err := resolveRepoRef(ctx, foundRepo, owner, repo, branch)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	snapshot := analysisRunSnapshot(projectKey, client, target, false)
+	client = snapshot
+	tree, _ := client.GetFileTree(ctx, owner, repo, target.Name)
+	trajectory := analyzeTrajectory(ctx, client, owner, repo, tree)
 
 	response := map[string]interface{}{
 		"selected": true,
 		"project":  foundRepo,
+		"ref":      target,
 		"analysis": map[string]interface{}{
 			"trajectory": trajectory,
 		},
 	}
 
-	analysisCache.Set("trajectory", projectKey, response, CacheTTL)
+	if !finishSection(ctx, r, "trajectory", projectKey, response, true) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -5461,7 +12826,7 @@ func analysisDependencies(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	owner, repo, branch, foundRepo, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(400)
@@ -5469,7 +12834,7 @@ func analysisDependencies(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectKey := owner + "/" + repo
+	projectKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Check cache first
 	if cached, ok := analysisCache.Get("dependencies", projectKey); ok {
@@ -5480,24 +12845,38 @@ func analysisDependencies(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("[Dependencies] Cache MISS - Computing dependency analysis for %s", projectKey)
-	client := NewGitHubClient(githubToken)
-	tree, _ := client.GetFileTree(owner, repo, branch)
-	deps := analyzeDependencies(client, owner, repo, tree, nil)
+	ctx, cancel := sectionContext(r, "dependencies")
+	defer cancel()
+	client, target, err := resolveRepoRef(ctx, foundRepo, owner, repo, branch)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	snapshot := analysisRunSnapshot(projectKey, client, target, false)
+	client = snapshot
+	branch = target.Name
+	tree, _ := client.GetFileTree(ctx, owner, repo, branch)
+	deps := analyzeDependencies(ctx, client, owner, repo, tree, nil)
 
 	// Parse manifest dependencies with version health
-	manifestDeps := parseManifestsFull(client, owner, repo, tree)
+	manifestDeps := parseManifestsFull(ctx, client, owner, repo, tree)
 	log.Printf("[Dependencies] Found %d manifest dependencies", len(manifestDeps))
 
 	response := map[string]interface{}{
 		"selected": true,
 		"project":  foundRepo,
+		"ref":      target,
 		"analysis": map[string]interface{}{
 			"deps":                 deps,
 			"manifestDependencies": manifestDeps,
 		},
 	}
 
-	analysisCache.Set("dependencies", projectKey, response, CacheTTL)
+	if !finishSection(ctx, r, "dependencies", projectKey, response, true) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -5509,7 +12888,7 @@ func analysisConcentration(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	owner, repo, branch, foundRepo, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(400)
@@ -5517,7 +12896,7 @@ func analysisConcentration(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectKey := owner + "/" + repo
+	projectKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Check cache first
 	if cached, ok := analysisCache.Get("concentration", projectKey); ok {
@@ -5528,19 +12907,31 @@ func analysisConcentration(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("[Concentration] Cache MISS - Computing concentration analysis for %s", projectKey)
-	client := NewGitHubClient(githubToken)
+	ctx, cancel := sectionContext(r, "concentration")
+	defer cancel()
+	client, target, err := resolveRepoRef(ctx, foundRepo, owner, repo, branch)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	snapshot := analysisRunSnapshot(projectKey, client, target, false)
+	client = snapshot
+	branch = target.Name
+	window := snapshot.window
 
 	// Fetch tree for dependency analysis (needed for bus factor)
-	tree, _ := client.GetFileTree(owner, repo, branch)
+	tree, _ := client.GetFileTree(ctx, owner, repo, branch)
 
 	// Compute concentration
-	concentration := analyzeConcentration(client, owner, repo)
+	concentration := analyzeConcentration(ctx, client, owner, repo, window)
 
 	// Compute dependencies (needed for bus factor context)
-	deps := analyzeDependencies(client, owner, repo, tree, concentration)
+	deps := analyzeDependencies(ctx, client, owner, repo, tree, concentration)
 
 	// Compute bus factor and embed into concentration
-	busFactor := analyzeBusFactor(client, owner, repo, deps, concentration)
+	busFactor := analyzeBusFactor(ctx, client, owner, repo, window, deps, concentration)
 	if concentration != nil {
 		concentration.OwnershipRisk = busFactor
 	}
@@ -5548,12 +12939,15 @@ func analysisConcentration(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"selected": true,
 		"project":  foundRepo,
+		"ref":      target,
 		"analysis": map[string]interface{}{
 			"concentration": concentration,
 		},
 	}
 
-	analysisCache.Set("concentration", projectKey, response, CacheTTL)
+	if !finishSection(ctx, r, "concentration", projectKey, response, true) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -5565,7 +12959,7 @@ func analysisTemporal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	owner, repo, _, foundRepo, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(400)
@@ -5573,7 +12967,7 @@ func analysisTemporal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectKey := owner + "/" + repo
+	projectKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Check cache first
 	if cached, ok := analysisCache.Get("temporal", projectKey); ok {
@@ -5584,30 +12978,126 @@ func analysisTemporal(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("[Temporal] Cache MISS - Computing temporal analysis for %s", projectKey)
-	client := NewGitHubClient(githubToken)
-	temporal := analyzeTemporal(client, owner, repo)
+	ctx, cancel := sectionContext(r, "temporal")
+	defer cancel()
+	client, target, err := resolveRepoRef(ctx, foundRepo, owner, repo, branch)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	snapshot := analysisRunSnapshot(projectKey, client, target, false)
+	client = snapshot
+	window := snapshot.window
+	temporal := analyzeTemporal(ctx, client, owner, repo, window)
 
 	response := map[string]interface{}{
 		"selected": true,
 		"project":  foundRepo,
+		"ref":      target,
 		"analysis": map[string]interface{}{
 			"temporal": temporal,
 		},
 	}
 
-	analysisCache.Set("temporal", projectKey, response, CacheTTL)
+	if !finishSection(ctx, r, "temporal", projectKey, response, true) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func analysisReviews(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	projectKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
+
+	// Check cache first
+	if cached, ok := analysisCache.Get("reviews", projectKey); ok {
+		log.Printf("[Reviews] Cache HIT for %s", projectKey)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cached)
+		return
+	}
+
+	log.Printf("[Reviews] Cache MISS - Computing review flow analysis for %s", projectKey)
+	ctx, cancel := sectionContext(r, "reviews")
+	defer cancel()
+	client, target, err := resolveRepoRef(ctx, foundRepo, owner, repo, branch)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	snapshot := analysisRunSnapshot(projectKey, client, target, false)
+	client = snapshot
+	window := snapshot.window
+
+	// Off the default branch, only PRs targeting the analyzed branch count
+	base := ""
+	if !target.IsDefault {
+		base = target.Name
+	}
+	reviews := analyzeReviews(ctx, client, owner, repo, base, window)
+
+	response := reviewsResponse(foundRepo, target, reviews)
+	if !finishSection(ctx, r, "reviews", projectKey, response, true) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// reviewsResponse is the review flow section's response, as cached under "reviews"
+func reviewsResponse(project *DiscoveredRepo, target *AnalysisRef, reviews *ReviewAnalysis) map[string]interface{} {
+	return map[string]interface{}{
+		"selected": true,
+		"project":  project,
+		"ref":      target,
+		"analysis": map[string]interface{}{
+			"reviews": reviews,
+		},
+	}
+}
+
+// cachedReviews returns the review analysis cached by the review flow section
+func cachedReviews(projectKey string) *ReviewAnalysis {
+	cached, ok := analysisCache.Get("reviews", projectKey)
+	if !ok {
+		return nil
+	}
+	if resp, ok := cached.(map[string]interface{}); ok {
+		if analysisRaw, ok := resp["analysis"].(map[string]interface{}); ok {
+			if reviews, ok := analysisRaw["reviews"].(*ReviewAnalysis); ok {
+				return reviews
+			}
+		}
+	}
+	return nil
+}
+
 func analysisImpact(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w)
 	if r.Method == "OPTIONS" {
 		return
 	}
 
-	owner, repo, branch, foundRepo, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(400)
@@ -5615,7 +13105,7 @@ func analysisImpact(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectKey := owner + "/" + repo
+	projectKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Check cache first
 	if cached, ok := analysisCache.Get("impact", projectKey); ok {
@@ -5626,20 +13116,36 @@ func analysisImpact(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("[Impact] Cache MISS - Computing impact analysis for %s", projectKey)
-	client := NewGitHubClient(githubToken)
-	tree, _ := client.GetFileTree(owner, repo, branch)
-	topology := analyzeTopology(tree)
-	impact := analyzeImpact(topology, tree)
+	ctx, cancel := sectionContext(r, "impact")
+	defer cancel()
+	client, target, err := resolveRepoRef(ctx, foundRepo, owner, repo, branch)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	snapshot := analysisRunSnapshot(projectKey, client, target, false)
+	client = snapshot
+	branch = target.Name
+	tree, _ := client.GetFileTree(ctx, owner, repo, branch)
+	submodules, structureTree := detectSubmodules(ctx, client, owner, repo, tree)
+	graph := buildImportGraph(ctx, client, owner, repo, structureTree, submodules)
+	topology := analyzeTopology(structureTree, submodules, graph)
+	impact := analyzeImpact(topology, structureTree)
 
 	response := map[string]interface{}{
 		"selected": true,
 		"project":  foundRepo,
+		"ref":      target,
 		"analysis": map[string]interface{}{
 			"impact": impact,
 		},
 	}
 
-	analysisCache.Set("impact", projectKey, response, CacheTTL)
+	if !finishSection(ctx, r, "impact", projectKey, response, true) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -5651,7 +13157,7 @@ func analysisPredictions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	owner, repo, branch, foundRepo, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(400)
@@ -5659,10 +13165,22 @@ func analysisPredictions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectKey := owner + "/" + repo
+	projectKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 	log.Printf("[Predictions] Computing predictive analytics for %s", projectKey)
 
-	client := NewGitHubClient(githubToken)
+	ctx, cancel := sectionContext(r, "predictions")
+	defer cancel()
+	client, target, err := resolveRepoRef(ctx, foundRepo, owner, repo, branch)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	snapshot := analysisRunSnapshot(projectKey, client, target, false)
+	client = snapshot
+	branch = target.Name
+	window := snapshot.window
 
 	// Fetch required data for predictions in parallel
 	var wg sync.WaitGroup
@@ -5670,35 +13188,54 @@ func analysisPredictions(w http.ResponseWriter, r *http.Request) {
 	var concentration *ConcentrationAnalysis
 	var deps *DependencyAnalysis
 	var tree *GitHubTreeResponse
+	var reviews *ReviewAnalysis
+
+	base := ""
+	if !target.IsDefault {
+		base = target.Name
+	}
 
 	wg.Add(4)
 	go func() {
 		defer wg.Done()
-		trajectory = analyzeTrajectory(client, owner, repo)
+		// The snapshot shares this tree fetch with the dependency goroutine
+		trajectoryTree, _ := client.GetFileTree(ctx, owner, repo, branch)
+		trajectory = analyzeTrajectory(ctx, client, owner, repo, trajectoryTree)
 	}()
 	go func() {
 		defer wg.Done()
-		concentration = analyzeConcentration(client, owner, repo)
+		concentration = analyzeConcentration(ctx, client, owner, repo, window)
 	}()
 	go func() {
 		defer wg.Done()
-		tree, _ = client.GetFileTree(owner, repo, branch)
-		deps = analyzeDependencies(client, owner, repo, tree, nil)
+		tree, _ = client.GetFileTree(ctx, owner, repo, branch)
+		deps = analyzeDependencies(ctx, client, owner, repo, tree, nil)
 	}()
 	go func() {
 		defer wg.Done()
-		// Placeholder for future parallelization
+		// Review flow costs several calls per PR, so share the section's result
+		if reviews = cachedReviews(projectKey); reviews != nil {
+			return
+		}
+		reviews = analyzeReviews(ctx, client, owner, repo, base, window)
+		if ctx.Err() == nil {
+			analysisCache.Set("reviews", projectKey, reviewsResponse(foundRepo, target, reviews), CacheTTL)
+		}
 	}()
 	wg.Wait()
 
 	// Compute predictions
-	predictions := analyzePredictions(client, owner, repo, trajectory, concentration, deps)
+	predictions := analyzePredictions(ctx, client, owner, repo, trajectory, concentration, deps, reviews)
 
 	response := map[string]interface{}{
 		"selected":    true,
 		"project":     foundRepo,
+		"ref":         target,
 		"predictions": predictions,
 	}
+	if !finishSection(ctx, r, "predictions", projectKey, response, false) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -5710,7 +13247,7 @@ func analysisBusFactor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	owner, repo, branch, foundRepo, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(400)
@@ -5719,26 +13256,45 @@ func analysisBusFactor(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("[BusFactor] Computing bus factor analysis for %s/%s", owner, repo)
-	client := NewGitHubClient(githubToken)
-	tree, _ := client.GetFileTree(owner, repo, branch)
-	concentration := analyzeConcentration(client, owner, repo)
-	deps := analyzeDependencies(client, owner, repo, tree, concentration)
-	busFactor := analyzeBusFactor(client, owner, repo, deps, concentration)
+	ctx, cancel := sectionContext(r, "busFactor")
+	defer cancel()
+	client, target, err := resolveRepoRef(ctx, foundRepo, owner, repo, branch)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	projectKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
+	snapshot := analysisRunSnapshot(projectKey, client, target, false)
+	client = snapshot
+	branch = target.Name
+	window := snapshot.window
+	tree, _ := client.GetFileTree(ctx, owner, repo, branch)
+	concentration := analyzeConcentration(ctx, client, owner, repo, window)
+	deps := analyzeDependencies(ctx, client, owner, repo, tree, concentration)
+	busFactor := analyzeBusFactor(ctx, client, owner, repo, window, deps, concentration)
 
 	// Include concentration with ownership risk for frontend
 	if concentration != nil {
 		concentration.OwnershipRisk = busFactor
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	response := map[string]interface{}{
 		"selected": true,
 		"project":  foundRepo,
+		"ref":      target,
 		"analysis": map[string]interface{}{
 			"concentration": concentration,
 			"busFactor":     busFactor,
 		},
-	})
+	}
+	if !finishSection(ctx, r, "busFactor", projectKey, response, false) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 // analysisTree returns the repository file tree structure
@@ -5748,7 +13304,7 @@ func analysisTree(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	owner, repo, branch, foundRepo, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(400)
@@ -5757,14 +13313,27 @@ func analysisTree(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("[Tree] Fetching repository tree for %s/%s", owner, repo)
-	client := NewGitHubClient(githubToken)
-	tree, err := client.GetFileTree(owner, repo, branch)
+	ctx, cancel := sectionContext(r, "tree")
+	defer cancel()
+	client, target, err := resolveRepoRef(ctx, foundRepo, owner, repo, branch)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	projectKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
+	snapshot := analysisRunSnapshot(projectKey, client, target, false)
+	client = snapshot
+	branch = target.Name
+	tree, err := client.GetFileTree(ctx, owner, repo, branch)
 
 	if err != nil || tree == nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"selected": true,
 			"project":  foundRepo,
+			"ref":      target,
 			"analysis": map[string]interface{}{
 				"tree": map[string]interface{}{
 					"available": false,
@@ -5805,6 +13374,7 @@ func analysisTree(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"selected": true,
 		"project":  foundRepo,
+		"ref":      target,
 		"analysis": map[string]interface{}{
 			"tree": map[string]interface{}{
 				"available":  true,
@@ -5812,6 +13382,7 @@ func analysisTree(w http.ResponseWriter, r *http.Request) {
 				"totalFiles": totalFiles,
 				"totalDirs":  totalDirs,
 				"truncated":  tree.Truncated,
+				"confidence": computeStructuralConfidence(tree),
 			},
 		},
 	})
@@ -5830,19 +13401,16 @@ func generatePDF(w http.ResponseWriter, r *http.Request) {
 	projectParam := r.URL.Query().Get("project")
 
 	stateLock.RLock()
-	conn := state.Connection
 	selected := state.SelectedProject
 	if projectParam != "" {
-		selected = projectParam
+		selected = projectKeyParam(r, projectParam)
 	}
-	var repo *DiscoveredRepo
-	for i := range state.DiscoveredRepos {
-		if state.DiscoveredRepos[i].FullName == selected {
-			repo = &state.DiscoveredRepos[i]
-			break
-		}
+	repo, _ := findRepoUnsafe(selected)
+	if repo != nil {
+		selected = repo.FullName
 	}
-	analysis := state.Analyses[selected]
+	conn := repoConnectionUnsafe(repo)
+	analysis := storedAnalysisUnsafe(repo, r.URL.Query().Get("ref"))
 	stateLock.RUnlock()
 
 	pdf := fpdf.New("P", "mm", "A4", "")
@@ -5877,6 +13445,9 @@ func generatePDF(w http.ResponseWriter, r *http.Request) {
 	if subtitle == "" {
 		subtitle = "Repository Analysis Report"
 	}
+	if analysis != nil && analysis.Ref != nil {
+		subtitle += " - " + analysis.Ref.Label()
+	}
 	pdf.SetFont("Helvetica", "", 10)
 	pdf.SetTextColor(130, 130, 130)
 	pdf.Text(15, 30, subtitle)
@@ -6215,9 +13786,13 @@ func generateCSV(w http.ResponseWriter, r *http.Request) {
 	stateLock.RLock()
 	selected := state.SelectedProject
 	if projectParam != "" {
-		selected = projectParam
+		selected = projectKeyParam(r, projectParam)
 	}
-	analysis := state.Analyses[selected]
+	repo, _ := findRepoUnsafe(selected)
+	if repo != nil {
+		selected = repo.FullName
+	}
+	analysis := storedAnalysisUnsafe(repo, r.URL.Query().Get("ref"))
 	stateLock.RUnlock()
 
 	var csv string
@@ -6233,13 +13808,14 @@ func generateCSV(w http.ResponseWriter, r *http.Request) {
 	case "overview":
 		csv = fmt.Sprintf(`Metric,Value
 Repository,%s
+Ref,%s
 Files,%d
 Directories,%d
 Commits (30d),%d
 Activity Score,%.1f
 Contributors,%d
 Dependencies,%d
-`, selected, analysis.FileCount, analysis.DirectoryCount, analysis.CommitsLast30Days, analysis.ActivityScore, analysis.ContributorCount, analysis.DependencyCount)
+`, selected, analysis.Ref.Label(), analysis.FileCount, analysis.DirectoryCount, analysis.CommitsLast30Days, analysis.ActivityScore, analysis.ContributorCount, analysis.DependencyCount)
 
 	case "risk-map":
 		csv = "Node ID,Name,Language,Category,Fan In,Fan Out,Risk Score\n"
@@ -6293,13 +13869,14 @@ Dependencies,%d
 		// Default to analysis overview
 		csv = fmt.Sprintf(`Metric,Value
 Repository,%s
+Ref,%s
 Files,%d
 Directories,%d
 Commits (30d),%d
 Activity Score,%.1f
 Contributors,%d
 Dependencies,%d
-`, selected, analysis.FileCount, analysis.DirectoryCount, analysis.CommitsLast30Days, analysis.ActivityScore, analysis.ContributorCount, analysis.DependencyCount)
+`, selected, analysis.Ref.Label(), analysis.FileCount, analysis.DirectoryCount, analysis.CommitsLast30Days, analysis.ActivityScore, analysis.ContributorCount, analysis.DependencyCount)
 	}
 
 	filename := fmt.Sprintf("%s_%s.csv", strings.ReplaceAll(selected, "/", "-"), tab)
@@ -6310,11 +13887,25 @@ Dependencies,%d
 
 // getProjectTopology returns real topology analysis for the selected project
 func getProjectTopology(w http.ResponseWriter, r *http.Request) {
-	if githubToken == "" {
+	// Get selected project
+	stateLock.RLock()
+	foundRepo, _ := findRepoUnsafe(state.SelectedProject)
+	stateLock.RUnlock()
+
+	if foundRepo == nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&TopologyAnalysis{
+			Available: false,
+			Reason:    "No project selected",
+		})
+		return
+	}
+
+	if !isDataSourceConfigured(foundRepo) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(&TopologyAnalysis{
 			Available: false,
-			Reason:    "Not connected to GitHub",
+			Reason:    "Not connected: reconnect " + foundRepo.ConnectionID,
 			Metrics:   TopologyMetrics{},
 			Modules:   make([]TopologyModule, 0),
 			Clusters:  make([]TopologyCluster, 0),
@@ -6323,45 +13914,38 @@ func getProjectTopology(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get selected project
-	stateLock.RLock()
-	selected := state.SelectedProject
-	var foundRepo *DiscoveredRepo
-	for i := range state.DiscoveredRepos {
-		if state.DiscoveredRepos[i].FullName == selected {
-			foundRepo = &state.DiscoveredRepos[i]
-			break
-		}
-	}
-	stateLock.RUnlock()
-
-	if foundRepo == nil {
+	// Fetch file tree from GitHub
+	owner, name, ok := splitFullName(foundRepo.FullName)
+	if !ok {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(&TopologyAnalysis{
 			Available: false,
-			Reason:    "No project selected",
+			Reason:    "Invalid project name",
 		})
 		return
 	}
 
-	// Fetch file tree from GitHub
-	client := NewGitHubClient(githubToken)
-	parts := strings.Split(selected, "/")
-	if len(parts) != 2 {
+	ctx, cancel := sectionContext(r, "topology")
+	defer cancel()
+
+	ref, err := requestedRef(r)
+	var client RepoDataSource
+	var target *AnalysisRef
+	if err == nil {
+		client, target, err = resolveRepoRef(ctx, foundRepo, owner, name, ref)
+	}
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(&TopologyAnalysis{
 			Available: false,
-			Reason:    "Invalid project name",
+			Reason:    err.Error(),
 		})
 		return
 	}
 
-	branch := foundRepo.DefaultBranch
-	if branch == "" {
-		branch = "main"
-	}
+	client = analysisRunSnapshot(analysisKey(repoKey(foundRepo), ref, foundRepo.DefaultBranch), client, target, false)
 
-	tree, err := client.GetFileTree(parts[0], parts[1], branch)
+	tree, err := client.GetFileTree(ctx, owner, name, target.Name)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(&TopologyAnalysis{
@@ -6372,11 +13956,13 @@ func getProjectTopology(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Analyze topology
-	topology := analyzeTopology(tree)
-	topology.ProjectFullName = selected // Critical: Tag with project identifier
+	submodules, structureTree := detectSubmodules(ctx, client, owner, name, tree)
+	graph := buildImportGraph(ctx, client, owner, name, structureTree, submodules)
+	topology := analyzeTopology(structureTree, submodules, graph)
+	topology.ProjectFullName = foundRepo.FullName // Critical: Tag with project identifier
 
 	log.Printf("[Topology] Analyzed %s: %d modules, %d clusters, %d edges",
-		selected, len(topology.Modules), len(topology.Clusters), len(topology.Edges))
+		foundRepo.FullName, len(topology.Modules), len(topology.Clusters), len(topology.Edges))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(topology)
@@ -6393,19 +13979,16 @@ func generateJSON(w http.ResponseWriter, r *http.Request) {
 	projectParam := r.URL.Query().Get("project")
 
 	stateLock.RLock()
-	conn := state.Connection
 	selected := state.SelectedProject
 	if projectParam != "" {
-		selected = projectParam
+		selected = projectKeyParam(r, projectParam)
 	}
-	var repo *DiscoveredRepo
-	for i := range state.DiscoveredRepos {
-		if state.DiscoveredRepos[i].FullName == selected {
-			repo = &state.DiscoveredRepos[i]
-			break
-		}
+	repo, _ := findRepoUnsafe(selected)
+	if repo != nil {
+		selected = repo.FullName
 	}
-	analysis := state.Analyses[selected]
+	conn := repoConnectionUnsafe(repo)
+	analysis := storedAnalysisUnsafe(repo, r.URL.Query().Get("ref"))
 	stateLock.RUnlock()
 
 	// Build tab-specific response
@@ -6465,6 +14048,9 @@ func generateJSON(w http.ResponseWriter, r *http.Request) {
 			"generated":  time.Now().Format(time.RFC3339),
 		}
 	}
+	if analysis != nil && analysis.Ref != nil {
+		data["ref"] = analysis.Ref
+	}
 
 	filename := fmt.Sprintf("%s_%s.json", strings.ReplaceAll(selected, "/", "-"), tab)
 	w.Header().Set("Content-Type", "application/json")
@@ -6521,7 +14107,7 @@ func aiOverview(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current project context using existing pattern
-	owner, repo, _, foundRepo, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		json.NewEncoder(w).Encode(AIOverviewResponse{
 			Success: false,
@@ -6540,9 +14126,17 @@ func aiOverview(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	cacheKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Get cached analysis data from various endpoints
-	client := NewGitHubClient(githubToken)
+	client, err := newRepoDataSource(foundRepo)
+	if err != nil {
+		json.NewEncoder(w).Encode(AIOverviewResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
 
 	// Aggregate analysis data for AI prompt
 	missingData := []string{}
@@ -6550,7 +14144,7 @@ func aiOverview(w http.ResponseWriter, r *http.Request) {
 	// Check what data is available via cache
 	var hasTrajectory, hasTopology, hasImpact, hasDeps, hasConcentration, hasTemporal bool
 
-	if cached, ok := analysisCache.Get("trajectory", projectKey); ok {
+	if cached, ok := analysisCache.Get("trajectory", cacheKey); ok {
 		if resp, ok := cached.(map[string]interface{}); ok {
 			if analysis, ok := resp["analysis"].(map[string]interface{}); ok {
 				if trajectory, ok := analysis["trajectory"].(map[string]interface{}); ok {
@@ -6562,23 +14156,23 @@ func aiOverview(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if cached, ok := analysisCache.Get("topology", projectKey); ok && cached != nil {
+	if cached, ok := analysisCache.Get("topology", cacheKey); ok && cached != nil {
 		hasTopology = true
 	}
 
-	if cached, ok := analysisCache.Get("impact", projectKey); ok && cached != nil {
+	if cached, ok := analysisCache.Get("impact", cacheKey); ok && cached != nil {
 		hasImpact = true
 	}
 
-	if cached, ok := analysisCache.Get("dependencies", projectKey); ok && cached != nil {
+	if cached, ok := analysisCache.Get("dependencies", cacheKey); ok && cached != nil {
 		hasDeps = true
 	}
 
-	if cached, ok := analysisCache.Get("concentration", projectKey); ok && cached != nil {
+	if cached, ok := analysisCache.Get("concentration", cacheKey); ok && cached != nil {
 		hasConcentration = true
 	}
 
-	if cached, ok := analysisCache.Get("temporal", projectKey); ok && cached != nil {
+	if cached, ok := analysisCache.Get("temporal", cacheKey); ok && cached != nil {
 		hasTemporal = true
 	}
 
@@ -6621,7 +14215,7 @@ func aiOverview(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func buildAnalysisSummaryFromRepo(repo *DiscoveredRepo, client *GitHubClient, owner, repo_name string) string {
+func buildAnalysisSummaryFromRepo(repo *DiscoveredRepo, client RepoDataSource, owner, repo_name string) string {
 	var sb strings.Builder
 
 	if repo != nil {
@@ -6748,7 +14342,7 @@ func aiAnalysisInterpretation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current project context
-	owner, repo, _, foundRepo, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -6765,13 +14359,14 @@ func aiAnalysisInterpretation(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	cacheKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Build interpretation based on cached dashboard data
 	warnings := []string{}
 	insights := []string{}
 
 	// Check cache for dashboard data
-	if cached, ok := analysisCache.Get("dashboard", projectKey); ok {
+	if cached, ok := analysisCache.Get("dashboard", cacheKey); ok {
 		if resp, ok := cached.(map[string]interface{}); ok {
 			if analysis, ok := resp["analysis"].(*RepoAnalysis); ok && analysis != nil {
 				// Activity interpretation
@@ -6850,7 +14445,7 @@ func aiTopologyInterpretation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current project context
-	owner, repo, _, _, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -6867,13 +14462,14 @@ func aiTopologyInterpretation(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	cacheKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Build interpretation based on cached topology data
 	warnings := []string{}
 	insights := []string{}
 
 	// Check cache for topology data
-	if cached, ok := analysisCache.Get("topology", projectKey); ok {
+	if cached, ok := analysisCache.Get("topology", cacheKey); ok {
 		if resp, ok := cached.(map[string]interface{}); ok {
 			// Extract metrics
 			if metricsRaw, ok := resp["metrics"]; ok {
@@ -6952,7 +14548,7 @@ func aiTrajectoryInterpretation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current project context
-	owner, repo, _, _, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -6969,13 +14565,14 @@ func aiTrajectoryInterpretation(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	cacheKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Build interpretation based on cached trajectory data
 	warnings := []string{}
 	insights := []string{}
 
 	// Check cache for trajectory data
-	if cached, ok := analysisCache.Get("trajectory", projectKey); ok {
+	if cached, ok := analysisCache.Get("trajectory", cacheKey); ok {
 		if resp, ok := cached.(map[string]interface{}); ok {
 			if analysisRaw, ok := resp["analysis"].(map[string]interface{}); ok {
 				if trajectoryRaw, ok := analysisRaw["trajectory"]; ok {
@@ -7047,7 +14644,7 @@ func aiImpactInterpretation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current project context
-	owner, repo, _, _, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -7064,13 +14661,14 @@ func aiImpactInterpretation(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	cacheKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Build interpretation based on cached impact data
 	warnings := []string{}
 	insights := []string{}
 
 	// Check cache for impact data
-	if cached, ok := analysisCache.Get("impact", projectKey); ok {
+	if cached, ok := analysisCache.Get("impact", cacheKey); ok {
 		if resp, ok := cached.(map[string]interface{}); ok {
 			if analysisRaw, ok := resp["analysis"].(map[string]interface{}); ok {
 				if impactRaw, ok := analysisRaw["impact"]; ok {
@@ -7145,7 +14743,7 @@ func aiDependencyInterpretation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current project context
-	owner, repo, _, _, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -7162,13 +14760,14 @@ func aiDependencyInterpretation(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	cacheKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Build interpretation based on cached dependency data
 	warnings := []string{}
 	insights := []string{}
 
 	// Check cache for dependency data
-	if cached, ok := analysisCache.Get("dependencies", projectKey); ok {
+	if cached, ok := analysisCache.Get("dependencies", cacheKey); ok {
 		if resp, ok := cached.(map[string]interface{}); ok {
 			if analysisRaw, ok := resp["analysis"].(map[string]interface{}); ok {
 				if depsRaw, ok := analysisRaw["deps"]; ok {
@@ -7241,7 +14840,7 @@ func aiConcentrationInterpretation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current project context
-	owner, repo, _, _, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -7258,13 +14857,14 @@ func aiConcentrationInterpretation(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	cacheKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Build interpretation based on cached concentration data
 	warnings := []string{}
 	insights := []string{}
 
 	// Check cache for concentration data
-	if cached, ok := analysisCache.Get("concentration", projectKey); ok {
+	if cached, ok := analysisCache.Get("concentration", cacheKey); ok {
 		if resp, ok := cached.(map[string]interface{}); ok {
 			if analysisRaw, ok := resp["analysis"].(map[string]interface{}); ok {
 				if concRaw, ok := analysisRaw["concentration"]; ok {
@@ -7336,7 +14936,7 @@ func aiTemporalInterpretation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current project context
-	owner, repo, _, _, err := getSelectedProjectContext()
+	owner, repo, branch, foundRepo, err := getSelectedProjectContext(r)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -7353,13 +14953,14 @@ func aiTemporalInterpretation(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	cacheKey := analysisKey(repoKey(foundRepo), branch, foundRepo.DefaultBranch)
 
 	// Build interpretation based on cached temporal data
 	warnings := []string{}
 	insights := []string{}
 
 	// Check cache for temporal data
-	if cached, ok := analysisCache.Get("temporal", projectKey); ok {
+	if cached, ok := analysisCache.Get("temporal", cacheKey); ok {
 		if resp, ok := cached.(map[string]interface{}); ok {
 			if analysisRaw, ok := resp["analysis"].(map[string]interface{}); ok {
 				if tempRaw, ok := analysisRaw["temporal"]; ok {
@@ -7407,21 +15008,112 @@ func aiTemporalInterpretation(w http.ResponseWriter, r *http.Request) {
 // ==================== MAIN ====================
 
 func main() {
-	loadState()
-
 	// Start background rate limit cleanup goroutine
 	go cleanupRateLimitMap()
 
-	// Try to use env token on startup
+	// GITHUB_API_URL points the client at a GitHub Enterprise Server instance
+	if apiURL := os.Getenv("GITHUB_API_URL"); apiURL != "" {
+		envGitHubAPIURL = normalizeGitHubAPIURL(apiURL)
+		log.Printf("[Startup] Using GitHub API at %s", envGitHubAPIURL)
+	}
+
+	// Older state files are migrated against the GitHub host set above
+	loadState()
+
+	// GITHUB_RECORD_DIR captures every GitHub API response as a replayable fixture
+	if recordDir := os.Getenv("GITHUB_RECORD_DIR"); recordDir != "" {
+		recorder, err := newFixtureRecorder(recordDir)
+		if err != nil {
+			log.Fatalf("[Startup] Failed to open GITHUB_RECORD_DIR: %v", err)
+		}
+		githubFixtureRecorder = recorder
+		log.Printf("[Startup] Recording GitHub API fixtures to %s", recordDir)
+	}
+
+	// GITHUB_REPLAY_DIR serves recorded fixtures on GITHUB_REPLAY_ADDR and
+	// points GitHub connections at them, for offline end-to-end runs
+	replayDir := os.Getenv("GITHUB_REPLAY_DIR")
+	if replayDir != "" {
+		addr := os.Getenv("GITHUB_REPLAY_ADDR")
+		if addr == "" {
+			addr = "127.0.0.1:8090"
+		}
+		apiURL, err := startFixtureReplay(replayDir, addr)
+		if err != nil {
+			log.Fatalf("[Startup] Failed to start fixture replay: %v", err)
+		}
+		envGitHubAPIURL = apiURL
+		registryLookups = false
+		log.Printf("[Startup] Replaying GitHub API fixtures from %s at %s", replayDir, apiURL)
+	}
+
+	// GITHUB_CACHE_DIR holds cached API responses; "off" disables the cache.
+	// The default lives in the user's own cache directory, never a shared one.
+	// Replay runs default to no cache so results depend only on the fixtures.
+	cacheDir := os.Getenv("GITHUB_CACHE_DIR")
+	if cacheDir == "" && replayDir != "" {
+		cacheDir = "off"
+	}
+	if cacheDir == "" {
+		if userCache, err := os.UserCacheDir(); err != nil {
+			log.Printf("[Startup] Response cache disabled: %v", err)
+			cacheDir = "off"
+		} else {
+			cacheDir = filepath.Join(userCache, "repoanalyst", "http")
+		}
+	}
+	if cacheDir != "off" {
+		if rc, err := newResponseCache(cacheDir); err != nil {
+			log.Printf("[Startup] Response cache disabled: %v", err)
+		} else {
+			githubResponseCache = rc
+			log.Printf("[Startup] Caching GitHub responses in %s", cacheDir)
+		}
+	}
+
+	// GITHUB_OAUTH_CLIENT_ID enables connecting accounts through the device flow
+	oauthClientID = os.Getenv("GITHUB_OAUTH_CLIENT_ID")
+	oauthClientSecret = os.Getenv("GITHUB_OAUTH_CLIENT_SECRET")
+	if scopes := os.Getenv("GITHUB_OAUTH_SCOPES"); scopes != "" {
+		oauthScopes = scopes
+	}
+
+	// GITHUB_TOKEN connects its account on startup. The App and local clones
+	// below are connections of their own next to it.
 	if envToken := os.Getenv("GITHUB_TOKEN"); envToken != "" {
-		githubToken = envToken
-		log.Printf("[Startup] GitHub token loaded from environment")
+		connectEnvToken(context.Background(), envToken)
+	}
+
+	if os.Getenv("GITHUB_APP_ID") != "" {
+		app, err := loadGitHubAppFromEnv()
+		if err != nil {
+			log.Fatalf("[Startup] Failed to configure GitHub App: %v", err)
+		}
+		log.Printf("[Startup] GitHub App %d configured from environment", app.appID)
+		if err := connectGitHubApp(context.Background(), app); err != nil {
+			log.Printf("[Startup] GitHub App discovery failed: %v", err)
+		}
+	}
+
+	// RECURSE_SUBMODULES reads submodule trees into the structural analyses
+	recurseSubmodules, _ = strconv.ParseBool(os.Getenv("RECURSE_SUBMODULES"))
+
+	// LOCAL_REPOS_DIR adds the clones under it as one more connection
+	if localDir := os.Getenv("LOCAL_REPOS_DIR"); localDir != "" {
+		localRepoRoot = localDir
+		if err := connectLocalRepositories(context.Background()); err != nil {
+			log.Fatalf("[Startup] Failed to read LOCAL_REPOS_DIR: %v", err)
+		}
 	}
 
 	// GitHub Connection
 	http.HandleFunc("/api/github/connect", corsMiddleware(githubConnect))
 	http.HandleFunc("/api/github/disconnect", corsMiddleware(githubDisconnect))
+	http.HandleFunc("/api/github/rediscover", corsMiddleware(githubRediscover))
 	http.HandleFunc("/api/github/status", corsMiddleware(githubStatus))
+	http.HandleFunc("/api/github/ratelimit", corsMiddleware(githubRateLimit))
+	http.HandleFunc("/api/github/device/start", corsMiddleware(githubDeviceStart))
+	http.HandleFunc("/api/github/device/poll", corsMiddleware(githubDevicePoll))
 
 	// Projects
 	http.HandleFunc("/api/projects", corsMiddleware(listProjects))
@@ -7452,6 +15144,7 @@ func main() {
 
 	// Analysis
 	http.HandleFunc("/api/analysis/refresh", corsMiddleware(refreshAnalysis))
+	http.HandleFunc("/api/analysis/window", corsMiddleware(analysisWindowSetting))
 	http.HandleFunc("/api/analysis/dashboard", corsMiddleware(analysisDashboard))
 	http.HandleFunc("/api/analysis/trajectory", corsMiddleware(analysisTrajectory))
 	http.HandleFunc("/api/analysis/dependencies", corsMiddleware(analysisDependencies))
@@ -7461,6 +15154,7 @@ func main() {
 	http.HandleFunc("/api/analysis/busfactor", corsMiddleware(analysisBusFactor))
 	http.HandleFunc("/api/analysis/tree", corsMiddleware(analysisTree))
 	http.HandleFunc("/api/analysis/predictions", corsMiddleware(analysisPredictions))
+	http.HandleFunc("/api/analysis/reviews", corsMiddleware(analysisReviews))
 
 	// AI Analyst
 	http.HandleFunc("/api/ai/overview", corsMiddleware(aiOverview))
@@ -7487,16 +15181,28 @@ func main() {
 	fmt.Println("🚀 RepoAnalyst API Server (Real Analysis)")
 	fmt.Printf("   http://localhost:%s\n", port)
 	fmt.Println("")
-	if githubToken != "" {
-		fmt.Println("   ✅ GitHub Token: Pre-configured from environment")
-	} else {
+	for _, conn := range liveConnections() {
+		switch {
+		case conn.provider == "local":
+			fmt.Printf("   ✅ Local clones: %s\n", conn.baseURL)
+		case conn.creds.app != nil:
+			fmt.Printf("   ✅ GitHub App: %d\n", conn.creds.app.appID)
+		case conn == envConnection:
+			fmt.Println("   ✅ GitHub Token: Pre-configured from environment")
+		}
+	}
+	if len(liveConnections()) == 0 {
 		fmt.Println("   ⏳ Waiting for GitHub connection via UI...")
 	}
 	fmt.Println("")
 	fmt.Println("   Endpoints:")
 	fmt.Println("   POST /api/github/connect    - Connect GitHub account")
+	fmt.Println("   POST /api/github/device/start - Start OAuth device flow")
+	fmt.Println("   POST /api/github/device/poll  - Complete OAuth device flow")
 	fmt.Println("   POST /api/github/disconnect - Disconnect")
+	fmt.Println("   POST /api/github/rediscover - Refresh a connection's repos")
 	fmt.Println("   GET  /api/github/status     - Connection status")
+	fmt.Println("   GET  /api/github/ratelimit  - Remaining API budget")
 	fmt.Println("   GET  /api/projects          - List discovered repos")
 	fmt.Println("   POST /api/projects/{o}/{r}/analyze - Analyze a project")
 	fmt.Println("   GET  /api/projects/selected - Get selected project")
@@ -7565,7 +15271,7 @@ func classifyCommitIntent(message string, files []string) (string, float64, stri
 	return "unknown", 0.3, "no_strong_signals"
 }
 
-func analyzeCommitIntents(client *GitHubClient, owner, repo string, commits []GitHubCommit) *IntentDistribution {
+func analyzeCommitIntents(ctx context.Context, client RepoDataSource, owner, repo string, commits []GitHubCommit) *IntentDistribution {
 	counts := make(map[string]int)
 	total := 0
 	lowConfidenceCount := 0
@@ -7581,7 +15287,7 @@ func analyzeCommitIntents(client *GitHubClient, owner, repo string, commits []Gi
 
 		files := []string{}
 		if i < 15 { // Deeper analysis for the most recent ones
-			f, err := client.GetCommitFiles(owner, repo, sha)
+			f, err := client.GetCommitFiles(ctx, owner, repo, sha)
 			if err == nil {
 				files = f
 			}
@@ -7627,7 +15333,8 @@ func analyzeCommitIntents(client *GitHubClient, owner, repo string, commits []Gi
 
 // ==================== STRUCTURAL DEPTH ANALYSIS ====================
 
-func analyzeStructuralDepth(tree []GitHubTreeNode) *StructuralDepthAnalysis {
+func analyzeStructuralDepth(structureTree *GitHubTreeResponse) *StructuralDepthAnalysis {
+	tree := treeNodes(structureTree)
 	if len(tree) == 0 {
 		return &StructuralDepthAnalysis{Available: false}
 	}
@@ -7721,6 +15428,7 @@ func analyzeStructuralDepth(tree []GitHubTreeNode) *StructuralDepthAnalysis {
 		Imbalances:      imbalances,
 		SurfaceRatio:    surfaceRatio,
 		StructureStatus: status,
+		Confidence:      computeStructuralConfidence(structureTree),
 	}
 }
 
@@ -7815,7 +15523,8 @@ func analyzeActivityVolatility(commits []GitHubCommit) *ActivityVolatility {
 
 // ==================== TEST SURFACE ANALYSIS ====================
 
-func analyzeTestSurface(tree []GitHubTreeNode, deps []DependencyDetail) *TestSurfaceAnalysis {
+func analyzeTestSurface(fileTree *GitHubTreeResponse, deps []DependencyDetail) *TestSurfaceAnalysis {
+	tree := treeNodes(fileTree)
 	if len(tree) == 0 {
 		return &TestSurfaceAnalysis{Available: false}
 	}
@@ -7932,17 +15641,18 @@ func analyzeTestSurface(tree []GitHubTreeNode, deps []DependencyDetail) *TestSur
 		MismatchedDeps:        mismatched,
 		TestDependenciesFound: testDepsFound,
 		Interpretation:        interpretation,
+		Confidence:            computeStructuralConfidence(fileTree),
 	}
 }
 
 // ==================== SECURITY CONSISTENCY ANALYSIS ====================
 
-func analyzeSecurityConsistency(client *GitHubClient, owner, repo string, tree []GitHubTreeNode, deps []DependencyDetail) *SecurityConsistencyAnalysis {
+func analyzeSecurityConsistency(ctx context.Context, client RepoDataSource, owner, repo string, tree []GitHubTreeNode, deps []DependencyDetail) *SecurityConsistencyAnalysis {
 	// 1. Fetch README
 	readmeNames := []string{"README.md", "README", "readme.md"}
 	var readmeContent string
 	for _, name := range readmeNames {
-		content, err := client.GetFileContent(owner, repo, name)
+		content, err := client.GetFileContent(ctx, owner, repo, name)
 		if err == nil {
 			readmeContent = strings.ToLower(string(content))
 			break
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// replayServer serves a fixture directory under testdata/replay as a GitHub
+// Enterprise API root and connects to it the way the UI would, leaving the
+// fixture repository selected with a commit-count window, so fixture dates
+// never age out of the analysis
+func replayServer(t *testing.T, fixtures, project string) {
+	t.Helper()
+	handler, err := newFixtureReplayHandler(filepath.Join("testdata", "replay", fixtures))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := httptest.NewServer(handler)
+	t.Cleanup(api.Close)
+
+	savedCache, savedFile := githubResponseCache, stateFile
+	githubResponseCache, stateFile, registryLookups = nil, filepath.Join(t.TempDir(), "state.json"), false
+	t.Cleanup(func() {
+		githubResponseCache, stateFile, registryLookups = savedCache, savedFile, true
+		loadState()
+		resetConnections()
+	})
+	loadState()
+	resetConnections()
+	analysisCache.InvalidateAll()
+	analysisStatesMutex.Lock()
+	analysisStates = make(map[string]*RepositoryAnalysisState)
+	analysisStatesMutex.Unlock()
+
+	// The stand-in server has no /api/v3 path of its own, so the client
+	// addresses it as a GitHub Enterprise host
+	call(t, githubConnect, "POST", "/api/github/connect", `{"token":"fixture-token","baseUrl":"`+api.URL+`"}`)
+	call(t, selectProject, "POST", "/api/projects/select", `{"fullName":"`+project+`"}`)
+	call(t, analysisWindowSetting, "POST", "/api/analysis/window", `{"days":0,"maxCommits":100}`)
+}
+
+// resetConnections forgets every registered connection
+func resetConnections() {
+	connectionsLock.Lock()
+	connections = make(map[string]*liveConnection)
+	connectionsLock.Unlock()
+	envConnection = nil
+}
+
+// call runs handler on a request and fails the test unless it answers 200
+func call(t *testing.T, handler http.HandlerFunc, method, target, body string) []byte {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	data, _ := io.ReadAll(rec.Result().Body)
+	if rec.Code != 200 {
+		t.Fatalf("%s %s = %d: %s", method, target, rec.Code, data)
+	}
+	return data
+}
+
+// lookup walks a decoded JSON document along keys, failing when a key is missing
+func lookup(t *testing.T, doc interface{}, keys ...string) interface{} {
+	t.Helper()
+	for _, key := range keys {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s: not an object", strings.Join(keys, "."))
+		}
+		if doc, ok = m[key]; !ok {
+			t.Fatalf("%s: missing %q", strings.Join(keys, "."), key)
+		}
+	}
+	return doc
+}
+
+func TestReplayAnalysisEndpoints(t *testing.T) {
+	replayServer(t, "acme-app", "acme/app")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		check   func(t *testing.T, doc interface{})
+	}{
+		{"window", analysisWindowSetting, "GET", "/api/analysis/window", func(t *testing.T, doc interface{}) {
+			if got := lookup(t, doc, "label"); got != "Last 100 Commits" {
+				t.Errorf("label = %v", got)
+			}
+		}},
+		{"refresh", refreshAnalysis, "POST", "/api/analysis/refresh", func(t *testing.T, doc interface{}) {
+			if got := lookup(t, doc, "analysis", "totalCommits"); got != 6.0 {
+				t.Errorf("totalCommits = %v, want 6", got)
+			}
+			if got := lookup(t, doc, "analysis", "contributorCount"); got != 2.0 {
+				t.Errorf("contributorCount = %v, want 2", got)
+			}
+		}},
+		{"dashboard", analysisDashboard, "GET", "/api/analysis/dashboard", func(t *testing.T, doc interface{}) {
+			if got := lookup(t, doc, "analysis", "fileCount"); got != 6.0 {
+				t.Errorf("fileCount = %v, want 6", got)
+			}
+		}},
+		{"trajectory", analysisTrajectory, "GET", "/api/analysis/trajectory", func(t *testing.T, doc interface{}) {
+			if got := lookup(t, doc, "analysis", "trajectory", "available"); got != true {
+				t.Errorf("trajectory available = %v", got)
+			}
+		}},
+		{"dependencies", analysisDependencies, "GET", "/api/analysis/dependencies", func(t *testing.T, doc interface{}) {
+			edges, _ := lookup(t, doc, "analysis", "deps", "edges").([]interface{})
+			found := false
+			for _, e := range edges {
+				if lookup(t, e, "target") == "github.com/pkg/errors" {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("dependency edges = %v; want github.com/pkg/errors", edges)
+			}
+		}},
+		{"concentration", analysisConcentration, "GET", "/api/analysis/concentration", func(t *testing.T, doc interface{}) {
+			if got := lookup(t, doc, "analysis", "concentration", "totalCommitsAnalyzed"); got != 6.0 {
+				t.Errorf("totalCommitsAnalyzed = %v, want 6", got)
+			}
+			if got := lookup(t, doc, "analysis", "concentration", "defects", "bugIssuesLinked"); got != 1.0 {
+				t.Errorf("bugIssuesLinked = %v, want 1", got)
+			}
+			// api/api.go was handler.go until its third commit
+			hotspots, _ := lookup(t, doc, "analysis", "concentration", "hotspots").([]interface{})
+			for _, h := range hotspots {
+				if lookup(t, h, "path") == "api/api.go" && lookup(t, h, "commitCount") != 3.0 {
+					t.Errorf("api/api.go commitCount = %v, want 3", lookup(t, h, "commitCount"))
+				}
+			}
+		}},
+		{"temporal", analysisTemporal, "GET", "/api/analysis/temporal", func(t *testing.T, doc interface{}) {
+			if got := lookup(t, doc, "analysis", "temporal", "available"); got != true {
+				t.Errorf("temporal available = %v", got)
+			}
+		}},
+		{"impact", analysisImpact, "GET", "/api/analysis/impact", func(t *testing.T, doc interface{}) {
+			if got := lookup(t, doc, "analysis", "impact", "available"); got != true {
+				t.Errorf("impact available = %v", got)
+			}
+		}},
+		{"busfactor", analysisBusFactor, "GET", "/api/analysis/busfactor", func(t *testing.T, doc interface{}) {
+			if got := lookup(t, doc, "analysis", "busFactor", "available"); got != true {
+				t.Errorf("busFactor available = %v", got)
+			}
+		}},
+		{"tree", analysisTree, "GET", "/api/analysis/tree", func(t *testing.T, doc interface{}) {
+			if got := lookup(t, doc, "analysis", "tree", "truncated"); got != false {
+				t.Errorf("tree truncated = %v", got)
+			}
+		}},
+		{"reviews", analysisReviews, "GET", "/api/analysis/reviews", func(t *testing.T, doc interface{}) {
+			if got := lookup(t, doc, "analysis", "reviews", "prsAnalyzed"); got != 2.0 {
+				t.Errorf("prsAnalyzed = %v, want 2", got)
+			}
+		}},
+		{"predictions", analysisPredictions, "GET", "/api/analysis/predictions", func(t *testing.T, doc interface{}) {
+			lookup(t, doc, "predictions")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc interface{}
+			data := call(t, tt.handler, tt.method, tt.target, "")
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("invalid JSON: %v\n%s", err, data)
+			}
+			tt.check(t, doc)
+		})
+	}
+}
+
+// An empty repository answers 409 for history and trees; every section must
+// still answer, reporting itself unavailable
+func TestReplayEmptyRepository(t *testing.T) {
+	replayServer(t, "acme-empty", "acme/empty")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		section string
+	}{
+		{"trajectory", analysisTrajectory, "/api/analysis/trajectory", "trajectory"},
+		{"dependencies", analysisDependencies, "/api/analysis/dependencies", "deps"},
+		{"concentration", analysisConcentration, "/api/analysis/concentration", "concentration"},
+		{"temporal", analysisTemporal, "/api/analysis/temporal", "temporal"},
+		{"impact", analysisImpact, "/api/analysis/impact", "impact"},
+		{"busfactor", analysisBusFactor, "/api/analysis/busfactor", "busFactor"},
+		{"tree", analysisTree, "/api/analysis/tree", "tree"},
+		{"reviews", analysisReviews, "/api/analysis/reviews", "reviews"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc interface{}
+			data := call(t, tt.handler, "GET", tt.target, "")
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("invalid JSON: %v\n%s", err, data)
+			}
+			if got := lookup(t, doc, "analysis", tt.section, "available"); got != false {
+				t.Errorf("%s available = %v, want false", tt.section, got)
+			}
+			if reason := lookup(t, doc, "analysis", tt.section, "reason"); reason == "" {
+				t.Errorf("%s gives no reason", tt.section)
+			}
+		})
+	}
+
+	var doc interface{}
+	json.Unmarshal(call(t, refreshAnalysis, "POST", "/api/analysis/refresh", ""), &doc)
+	if got := lookup(t, doc, "analysis", "totalCommits"); got != 0.0 {
+		t.Errorf("totalCommits = %v, want 0", got)
+	}
+}
+
+func TestReplayExportEndpoints(t *testing.T) {
+	replayServer(t, "acme-app", "acme/app")
+	call(t, refreshAnalysis, "POST", "/api/analysis/refresh", "")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		prefix  string
+	}{
+		{"json", generateJSON, "/api/export/json", `{`},
+		{"csv", generateCSV, "/api/export/csv", ``},
+		{"pdf", generatePDF, "/api/export/pdf", `%PDF`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := call(t, tt.handler, "GET", tt.target, "")
+			if len(data) == 0 || !bytes.HasPrefix(data, []byte(tt.prefix)) {
+				t.Errorf("%s starts with %q", tt.target, data[:min(len(data), 40)])
+			}
+		})
+	}
+}
+
+// replayTransport sends every request to the replay server, whatever host it
+// was addressed to
+type replayTransport struct {
+	host string
+}
+
+func (t replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = "http", t.host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// Each registry's answer is read as that registry words it: dist-tags,
+// stable-only maxima, newest-first or oldest-first version lists
+func TestRegistryLookups(t *testing.T) {
+	handler, err := newFixtureReplayHandler(filepath.Join("testdata", "replay", "registries"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registries := httptest.NewServer(handler)
+	defer registries.Close()
+
+	savedClient, savedLookups := registryClient, registryLookups
+	registryClient = &http.Client{Transport: replayTransport{host: strings.TrimPrefix(registries.URL, "http://")}}
+	registryLookups = true
+	defer func() { registryClient, registryLookups = savedClient, savedLookups }()
+
+	tests := []struct {
+		pkg, language, want string
+	}{
+		{"react", "typescript", "18.3.1"},
+		{"requests", "python", "2.32.3"},
+		{"github.com/pkg/errors", "go", "v0.9.1"},
+		{"serde", "rust", "1.0.203"},
+		{"rails", "ruby", "7.1.3"},
+		{"nosuchgem", "ruby", ""},
+		{"monolog/monolog", "php", "3.6.0"},
+		{"Newtonsoft.Json", "csharp", "13.0.3"},
+		{"left-pad", "npm", ""}, // No fixture: the registry answers 404
+		{"org.slf4j", "java", ""},
+	}
+	for _, tt := range tests {
+		if got := fetchLatestVersion(context.Background(), tt.pkg, tt.language); got != tt.want {
+			t.Errorf("fetchLatestVersion(%q, %q) = %q, want %q", tt.pkg, tt.language, got, tt.want)
+		}
+	}
+}
@@ -72,6 +72,7 @@ interface DiscoveredRepo {
     private: boolean;
     updatedAt: string;
     analysisState: string;
+    connectionId: string;
 }
 
 const baseNavItems = [
@@ -106,8 +107,11 @@ export default function App() {
         // First try to get from URL
         const path = window.location.pathname;
         const parts = path.split('/').filter(Boolean);
-        if (parts.length >= 2) {
-            // owner/repo format
+        if (parts.length >= 3) {
+            // owner/repo/tab format; GitLab owners may span several segments
+            return parts.slice(0, -1).join('/');
+        }
+        if (parts.length === 2) {
             return `${parts[0]}/${parts[1]}`;
         }
         // Fallback to sessionStorage
@@ -133,7 +137,7 @@ export default function App() {
         }
         const parts = path.split('/').filter(Boolean);
         if (parts.length >= 3) {
-            const tab = parts[2];
+            const tab = parts[parts.length - 1];
             if (navItems.find(n => n.id === tab)) {
                 return tab;
             }
@@ -348,7 +352,7 @@ export default function App() {
             try {
                 await fetch(`${API_BASE}/api/projects/selected`, {
                     method: 'POST',
-                    body: JSON.stringify({ fullName }),
+                    body: JSON.stringify({ fullName, connectionId: project?.connectionId }),
                     headers: { 'Content-Type': 'application/json' }
                 });
                 await fetchProjects();
@@ -363,8 +367,8 @@ export default function App() {
         }
 
         try {
-            const [owner, repo] = fullName.split('/');
-            const res = await fetch(`${API_BASE}/api/projects/${owner}/${repo}/analyze`, {
+            const connection = project ? `?connection=${encodeURIComponent(project.connectionId)}` : '';
+            const res = await fetch(`${API_BASE}/api/projects/${fullName}/analyze${connection}`, {
                 method: 'POST'
             });
             const data = await res.json();
@@ -16,7 +16,9 @@ interface Props {
 }
 
 export default function ProjectContextHeader({ title, projectId, className, isAnalysisReady = true, analysisContext }: Props) {
-    const [owner, repo] = projectId.split('/');
+    const slash = projectId.lastIndexOf('/');
+    const owner = projectId.slice(0, slash);
+    const repo = projectId.slice(slash + 1);
 
     return (
         <motion.div
@@ -258,8 +258,8 @@ export default function RealDashboard({ projectId, onLoadingChange, onTabChange
                     setRepo({
                         id: data.project.id?.toString() || '',
                         url: `https://github.com/${data.project.fullName}`,
-                        name: data.project.name || projectId.split('/')[1],
-                        owner: data.project.owner || projectId.split('/')[0],
+                        name: data.project.name || projectId.slice(projectId.lastIndexOf('/') + 1),
+                        owner: data.project.owner || projectId.slice(0, projectId.lastIndexOf('/')),
                         status: 'ready',
                         connectedAt: new Date().toISOString(),
                         fullName: data.project.fullName,